@@ -0,0 +1,119 @@
+package abbreviation
+
+import (
+	"text2phenotype.com/fdl/types"
+	"strings"
+	"unicode"
+)
+
+const (
+	minShortFormLength = 2
+	maxShortFormLength = 10
+)
+
+// Definition is the abbreviation defined in the document as "long form (SF)"
+type Definition struct {
+	ShortForm string
+	LongForm  string
+}
+
+// isShortForm checks the candidate in parentheses: it starts with a letter or digit and has at least one letter
+func isShortForm(text string) bool {
+	runes := []rune(text)
+	if len(runes) < minShortFormLength || len(runes) > maxShortFormLength {
+		return false
+	}
+	if !unicode.IsLetter(runes[0]) && !unicode.IsDigit(runes[0]) {
+		return false
+	}
+	for _, r := range runes {
+		if unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// findBestLongForm matches the short form characters from the end of the long form candidate, the first character
+// of the short form must start a word (Schwartz and Hearst, 2003). Returns empty string if there is no match.
+func findBestLongForm(shortForm string, longForm string) string {
+	sf := []rune(strings.ToLower(shortForm))
+	original := []rune(longForm)
+	lf := []rune(strings.ToLower(longForm))
+
+	sIndex := len(sf) - 1
+	lIndex := len(lf) - 1
+	for sIndex >= 0 {
+		c := sf[sIndex]
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			sIndex--
+			continue
+		}
+		for lIndex >= 0 && (lf[lIndex] != c ||
+			(sIndex == 0 && lIndex > 0 && (unicode.IsLetter(lf[lIndex-1]) || unicode.IsDigit(lf[lIndex-1])))) {
+			lIndex--
+		}
+		if lIndex < 0 {
+			return ""
+		}
+		lIndex--
+		sIndex--
+	}
+
+	// the long form starts with the word of the first matched character
+	start := lIndex + 1
+	for start > 0 && !unicode.IsSpace(lf[start-1]) {
+		start--
+	}
+	return strings.TrimSpace(string(original[start:]))
+}
+
+// FindDefinitions returns the abbreviations defined in the sentence as "long form (SF)"
+func FindDefinitions(sent types.Sentence) []Definition {
+	if sent.Text == nil {
+		return nil
+	}
+	runes := []rune(*sent.Text)
+	getText := func(begin int32, end int32) string {
+		return string(runes[begin-sent.Begin : end-sent.Begin])
+	}
+
+	var result []Definition
+	tokens := sent.Tokens
+	for i := 1; i+2 < len(tokens); i++ {
+		if *tokens[i].Text != "(" || *tokens[i+2].Text != ")" {
+			continue
+		}
+		shortForm := getText(tokens[i+1].Begin, tokens[i+1].End)
+		if !isShortForm(shortForm) {
+			continue
+		}
+
+		// long form candidate has at most min(|SF| + 5, |SF| * 2) words before the parenthesis
+		maxWords := len([]rune(shortForm)) + 5
+		if maxWords > 2*len([]rune(shortForm)) {
+			maxWords = 2 * len([]rune(shortForm))
+		}
+		first := i
+		for words := 0; first > 0 && words < maxWords; {
+			first--
+			if tokens[first].IsNewline {
+				first++
+				break
+			}
+			if tokens[first].IsWord || tokens[first].IsNumber {
+				words++
+			}
+		}
+		if first == i {
+			continue
+		}
+
+		longForm := findBestLongForm(shortForm, getText(tokens[first].Begin, tokens[i-1].End))
+		if len([]rune(longForm)) <= len([]rune(shortForm)) || strings.Contains(strings.ToLower(longForm), strings.ToLower(shortForm)) {
+			continue
+		}
+		result = append(result, Definition{ShortForm: shortForm, LongForm: longForm})
+	}
+	return result
+}
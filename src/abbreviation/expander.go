@@ -0,0 +1,107 @@
+package abbreviation
+
+import (
+	"text2phenotype.com/fdl/types"
+	"strings"
+)
+
+// documentDefinition is the sense of the short form defined in the document, the short form is matched
+// with the exact case
+type documentDefinition struct {
+	shortForm string
+	sense     *Sense
+}
+
+// Expander attaches the expansions to the abbreviations of the document. Abbreviations defined in the document win
+// over the list, the list senses are chosen by the words of the sentence.
+type Expander func(sentences []types.Sentence)
+
+func NewExpander(list List) Expander {
+	tokenize := newTextTokenizer()
+
+	return func(sentences []types.Sentence) {
+		definitions := make(map[string]documentDefinition)
+		for _, sent := range sentences {
+			for _, definition := range FindDefinitions(sent) {
+				key := strings.ToLower(definition.ShortForm)
+				if _, ok := definitions[key]; ok {
+					continue
+				}
+				definitions[key] = documentDefinition{
+					shortForm: definition.ShortForm,
+					sense: &Sense{
+						Expansion: definition.LongForm,
+						tokens:    getTokenPointers(tokenize(definition.LongForm)),
+					},
+				}
+			}
+		}
+
+		for _, sent := range sentences {
+			expandSentence(sent, list, definitions)
+		}
+	}
+}
+
+func getSentenceWords(sent types.Sentence) map[string]bool {
+	result := make(map[string]bool)
+	for _, token := range sent.Tokens {
+		if token.Text != nil {
+			result[*token.Text] = true
+		}
+		if token.Lemma != nil {
+			result[*token.Lemma] = true
+		}
+	}
+	return result
+}
+
+func expandSentence(sent types.Sentence, list List, definitions map[string]documentDefinition) {
+	var sentenceWords map[string]bool
+	runes := []rune(*sent.Text)
+
+	tokens := sent.Tokens
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if !token.IsWord || token.Text == nil {
+			continue
+		}
+
+		var sense *Sense
+		length, source := 1, types.ExpansionSourceDocument
+		if definition, ok := definitions[*token.Text]; ok && definition.shortForm == getText(runes, sent, token) {
+			sense = definition.sense
+		} else {
+			// the longest abbreviation of the list wins
+			var best *entry
+			for _, abbrEntry := range list[*token.Text] {
+				if abbrEntry.matches(tokens, i) && (best == nil || len(abbrEntry.tokens) > len(best.tokens)) {
+					best = abbrEntry
+				}
+			}
+			if best == nil {
+				continue
+			}
+			if sentenceWords == nil {
+				sentenceWords = getSentenceWords(sent)
+			}
+			sense, length, source = best.chooseSense(sentenceWords), len(best.tokens), types.ExpansionSourceList
+		}
+		if sense == nil || len(sense.tokens) == 0 {
+			continue
+		}
+
+		token.Expansion = &types.Expansion{
+			Abbreviation: string(runes[token.Begin-sent.Begin : tokens[i+length-1].End-sent.Begin]),
+			Text:         sense.Expansion,
+			Tokens:       sense.tokens,
+			Length:       length,
+			Source:       source,
+		}
+		i += length - 1
+	}
+}
+
+func getText(runes []rune, sent types.Sentence, token *types.Token) string {
+	return string(runes[token.Begin-sent.Begin : token.End-sent.Begin])
+}
@@ -0,0 +1,83 @@
+package abbreviation
+
+import (
+	"text2phenotype.com/fdl/tokenizer"
+	"text2phenotype.com/fdl/types"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func createSentences(t *testing.T, texts ...string) []types.Sentence {
+	ptb := tokenizer.NewTokenizerPTB()
+	var result []types.Sentence
+	var begin int32
+	for _, text := range texts {
+		text := text
+		sent := types.Sentence{Span: types.Span{Text: &text, Begin: begin, End: begin + int32(len([]rune(text)))}}
+		require.NoError(t, ptb(&sent))
+		result = append(result, sent)
+		begin = sent.End + 1
+	}
+	return result
+}
+
+func getExpansions(sentences []types.Sentence) map[string]types.Expansion {
+	result := make(map[string]types.Expansion)
+	for _, sent := range sentences {
+		for _, token := range sent.Tokens {
+			if token.Expansion != nil {
+				result[token.Expansion.Abbreviation] = *token.Expansion
+			}
+		}
+	}
+	return result
+}
+
+func TestFindDefinitions(t *testing.T) {
+	sentences := createSentences(t, "Patient has shortness of breath (SOB) at night.", "Blood pressure (BP) is stable.")
+	require.Equal(t, []Definition{{ShortForm: "SOB", LongForm: "shortness of breath"}}, FindDefinitions(sentences[0]))
+	require.Equal(t, []Definition{{ShortForm: "BP", LongForm: "Blood pressure"}}, FindDefinitions(sentences[1]))
+
+	require.Empty(t, FindDefinitions(createSentences(t, "She takes aspirin (daily).")[0]))
+}
+
+func TestExpander(t *testing.T) {
+	list, err := LoadList("../../resources/abbreviations/clinical.bsv")
+	require.NoError(t, err)
+	expand := NewExpander(list)
+
+	sentences := createSentences(t,
+		"Known CHF, c/o SOB.",
+		"Morphine sulfate (MS) 2 mg IV prn pain.",
+		"Later MS was given again.",
+		"ms was not found.")
+	expand(sentences)
+
+	expansions := getExpansions(sentences)
+	require.Equal(t, "congestive heart failure", expansions["CHF"].Text)
+	require.Equal(t, types.ExpansionSourceList, expansions["CHF"].Source)
+	require.Equal(t, "complains of", expansions["c/o"].Text)
+	require.Equal(t, "shortness of breath", expansions["SOB"].Text)
+	require.Len(t, expansions["SOB"].Tokens, 3)
+
+	// the document definition wins over the list
+	require.Equal(t, "Morphine sulfate", expansions["MS"].Text)
+	require.Equal(t, types.ExpansionSourceDocument, expansions["MS"].Source)
+	require.NotContains(t, expansions, "ms")
+}
+
+func TestExpanderContext(t *testing.T) {
+	list, err := LoadList("../../resources/abbreviations/clinical.bsv")
+	require.NoError(t, err)
+	expand := NewExpander(list)
+
+	sentences := createSentences(t, "MRI shows demyelinating lesions consistent with MS.", "Echo shows MS with a murmur.")
+	expand(sentences)
+	require.Equal(t, "multiple sclerosis", sentences[0].Tokens[len(sentences[0].Tokens)-2].Expansion.Text)
+	require.Equal(t, "mitral stenosis", sentences[1].Tokens[2].Expansion.Text)
+
+	// without the context words only the default sense is used, MS has none
+	sentences = createSentences(t, "History of MS.")
+	expand(sentences)
+	require.Empty(t, getExpansions(sentences))
+}
@@ -0,0 +1,171 @@
+package abbreviation
+
+import (
+	"bufio"
+	"text2phenotype.com/fdl/tokenizer"
+	"text2phenotype.com/fdl/types"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// caseExact is the CASE column value of the abbreviations which are matched with the exact case
+const caseExact = "exact"
+
+// Sense is one of the expansions of the abbreviation. It's chosen when its context words are in the sentence,
+// the sense without context words is the default one.
+type Sense struct {
+	Expansion string
+	Context   []string
+	tokens    []*string
+}
+
+type entry struct {
+	// lower case tokens of the abbreviation
+	tokens []string
+	// shaped text of the tokens, is set only for the case sensitive abbreviations
+	casedTokens []string
+	senses      []*Sense
+}
+
+// List is the clinical abbreviation list keyed by the first token of the abbreviation
+type List map[string][]*entry
+
+// textTokenizer splits the text by the runtime PTB tokenizer, so abbreviations and their expansions are tokenized
+// the same way as the document
+func newTextTokenizer() func(text string) []*types.Token {
+	ptb := tokenizer.NewTokenizerPTB()
+	return func(text string) []*types.Token {
+		sent := types.Sentence{Span: types.Span{Text: &text, End: int32(len([]rune(text)))}}
+		if err := ptb(&sent); err != nil {
+			return nil
+		}
+		var result []*types.Token
+		for _, token := range sent.Tokens {
+			if !token.IsNewline {
+				result = append(result, token)
+			}
+		}
+		return result
+	}
+}
+
+func getTokenPointers(tokens []*types.Token) []*string {
+	result := make([]*string, len(tokens))
+	for i, token := range tokens {
+		result[i] = token.Text
+	}
+	return result
+}
+
+// LoadList reads the BSV file with ABBREVIATION|EXPANSION|CONTEXT|CASE lines, CONTEXT is the comma separated words
+// and CASE is "exact" for the abbreviations which are matched with the exact case. Lines starting with # are comments.
+func LoadList(path string) (List, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	tokenize := newTextTokenizer()
+	entries := make(map[string]*entry)
+	result := make(List)
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		columns := strings.Split(line, "|")
+		if len(columns) < 2 || len(strings.TrimSpace(columns[0])) == 0 || len(strings.TrimSpace(columns[1])) == 0 {
+			return nil, fmt.Errorf("%s:%d: abbreviation line should have ABBREVIATION|EXPANSION columns", path, lineNumber)
+		}
+		abbreviation := strings.TrimSpace(columns[0])
+		isExact := len(columns) > 3 && strings.EqualFold(strings.TrimSpace(columns[3]), caseExact)
+
+		sense := &Sense{
+			Expansion: strings.TrimSpace(columns[1]),
+			tokens:    getTokenPointers(tokenize(strings.TrimSpace(columns[1]))),
+		}
+		if len(columns) > 2 {
+			for _, word := range strings.Split(columns[2], ",") {
+				if word = strings.ToLower(strings.TrimSpace(word)); len(word) > 0 {
+					sense.Context = append(sense.Context, word)
+				}
+			}
+		}
+
+		key := abbreviation
+		if !isExact {
+			key = strings.ToLower(key)
+		}
+		abbrEntry, ok := entries[key]
+		if !ok {
+			abbrEntry = &entry{}
+			for _, token := range tokenize(abbreviation) {
+				abbrEntry.tokens = append(abbrEntry.tokens, *token.Text)
+				if isExact {
+					abbrEntry.casedTokens = append(abbrEntry.casedTokens, token.GetShapedText())
+				}
+			}
+			if len(abbrEntry.tokens) == 0 {
+				return nil, fmt.Errorf("%s:%d: abbreviation %q has no tokens", path, lineNumber, abbreviation)
+			}
+			entries[key] = abbrEntry
+			result[abbrEntry.tokens[0]] = append(result[abbrEntry.tokens[0]], abbrEntry)
+		}
+		abbrEntry.senses = append(abbrEntry.senses, sense)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// matches checks the abbreviation against the tokens starting from the token with index idx
+func (abbrEntry *entry) matches(tokens []*types.Token, idx int) bool {
+	if idx+len(abbrEntry.tokens) > len(tokens) {
+		return false
+	}
+	for i, abbrToken := range abbrEntry.tokens {
+		token := tokens[idx+i]
+		if token.IsNewline || token.Text == nil || *token.Text != abbrToken {
+			return false
+		}
+		if abbrEntry.casedTokens != nil && token.GetShapedText() != abbrEntry.casedTokens[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// chooseSense returns the sense with the most context words in the sentence or the default sense
+func (abbrEntry *entry) chooseSense(sentenceWords map[string]bool) *Sense {
+	var best, defaultSense *Sense
+	bestCount := 0
+	for _, sense := range abbrEntry.senses {
+		if len(sense.Context) == 0 {
+			if defaultSense == nil {
+				defaultSense = sense
+			}
+			continue
+		}
+		count := 0
+		for _, word := range sense.Context {
+			if sentenceWords[word] {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = sense, count
+		}
+	}
+	if best != nil {
+		return best
+	}
+	return defaultSense
+}
@@ -1,15 +1,50 @@
 package api
 
 import (
+	"text2phenotype.com/fdl/lookup"
+	"text2phenotype.com/fdl/output"
 	"text2phenotype.com/fdl/pipeline"
+	"text2phenotype.com/fdl/types"
+	"fmt"
+	"github.com/rs/zerolog"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strings"
 )
 
+// formatParam selects the output format of the response
+const formatParam = "format"
+
+// versionParam selects the version of the JSON response
+const versionParam = "version"
+
+// inputParam selects the input format of the request body, the plain text is expected by default
+const (
+	inputParam = "input"
+	inputBioC  = "bioc"
+)
+
+// overlapResolutionParam sets the overlap resolution of all configurations, "overlap_resolution.{config}"
+// sets it for one configuration
+const overlapResolutionParam = "overlap_resolution"
+
+// HTMLPath returns the HTML visualization of the posted note
+const HTMLPath = "/html"
+
 type Request struct {
 	Pipeline pipeline.Pipeline
 }
 
+// ProcessHTML processes the posted note like ProcessData and returns the HTML visualization of the annotations
+func (req *Request) ProcessHTML(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	query.Set(formatParam, output.FormatHTML)
+	query.Del(inputParam)
+	r.URL.RawQuery = query.Encode()
+	req.ProcessData(w, r)
+}
+
 func (req *Request) ProcessData(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -28,12 +63,173 @@ func (req *Request) ProcessData(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	vocabs, err := getRequestVocabParams(r.URL.Query())
+	if err != nil {
+		logger.Err(err).Int("status", http.StatusBadRequest).Msg("Request parameters are not correct")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	formatName := r.URL.Query().Get(formatParam)
+	format, err := output.GetFormat(formatName)
+	if err != nil {
+		logger.Err(err).Int("status", http.StatusBadRequest).Msg("Output format is not correct")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	version := r.URL.Query().Get(versionParam)
+	if format, err = output.WithVersion(format, version); err != nil {
+		logger.Err(err).Int("status", http.StatusBadRequest).Msg("Response version is not correct")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch input := r.URL.Query().Get(inputParam); input {
+	case "":
+	case inputBioC:
+		if len(version) > 0 && version != types.ResponseVersion1 {
+			err := fmt.Errorf("response version %s is not supported with %s input", version, inputBioC)
+			logger.Err(err).Int("status", http.StatusBadRequest).Msg("Response version is not correct")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch {
+		case format.IsConcatenable:
+			req.streamBioC(w, logger, msg, vocabs, format)
+		case len(formatName) == 0:
+			req.processBioC(w, logger, msg, vocabs, output.IsBioCXML(msg))
+		case format.Name == output.FormatBioCJSON || format.Name == output.FormatBioCXML:
+			req.processBioC(w, logger, msg, vocabs, format.Name == output.FormatBioCXML)
+		default:
+			err := fmt.Errorf("output format %s is not supported with %s input (allowed: %s, %s and the line formats)",
+				format.Name, inputBioC, output.FormatBioCJSON, output.FormatBioCXML)
+			logger.Err(err).Int("status", http.StatusBadRequest).Msg("Output format is not correct")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	default:
+		logger.Err(nil).Int("status", http.StatusBadRequest).Str("input", input).Msg("Input format is not correct")
+		http.Error(w, fmt.Sprintf("unknown input format %q", input), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", format.ContentType)
+
 	request := pipeline.Request{
-		Tid:  "test_api",
-		Text: string(msg),
+		Tid:     "test_api",
+		Text:    string(msg),
+		Vocabs:  vocabs,
+		Format:  format.Name,
+		Version: version,
 	}
 	logger.Info().Str("tid", request.Tid).Msg("Starting pipeline for request from API")
-	resp := <-req.Pipeline(request)
+	resp, ok := <-req.Pipeline(request)
+	if !ok {
+		logger.Error().Int("status", http.StatusInternalServerError).Msg("Pipeline returned no response")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
 	_, _ = w.Write([]byte(resp))
 	logger.Info().Int("status", http.StatusOK).Msg("Finished processing request")
 }
+
+func getRequestVocabParams(query url.Values) ([]pipeline.RequestVocabParams, error) {
+	var result []pipeline.RequestVocabParams
+	for key, values := range query {
+		name, isOverlapResolution := "", key == overlapResolutionParam
+		if !isOverlapResolution {
+			name = strings.TrimPrefix(key, overlapResolutionParam+".")
+			isOverlapResolution = name != key && len(name) > 0
+		}
+		if !isOverlapResolution || len(values) == 0 {
+			continue
+		}
+		value := values[len(values)-1]
+		if _, err := lookup.ParseOverlapStrategy(value); err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		result = append(result, pipeline.RequestVocabParams{
+			Name:   name,
+			Params: types.RequestParams{OverlapResolution: value},
+		})
+	}
+	return result, nil
+}
+
+// processBioC runs the pipeline for every document of the BioC collection and adds the found annotations
+// to the passages of the document, the collection is returned as XML or JSON
+func (req *Request) processBioC(w http.ResponseWriter, logger zerolog.Logger, msg []byte, vocabs []pipeline.RequestVocabParams,
+	isXML bool) {
+	collection, err := output.ParseBioC(msg)
+	if err != nil {
+		logger.Err(err).Int("status", http.StatusBadRequest).Msg("Could not parse BioC collection")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for i := range collection.Documents {
+		document := &collection.Documents[i]
+		request := pipeline.Request{
+			Tid:    document.ID,
+			Text:   document.GetText(),
+			Vocabs: vocabs,
+			Format: output.FormatBioCJSON,
+		}
+		resp, ok := <-req.Pipeline(request)
+		predicted, err := output.ParseBioC([]byte(resp))
+		if !ok || err != nil || len(predicted.Documents) != 1 {
+			logger.Err(err).Int("status", http.StatusInternalServerError).Str("document_id", document.ID).
+				Msg("Could not read pipeline response")
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		output.MergeBioCDocument(document, predicted.Documents[0])
+	}
+
+	buf, err := output.MarshalBioC(collection, isXML)
+	if err != nil {
+		logger.Err(err).Int("status", http.StatusInternalServerError).Msg("Could not write BioC collection")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	if isXML {
+		w.Header().Set("Content-Type", "application/xml")
+	}
+	_, _ = w.Write(buf)
+	logger.Info().Int("status", http.StatusOK).Int("documents", len(collection.Documents)).Msg("Finished processing BioC collection")
+}
+
+// streamBioC runs the pipeline for every document of the BioC collection and streams the results in the line format,
+// the results of every document are flushed as soon as they are ready
+func (req *Request) streamBioC(w http.ResponseWriter, logger zerolog.Logger, msg []byte, vocabs []pipeline.RequestVocabParams,
+	format output.Format) {
+	collection, err := output.ParseBioC(msg)
+	if err != nil {
+		logger.Err(err).Int("status", http.StatusBadRequest).Msg("Could not parse BioC collection")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType)
+	flusher, _ := w.(http.Flusher)
+	for _, document := range collection.Documents {
+		request := pipeline.Request{
+			Tid:    document.ID,
+			Text:   document.GetText(),
+			Vocabs: vocabs,
+			Format: format.Name,
+		}
+		resp, ok := <-req.Pipeline(request)
+		if !ok {
+			logger.Error().Str("document_id", document.ID).Msg("Pipeline returned no response")
+			return
+		}
+		if _, err := w.Write([]byte(resp)); err != nil {
+			logger.Err(err).Str("document_id", document.ID).Msg("Could not write document results")
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	logger.Info().Int("status", http.StatusOK).Int("documents", len(collection.Documents)).Msg("Finished streaming BioC collection")
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"text2phenotype.com/fdl/output"
+	"text2phenotype.com/fdl/pipeline"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// createTestPipeline renders the document without annotations in the format of the request
+func createTestPipeline(t *testing.T) pipeline.Pipeline {
+	return func(request pipeline.Request) <-chan string {
+		result := make(chan string, 1)
+		format, err := request.GetFormat()
+		require.NoError(t, err)
+		buf, err := format.Render(output.Document{Tid: request.Tid, Text: request.Text, Results: map[string]interface{}{}})
+		require.NoError(t, err)
+		result <- string(buf)
+		return result
+	}
+}
+
+func TestProcessDataFormats(t *testing.T) {
+	req := &Request{Pipeline: createTestPipeline(t)}
+	bioc, err := output.GetFormat(output.FormatBioCJSON)
+	require.NoError(t, err)
+	buf, err := bioc.Render(output.Document{Tid: "doc1", Text: "chest pain"})
+	require.NoError(t, err)
+	collection := string(buf)
+
+	tests := []struct {
+		query       string
+		body        string
+		status      int
+		contentType string
+	}{
+		{query: "", body: "chest pain", status: http.StatusOK, contentType: "application/json"},
+		{query: "format=docx", body: "chest pain", status: http.StatusBadRequest},
+		{query: "version=3", body: "chest pain", status: http.StatusBadRequest},
+		{query: "format=fhir&version=2", body: "chest pain", status: http.StatusBadRequest},
+		{query: "input=bioc", body: collection, status: http.StatusOK, contentType: "application/json"},
+		{query: "input=bioc&format=bioc_xml", body: collection, status: http.StatusOK, contentType: "application/xml"},
+		{query: "input=bioc&format=jsonl", body: collection, status: http.StatusOK, contentType: "application/x-ndjson"},
+		{query: "input=bioc&format=docx", body: collection, status: http.StatusBadRequest},
+		{query: "input=bioc&format=fhir", body: collection, status: http.StatusBadRequest},
+		{query: "input=bioc&format=html", body: collection, status: http.StatusBadRequest},
+		{query: "input=bioc&format=xmi", body: collection, status: http.StatusBadRequest},
+		{query: "input=bioc&version=2", body: collection, status: http.StatusBadRequest},
+		{query: "input=bioc&format=jsonl&version=3", body: collection, status: http.StatusBadRequest},
+		{query: "input=brat", body: collection, status: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		req.ProcessData(recorder, httptest.NewRequest(http.MethodPost, "/?"+test.query, strings.NewReader(test.body)))
+		require.Equal(t, test.status, recorder.Code, test.query)
+		if len(test.contentType) > 0 {
+			require.Equal(t, test.contentType, recorder.Header().Get("Content-Type"), test.query)
+		}
+	}
+}
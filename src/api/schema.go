@@ -0,0 +1,39 @@
+package api
+
+import (
+	"text2phenotype.com/fdl/output"
+	"net/http"
+	"strings"
+)
+
+const SchemaPath = "/schema/"
+
+// schemas are the JSON Schemas of the typed response versions by path name
+var schemas = map[string]func() ([]byte, error){
+	"v2": output.ResponseV2Schema,
+}
+
+// ProcessSchema returns the JSON Schema of the response version: GET /schema/v2
+func ProcessSchema(w http.ResponseWriter, r *http.Request) {
+	logger := makeRequestLogger(r)
+
+	if r.Method != http.MethodGet {
+		logger.Err(nil).Int("status", http.StatusMethodNotAllowed).Msg("Only 'GET' method is allowed here")
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	create, ok := schemas[strings.Trim(strings.TrimPrefix(r.URL.Path, SchemaPath), "/")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	schema, err := create()
+	if err != nil {
+		logger.Err(err).Int("status", http.StatusInternalServerError).Msg("Could not create JSON schema")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	_, _ = w.Write(schema)
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"text2phenotype.com/fdl/lookup"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const UserDictionaryPath = "/admin/user-dictionary/"
+
+const reloadAction = "reload"
+
+const bearerPrefix = "Bearer "
+
+type userDictionaryInfo struct {
+	Config string `json:"config"`
+	Path   string `json:"path,omitempty"`
+	Terms  int    `json:"terms"`
+}
+
+type userDictionaryResponse struct {
+	userDictionaryInfo
+	UserTerms []lookup.UserTerm `json:"user_terms"`
+}
+
+type removedResponse struct {
+	Removed int `json:"removed"`
+}
+
+// UserDictionary manages user dictionaries of the configurations:
+//
+//	GET    /admin/user-dictionary/                   configurations and their term counts
+//	GET    /admin/user-dictionary/{config}           user terms
+//	POST   /admin/user-dictionary/{config}           add user terms, terms with the same CUI and text are replaced
+//	PUT    /admin/user-dictionary/{config}           replace all user terms
+//	DELETE /admin/user-dictionary/{config}?cui=&term= remove user terms of the CUI, all terms of the CUI if term is empty
+//	POST   /admin/user-dictionary/{config}/reload    reload the user dictionary file
+//
+// Only configurations with the user_dictionary file are available, updates of the user dictionary without the
+// file get 409. Requests have to be authorized by the "Authorization: Bearer {token}" header, all requests are rejected
+// if the token is empty.
+type UserDictionary struct {
+	Token string
+}
+
+// isAuthorized compares the bearer token of the request with the admin token in constant time
+func (ud *UserDictionary) isAuthorized(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	if len(ud.Token) == 0 || !strings.HasPrefix(header, bearerPrefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, bearerPrefix)), []byte(ud.Token)) == 1
+}
+
+func (ud *UserDictionary) ProcessRequest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	logger := makeRequestLogger(r)
+	if !ud.isAuthorized(r) {
+		logger.Err(nil).Int("status", http.StatusUnauthorized).Msg("Admin request is not authorized")
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, UserDictionaryPath), "/"), "/")
+	if len(parts[0]) == 0 {
+		if r.Method != http.MethodGet {
+			logger.Err(nil).Int("status", http.StatusMethodNotAllowed).Msg("Only 'GET' method is allowed here")
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		var infos []userDictionaryInfo
+		for _, name := range lookup.GetOverlayNames() {
+			overlay, err := lookup.GetOverlay(name)
+			if err == nil {
+				infos = append(infos, getUserDictionaryInfo(overlay))
+			}
+		}
+		writeJSON(w, http.StatusOK, infos)
+		return
+	}
+
+	overlay, err := lookup.GetOverlay(parts[0])
+	if err != nil {
+		logger.Err(err).Int("status", http.StatusNotFound).Msg("")
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// updates of the user dictionary without the file would be lost on restart
+	if len(overlay.Path()) == 0 && r.Method != http.MethodGet {
+		logger.Err(nil).Int("status", http.StatusConflict).Msg("User dictionary of the configuration has no file")
+		http.Error(w, "user dictionary of the configuration has no file", http.StatusConflict)
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == reloadAction && r.Method == http.MethodPost {
+		if err := overlay.Reload(); err != nil {
+			status := http.StatusBadRequest
+			if os.IsNotExist(err) {
+				status = http.StatusNotFound
+			}
+			logger.Err(err).Int("status", status).Msg("Could not reload user dictionary")
+			http.Error(w, err.Error(), status)
+			return
+		}
+		writeJSON(w, http.StatusOK, getUserDictionaryInfo(overlay))
+		return
+	}
+	if len(parts) != 1 {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, userDictionaryResponse{
+			userDictionaryInfo: getUserDictionaryInfo(overlay),
+			UserTerms:          overlay.Terms(),
+		})
+	case http.MethodPost, http.MethodPut:
+		var terms []lookup.UserTerm
+		if err := json.NewDecoder(r.Body).Decode(&terms); err != nil {
+			logger.Err(err).Int("status", http.StatusBadRequest).Msg("Could not parse user terms")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		update := overlay.Add
+		if r.Method == http.MethodPut {
+			update = overlay.Replace
+		}
+		if err := update(terms); err != nil {
+			logger.Err(err).Int("status", http.StatusBadRequest).Msg("Could not update user dictionary")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		logger.Info().Str("config_name", parts[0]).Int("terms", len(terms)).Msg("User dictionary was updated")
+		writeJSON(w, http.StatusOK, getUserDictionaryInfo(overlay))
+	case http.MethodDelete:
+		cui := r.URL.Query().Get("cui")
+		if len(cui) == 0 {
+			http.Error(w, "cui is required", http.StatusBadRequest)
+			return
+		}
+		removed, err := overlay.Remove(cui, r.URL.Query().Get("term"))
+		if err != nil {
+			logger.Err(err).Int("status", http.StatusInternalServerError).Msg("Could not update user dictionary")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, removedResponse{Removed: removed})
+	default:
+		logger.Err(nil).Int("status", http.StatusMethodNotAllowed).Msg("Method is not allowed")
+		http.Error(w, "", http.StatusMethodNotAllowed)
+	}
+}
+
+func getUserDictionaryInfo(overlay *lookup.Overlay) userDictionaryInfo {
+	return userDictionaryInfo{
+		Config: overlay.ConfigName(),
+		Path:   overlay.Path(),
+		Terms:  len(overlay.Terms()),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
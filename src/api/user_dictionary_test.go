@@ -0,0 +1,140 @@
+package api
+
+import (
+	"text2phenotype.com/fdl/lookup"
+	"text2phenotype.com/fdl/types"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testAdminToken = "secret"
+
+func createTestOverlay(t *testing.T) *lookup.Overlay {
+	path := filepath.Join(t.TempDir(), "user.bsv")
+	require.NoError(t, os.WriteFile(path, []byte("C0010055|T061|PT|CABG|LOCAL|CABG x3|Coronary artery bypass graft\n"), 0644))
+
+	casePolicy, err := lookup.NewCasePolicy(types.FDLConfig{})
+	require.NoError(t, err)
+	analyzer, err := lookup.NewTermAnalyzer(types.TermTokenizerRegex, nil, nil)
+	require.NoError(t, err)
+	overlay, err := lookup.NewOverlay("api_test", path, casePolicy, analyzer)
+	require.NoError(t, err)
+	lookup.RegisterOverlay(overlay)
+	return overlay
+}
+
+func serveUserDictionary(ud *UserDictionary, method string, target string, body string, token string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	if len(token) > 0 {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	ud.ProcessRequest(recorder, request)
+	return recorder
+}
+
+func TestUserDictionaryAuthorization(t *testing.T) {
+	overlay := createTestOverlay(t)
+	path := UserDictionaryPath + "api_test"
+	body := `[{"cui": "C0000002", "tui": "T121", "term": "Zeltrix"}]`
+
+	tests := []struct {
+		name  string
+		ud    *UserDictionary
+		token string
+	}{
+		{name: "no token", ud: &UserDictionary{Token: testAdminToken}},
+		{name: "wrong token", ud: &UserDictionary{Token: testAdminToken}, token: "wrong"},
+		{name: "token is not configured", ud: &UserDictionary{}, token: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete} {
+				resp := serveUserDictionary(test.ud, method, path+"?cui=C0010055", body, test.token)
+				require.Equal(t, http.StatusUnauthorized, resp.Code, method)
+			}
+			require.Len(t, overlay.Terms(), 1)
+		})
+	}
+
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	request.Header.Set("Authorization", "Basic "+testAdminToken)
+	recorder := httptest.NewRecorder()
+	(&UserDictionary{Token: testAdminToken}).ProcessRequest(recorder, request)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestUserDictionaryProcessRequest(t *testing.T) {
+	overlay := createTestOverlay(t)
+	ud := &UserDictionary{Token: testAdminToken}
+	path := UserDictionaryPath + "api_test"
+
+	resp := serveUserDictionary(ud, http.MethodGet, UserDictionaryPath, "", testAdminToken)
+	require.Equal(t, http.StatusOK, resp.Code)
+	var infos []userDictionaryInfo
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &infos))
+	require.Contains(t, infos, userDictionaryInfo{Config: "api_test", Path: overlay.Path(), Terms: 1})
+
+	resp = serveUserDictionary(ud, http.MethodPost, path, `[{"cui": "C0000002", "tui": "T121", "term": "Zeltrix"}]`, testAdminToken)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Len(t, overlay.Terms(), 2)
+
+	resp = serveUserDictionary(ud, http.MethodGet, path, "", testAdminToken)
+	require.Equal(t, http.StatusOK, resp.Code)
+	var terms userDictionaryResponse
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &terms))
+	require.Len(t, terms.UserTerms, 2)
+
+	resp = serveUserDictionary(ud, http.MethodPost, path, `[{"cui": "C0000003", "term": "no tui"}]`, testAdminToken)
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+	resp = serveUserDictionary(ud, http.MethodPost, path, `not json`, testAdminToken)
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+
+	resp = serveUserDictionary(ud, http.MethodDelete, path, "", testAdminToken)
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+	resp = serveUserDictionary(ud, http.MethodDelete, path+"?cui=C0000002", "", testAdminToken)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.JSONEq(t, `{"removed": 1}`, resp.Body.String())
+
+	resp = serveUserDictionary(ud, http.MethodPut, path, `[]`, testAdminToken)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Empty(t, overlay.Terms())
+
+	resp = serveUserDictionary(ud, http.MethodPost, path+"/reload", "", testAdminToken)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	resp = serveUserDictionary(ud, http.MethodGet, UserDictionaryPath+"unknown", "", testAdminToken)
+	require.Equal(t, http.StatusNotFound, resp.Code)
+	resp = serveUserDictionary(ud, http.MethodPatch, path, "", testAdminToken)
+	require.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+}
+
+func TestUserDictionaryWithoutFile(t *testing.T) {
+	casePolicy, err := lookup.NewCasePolicy(types.FDLConfig{})
+	require.NoError(t, err)
+	analyzer, err := lookup.NewTermAnalyzer(types.TermTokenizerRegex, nil, nil)
+	require.NoError(t, err)
+	overlay, err := lookup.NewOverlay("api_test_no_file", "", casePolicy, analyzer)
+	require.NoError(t, err)
+	lookup.RegisterOverlay(overlay)
+
+	ud := &UserDictionary{Token: testAdminToken}
+	path := UserDictionaryPath + "api_test_no_file"
+	body := `[{"cui": "C0000002", "tui": "T121", "term": "Zeltrix"}]`
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodDelete} {
+		resp := serveUserDictionary(ud, method, path+"?cui=C0010055", body, testAdminToken)
+		require.Equal(t, http.StatusConflict, resp.Code, method)
+	}
+	resp := serveUserDictionary(ud, http.MethodPost, path+"/reload", "", testAdminToken)
+	require.Equal(t, http.StatusConflict, resp.Code)
+	require.Empty(t, overlay.Terms())
+
+	resp = serveUserDictionary(ud, http.MethodGet, path, "", testAdminToken)
+	require.Equal(t, http.StatusOK, resp.Code)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"text2phenotype.com/fdl/logger"
+	"text2phenotype.com/fdl/output"
+	"text2phenotype.com/fdl/pipeline"
+	"text2phenotype.com/fdl/types"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/kelseyhightower/envconfig"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const batchCommand = "batch"
+
+const batchUsage = `Usage: fdl batch -in <dir> -out <dir> [-format <format>] [-ext <extension>] [-combine <file>]
+
+Annotates the text files of the input directory with the configurations of FDL_CONFIG_PATH and writes
+<name><format extension> files to the output directory. Formats which refer to the text by offsets (brat)
+also get the <name>.txt text file, formats split by configuration (conll_configs) write <name>.<configuration>
+files. Results of the line formats (jsonl) can be streamed to one file.
+
+Flags:
+`
+
+// runBatchCommand annotates the files of a directory and returns the exit code
+func runBatchCommand(args []string) int {
+	fdlLogger := logger.NewLogger("Batch")
+
+	flags := flag.NewFlagSet("fdl batch", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), batchUsage)
+		flags.PrintDefaults()
+	}
+	inDir := flags.String("in", "", "directory with the text files")
+	outDir := flags.String("out", "", "output directory, created if it doesn't exist")
+	formatName := flags.String("format", output.FormatJSON, "output format: "+strings.Join(output.GetFormatNames(), ", "))
+	extension := flags.String("ext", ".txt", "extension of the text files")
+	version := flags.String("version", "", "version of the json results: 1 (default) or 2")
+	combine := flags.String("combine", "", "append the results of all files to this file of the output directory")
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if len(*inDir) == 0 || len(*outDir) == 0 {
+		fmt.Fprintln(os.Stderr, "-in and -out are required")
+		flags.Usage()
+		return 2
+	}
+
+	format, err := output.GetFormat(*formatName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if _, err := output.WithVersion(format, *version); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(*combine) > 0 && !format.IsConcatenable {
+		fmt.Fprintf(os.Stderr, "-combine is not supported by the %s format\n", format.Name)
+		return 2
+	}
+
+	var config Config
+	if err := envconfig.Process("", &config); err != nil {
+		fdlLogger.Err(err).Msg("Failed to read environment")
+		return 1
+	}
+
+	files, err := getBatchFiles(*inDir, *extension)
+	if err != nil {
+		fdlLogger.Err(err).Str("dir", *inDir).Msg("Failed to list input files")
+		return 1
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		fdlLogger.Err(err).Str("dir", *outDir).Msg("Failed to create output directory")
+		return 1
+	}
+
+	cfgs, err := types.LoadConfigurations(config.ConfigPath)
+	if err != nil {
+		fdlLogger.Err(err).Msg("Failed to load configurations")
+		return 1
+	}
+	ppln, err := createPipeline(config, cfgs)
+	if err != nil {
+		fdlLogger.Err(err).Msg("Failed to start default clinical pipeline")
+		return 1
+	}
+
+	var combined io.Writer
+	if len(*combine) > 0 {
+		combinedFile, err := os.Create(filepath.Join(*outDir, *combine))
+		if err != nil {
+			fdlLogger.Err(err).Str("file", *combine).Msg("Failed to create combined results file")
+			return 1
+		}
+		defer combinedFile.Close()
+		combined = combinedFile
+	}
+
+	failed := 0
+	for _, file := range files {
+		if err := annotateBatchFile(ppln, format, *version, file, *outDir, *extension, combined); err != nil {
+			fdlLogger.Err(err).Str("file", file).Msg("Failed to annotate file")
+			failed++
+		}
+	}
+	fmt.Fprintf(os.Stdout, "annotated %d of %d files in %s format\n", len(files)-failed, len(files), format.Name)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// getBatchFiles returns the sorted paths of the files with the extension in the directory
+func getBatchFiles(dir string, extension string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), extension) {
+			continue
+		}
+		result = append(result, filepath.Join(dir, entry.Name()))
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// annotateBatchFile writes the results of the file to the output directory, or appends them to the combined file if it's set
+func annotateBatchFile(ppln pipeline.Pipeline, format output.Format, version string, file string, outDir string, extension string, combined io.Writer) error {
+	text, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	name := strings.TrimSuffix(filepath.Base(file), extension)
+	resp, ok := <-ppln(pipeline.Request{Tid: name, Text: string(text), Format: format.Name, Version: version})
+	if !ok {
+		return errors.New("pipeline returned no response")
+	}
+	if combined != nil {
+		_, err := io.WriteString(combined, resp)
+		return err
+	}
+
+	if len(format.SplitExtension) > 0 {
+		parts := make(map[string]string)
+		if err := json.Unmarshal([]byte(resp), &parts); err != nil {
+			return err
+		}
+		for key, part := range parts {
+			if err := ioutil.WriteFile(filepath.Join(outDir, name+"."+key+format.SplitExtension), []byte(part), 0644); err != nil {
+				return err
+			}
+		}
+	} else if err := ioutil.WriteFile(filepath.Join(outDir, name+format.Extension), []byte(resp), 0644); err != nil {
+		return err
+	}
+	if !format.WithText {
+		return nil
+	}
+	textFile := filepath.Join(outDir, name+".txt")
+	if samePath(textFile, file) {
+		return nil
+	}
+	return ioutil.WriteFile(textFile, text, 0644)
+}
+
+func samePath(a string, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"text2phenotype.com/fdl/lemmatizer"
+	"text2phenotype.com/fdl/logger"
+	"text2phenotype.com/fdl/lookup"
+	"text2phenotype.com/fdl/pos"
+	"text2phenotype.com/fdl/types"
+	"text2phenotype.com/fdl/umls"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+const dictCommand = "dict"
+
+const dictUsage = `Usage: fdl dict <command> [flags]
+
+Commands:
+  build    build term and concept dictionaries from UMLS RRF files
+  stats    show term, concept, SAB/TTY/TUI and rare word distributions of a term dictionary
+  lookup   show which dictionary terms and CUIs a phrase hits and why
+  diff     compare two versions of a term dictionary
+
+Run "fdl dict <command> -h" for the command flags.
+`
+
+// runDictCommand runs dictionary maintenance commands and returns the exit code. The results are written to stdout,
+// the diagnostics are logged to stderr.
+func runDictCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, dictUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "build":
+		return runDictBuild(args[1:], os.Stdout)
+	case "stats":
+		return runDictStats(args[1:], os.Stdout)
+	case "lookup":
+		return runDictLookup(args[1:], os.Stdout)
+	case "diff":
+		return runDictDiff(args[1:], os.Stdout)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(os.Stdout, dictUsage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown dict command %q\n\n%s", args[0], dictUsage)
+		return 2
+	}
+}
+
+func runDictBuild(args []string, out io.Writer) int {
+	fdlLogger := logger.NewLogger("Dictionary builder")
+
+	flags := flag.NewFlagSet("fdl dict build", flag.ContinueOnError)
+	metaDir := flags.String("meta", "", "directory with MRCONSO.RRF, MRSTY.RRF and optional MRSAT.RRF")
+	outDir := flags.String("out", "", "output directory, usually a subdirectory of FDL_DICTIONARY_PATH")
+	name := flags.String("name", "", "base name of the dictionary files, <name>.bsv and <name>_concepts.bsv are written")
+	sabs := flags.String("sab", "", "comma separated source vocabularies (SAB) to keep, all sources by default")
+	ttys := flags.String("tty", "", "comma separated term types (TTY) to keep, all term types by default")
+	languages := flags.String("lang", umls.DefaultLanguage, "comma separated languages (LAT) to keep")
+	suppress := flags.String("suppress", umls.DefaultSuppress, "comma separated allowed SUPPRESS values (N, O, E, Y)")
+	attributes := flags.String("attribute", "", "comma separated MRSAT filters in ATN or ATN=ATV form, MRSAT.RRF is read only if set")
+	skipIndex := flags.Bool("skip-index", false, "do not build the binary index cache")
+	if code, ok := parseDictFlags(flags, args); !ok {
+		return code
+	}
+
+	params := umls.BuildParams{
+		MetaDir:    *metaDir,
+		OutDir:     *outDir,
+		Name:       *name,
+		SABs:       splitList(*sabs),
+		TTYs:       splitList(*ttys),
+		Languages:  splitList(*languages),
+		Suppress:   splitList(*suppress),
+		Attributes: splitList(*attributes),
+	}
+
+	result, err := umls.Build(params)
+	if err != nil {
+		fdlLogger.Err(err).Msg("Failed to build dictionary")
+		return 1
+	}
+
+	if !*skipIndex {
+		if err := buildDictionaryIndexes(*name, result.TermPath, result.ConceptPath); err != nil {
+			fdlLogger.Err(err).Msg("Failed to build index cache")
+			return 1
+		}
+	}
+
+	fmt.Fprintf(out, "term dictionary: %s (%d terms)\n", result.TermPath, result.Terms)
+	fmt.Fprintf(out, "concept dictionary: %s (%d concepts)\n", result.ConceptPath, result.Concepts)
+	fmt.Fprintf(out, "scheme: %s\n", strings.Join(umls.DictionaryScheme, "|"))
+	return 0
+}
+
+// buildDictionaryIndexes builds the index cache for the default case sensitivity, term tokenizer and the concept_params_ignore: [STR]
+// used by the configurations, indexes for other parameters are built on the first start.
+func buildDictionaryIndexes(name string, termPath string, conceptPath string) error {
+	casePolicy, err := lookup.NewCasePolicy(types.FDLConfig{})
+	if err != nil {
+		return err
+	}
+
+	analyzer, err := lookup.NewTermAnalyzer(types.TermTokenizerRegex, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	registry := lookup.NewRegistry()
+	_, releaseDict, err := registry.AcquireDictionary(name, termPath, umls.DictionaryScheme, casePolicy, analyzer, lookup.FuzzyParams{})
+	if err != nil {
+		return err
+	}
+	defer releaseDict()
+
+	_, releaseFactory, err := registry.AcquireConceptFactory(name, conceptPath, umls.DictionaryScheme, []string{types.STR})
+	if err != nil {
+		return err
+	}
+	defer releaseFactory()
+
+	return nil
+}
+
+// dictionaryFlags are the term dictionary parameters shared by the inspection commands
+type dictionaryFlags struct {
+	path                   *string
+	scheme                 *string
+	caseSensitivity        *string
+	caseSensitiveMaxLength *int
+	fuzzyMaxDistance       *int
+	termTokenizer          *string
+	posModel               *string
+	lemmatizerDir          *string
+}
+
+func addDictionaryFlags(flags *flag.FlagSet) dictionaryFlags {
+	return dictionaryFlags{
+		path:                   flags.String("dict", "", "term dictionary BSV path"),
+		scheme:                 flags.String("scheme", strings.Join(umls.DictionaryScheme, "|"), "term dictionary scheme"),
+		caseSensitivity:        flags.String("case", types.CaseInsensitive, "case sensitivity (insensitive, short_acronyms, exact)"),
+		caseSensitiveMaxLength: flags.Int("case-max-length", 0, "max length of case sensitive acronyms"),
+		fuzzyMaxDistance:       flags.Int("fuzzy", 0, "max edit distance of fuzzy lookup, 0 disables fuzzy lookup"),
+		termTokenizer:          flags.String("tokenizer", types.TermTokenizerRegex, "term tokenizer (regex, ptb)"),
+		posModel: flags.String("pos-model", path.Join(os.Getenv("FDL_DIR_PATH"), "resources", "pos", "pos.model.json"),
+			"POS model, used by the ptb term tokenizer"),
+		lemmatizerDir: flags.String("lemmatizer", path.Join(os.Getenv("FDL_DIR_PATH"), "resources", "lemmatizer"),
+			"lemmatizer resources directory, used by the ptb term tokenizer"),
+	}
+}
+
+func (dictFlags dictionaryFlags) getAnalyzer() (lookup.TermAnalyzer, error) {
+	var tag lookup.TermTagger
+	var lemmatize lemmatizer.MorphologicalAnalyzer
+	if *dictFlags.termTokenizer == types.TermTokenizerPTB {
+		posModel, err := pos.LoadModelFromFile(*dictFlags.posModel)
+		if err != nil {
+			return lookup.TermAnalyzer{}, err
+		}
+		tag = pos.NewTagger(posModel)
+		if lemmatize, err = lemmatizer.LoadMorphologicalAnalyzer(*dictFlags.lemmatizerDir); err != nil {
+			return lookup.TermAnalyzer{}, err
+		}
+	}
+	return lookup.NewTermAnalyzer(*dictFlags.termTokenizer, tag, lemmatize)
+}
+
+func (dictFlags dictionaryFlags) getScheme() []string {
+	return strings.Split(*dictFlags.scheme, "|")
+}
+
+func (dictFlags dictionaryFlags) getConfig() types.FDLConfig {
+	return types.FDLConfig{
+		TermDictionary:         *dictFlags.path,
+		TermScheme:             *dictFlags.scheme,
+		CaseSensitivity:        *dictFlags.caseSensitivity,
+		CaseSensitiveMaxLength: *dictFlags.caseSensitiveMaxLength,
+		FuzzyMaxDistance:       *dictFlags.fuzzyMaxDistance,
+		TermTokenizer:          *dictFlags.termTokenizer,
+	}
+}
+
+func parseDictFlags(flags *flag.FlagSet, args []string) (int, bool) {
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0, false
+		}
+		return 2, false
+	}
+	return 0, true
+}
+
+func runDictStats(args []string, out io.Writer) int {
+	fdlLogger := logger.NewLogger("Dictionary stats")
+
+	flags := flag.NewFlagSet("fdl dict stats", flag.ContinueOnError)
+	dictFlags := addDictionaryFlags(flags)
+	top := flags.Int("top", 20, "count of the printed values of every distribution")
+	if code, ok := parseDictFlags(flags, args); !ok {
+		return code
+	}
+
+	casePolicy, err := lookup.NewCasePolicy(dictFlags.getConfig())
+	if err != nil {
+		fdlLogger.Err(err).Msg("Case sensitivity is not correct")
+		return 2
+	}
+
+	analyzer, err := dictFlags.getAnalyzer()
+	if err != nil {
+		fdlLogger.Err(err).Msg("Term tokenizer is not correct")
+		return 2
+	}
+
+	stats, err := lookup.ComputeDictionaryStats(*dictFlags.path, dictFlags.getScheme(), casePolicy, analyzer, *top)
+	if err != nil {
+		fdlLogger.Err(err).Str("path", *dictFlags.path).Msg("Failed to read dictionary")
+		return 1
+	}
+
+	fmt.Fprintf(out, "terms: %d\n", stats.Terms)
+	fmt.Fprintf(out, "concepts: %d\n", stats.Concepts)
+	printCounts(out, "SAB", stats.SABs, *top)
+	printCounts(out, "TTY", stats.TTYs, *top)
+	printCounts(out, "TUI", stats.TUIs, *top)
+
+	fmt.Fprintf(out, "rare words: %d\n", stats.RareWords)
+	printHistogram(out, "terms per rare word", stats.TermsPerRareWord)
+	printHistogram(out, "tokens per term", stats.TokensPerTerm)
+	printCounts(out, "rare words with the most terms", stats.TopRareWords, *top)
+	if analyzer.IsRuntime() {
+		printTokenizationReport(out, stats.Tokenization, *top)
+	}
+	return 0
+}
+
+func printTokenizationReport(out io.Writer, report lookup.TokenizationReport, top int) {
+	fmt.Fprintf(out, "terms tokenized differently by the runtime tokenizer: %d of %d\n", report.Changed, report.Terms)
+	for i, change := range report.Examples {
+		if top > 0 && i >= top {
+			fmt.Fprintf(out, "  ...\n")
+			break
+		}
+		fmt.Fprintf(out, "  %q: %s -> %s\n", change.Term, strings.Join(change.Regex, " | "), strings.Join(change.Runtime, " | "))
+	}
+}
+
+func printCounts(out io.Writer, title string, counts []lookup.ValueCount, top int) {
+	fmt.Fprintf(out, "%s (%d values):\n", title, len(counts))
+	for i, count := range counts {
+		if top > 0 && i >= top {
+			fmt.Fprintf(out, "  ...\n")
+			break
+		}
+		fmt.Fprintf(out, "  %-24s %d\n", count.Value, count.Count)
+	}
+}
+
+func printHistogram(out io.Writer, title string, histogram map[int]int) {
+	keys := make([]int, 0, len(histogram))
+	for key := range histogram {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+
+	fmt.Fprintf(out, "%s:\n", title)
+	for _, key := range keys {
+		fmt.Fprintf(out, "  %-6d %d\n", key, histogram[key])
+	}
+}
+
+func runDictLookup(args []string, out io.Writer) int {
+	fdlLogger := logger.NewLogger("Dictionary lookup")
+
+	flags := flag.NewFlagSet("fdl dict lookup", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: fdl dict lookup [flags] <phrase>\n")
+		flags.PrintDefaults()
+	}
+	dictFlags := addDictionaryFlags(flags)
+	if code, ok := parseDictFlags(flags, args); !ok {
+		return code
+	}
+	phrase := strings.Join(flags.Args(), " ")
+	if len(phrase) == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	cfg := dictFlags.getConfig()
+	casePolicy, err := lookup.NewCasePolicy(cfg)
+	if err != nil {
+		fdlLogger.Err(err).Msg("Case sensitivity is not correct")
+		return 2
+	}
+	fuzzyParams, err := lookup.NewFuzzyParams(cfg)
+	if err != nil {
+		fdlLogger.Err(err).Msg("Fuzzy lookup parameters are not correct")
+		return 2
+	}
+
+	analyzer, err := dictFlags.getAnalyzer()
+	if err != nil {
+		fdlLogger.Err(err).Msg("Term tokenizer is not correct")
+		return 2
+	}
+
+	dict, release, err := lookup.NewRegistry().AcquireDictionary("lookup", *dictFlags.path, dictFlags.getScheme(), casePolicy, analyzer, fuzzyParams)
+	if err != nil {
+		fdlLogger.Err(err).Str("path", *dictFlags.path).Msg("Failed to load dictionary")
+		return 1
+	}
+	defer release()
+
+	tokens, hits, err := lookup.ExplainLookup(dict, analyzer, phrase)
+	if err != nil {
+		fdlLogger.Err(err).Msg("Failed to look up the phrase")
+		return 1
+	}
+
+	fmt.Fprintf(out, "tokens: %s\n", strings.Join(tokens, " | "))
+	if len(hits) == 0 {
+		fmt.Fprintln(out, "no dictionary terms share a rare word with the phrase")
+		return 0
+	}
+
+	for _, hit := range hits {
+		status := "miss"
+		if hit.Matched {
+			status = fmt.Sprintf("hit [%d:%d]", hit.Begin, hit.End)
+		}
+		fmt.Fprintf(out, "%-12s %-10s %q rare word %q: %s\n", status, strings.ToUpper(hit.CUI), strings.Join(hit.Tokens, " "), hit.RareWord, hit.Reason)
+	}
+	return 0
+}
+
+func runDictDiff(args []string, out io.Writer) int {
+	fdlLogger := logger.NewLogger("Dictionary diff")
+
+	flags := flag.NewFlagSet("fdl dict diff", flag.ContinueOnError)
+	oldPath := flags.String("old", "", "previous version of the term dictionary")
+	newPath := flags.String("new", "", "new version of the term dictionary")
+	scheme := flags.String("scheme", strings.Join(umls.DictionaryScheme, "|"), "term dictionary scheme of both versions")
+	limit := flags.Int("limit", 50, "count of the printed values of every section, 0 prints all")
+	if code, ok := parseDictFlags(flags, args); !ok {
+		return code
+	}
+
+	diff, err := lookup.DiffDictionaries(*oldPath, *newPath, strings.Split(*scheme, "|"))
+	if err != nil {
+		fdlLogger.Err(err).Msg("Failed to compare dictionaries")
+		return 2
+	}
+
+	printValues(out, "added CUIs", diff.AddedCUIs, *limit)
+	printValues(out, "removed CUIs", diff.RemovedCUIs, *limit)
+	printValues(out, "changed CUIs", diff.ChangedCUIs, *limit)
+	printDiffTerms(out, "added terms", diff.AddedTerms, *limit)
+	printDiffTerms(out, "removed terms", diff.RemovedTerms, *limit)
+	printDiffTerms(out, "changed terms", diff.ChangedTerms, *limit)
+
+	// diff(1) convention, 1 means the dictionaries differ and 2 means trouble
+	if diff.IsEmpty() {
+		return 0
+	}
+	return 1
+}
+
+func printValues(out io.Writer, title string, values []string, limit int) {
+	fmt.Fprintf(out, "%s: %d\n", title, len(values))
+	for i, value := range values {
+		if limit > 0 && i >= limit {
+			fmt.Fprintf(out, "  ...\n")
+			break
+		}
+		fmt.Fprintf(out, "  %s\n", value)
+	}
+}
+
+func printDiffTerms(out io.Writer, title string, terms []lookup.DiffTerm, limit int) {
+	values := make([]string, len(terms))
+	for i, term := range terms {
+		values[i] = term.CUI + "|" + term.Term
+	}
+	printValues(out, title, values, limit)
+}
+
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) > 0 {
+			result = append(result, item)
+		}
+	}
+	return result
+}
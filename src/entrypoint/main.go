@@ -12,6 +12,7 @@ import (
 	"github.com/kelseyhightower/envconfig"
 	"net/http"
 	"os"
+	"path"
 	"time"
 )
 
@@ -21,21 +22,41 @@ type Config struct {
 	DirPath        string `envconfig:"FDL_DIR_PATH" required:"true"`
 	RestAPIActive  bool   `envconfig:"FDL_REST_API_ACTIVE" default:"false"`
 	RestAPIPort    string `envconfig:"FDL_REST_API_PORT" default:"10000"`
+	// admin API (user dictionaries) on the REST API port, requests need the bearer token
+	AdminAPIActive bool   `envconfig:"FDL_ADMIN_API_ACTIVE" default:"false"`
+	AdminAPIToken  string `envconfig:"FDL_ADMIN_API_TOKEN"`
+	// merged result of all configurations and the configurations which win the attribute conflicts
+	UnifiedResult   bool     `envconfig:"FDL_UNIFIED_RESULT" default:"false"`
+	UnifiedPriority []string `envconfig:"FDL_UNIFIED_PRIORITY"`
 }
 
 const pipelineStartMaxRetries = 5
 
 func main() {
 	logger.SetupLogging()
+	if len(os.Args) > 1 && os.Args[1] == dictCommand {
+		os.Exit(runDictCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == batchCommand {
+		os.Exit(runBatchCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == schemaCommand {
+		os.Exit(runSchemaCommand(os.Args[2:]))
+	}
+
 	fdlLogger := logger.NewLogger("Main")
 	fatalErrLogger := fdlLogger.Fatal().Caller()
-	buildIndex := flag.Bool("build-index", false, "a bool")
+	buildIndex := flag.Bool("build-index", false, "build binary term and concept indexes for all configurations and exit")
 	flag.Parse()
 	var config Config
 	if err := envconfig.Process("", &config); err != nil {
 		fatalErrLogger.Err(err).Msg("Failed to read environment")
 		os.Exit(1)
 	}
+	if config.AdminAPIActive && len(config.AdminAPIToken) == 0 {
+		fatalErrLogger.Msg("FDL_ADMIN_API_TOKEN is required when the admin API is active")
+		os.Exit(1)
+	}
 
 	// build config index
 	if *buildIndex {
@@ -44,13 +65,14 @@ func main() {
 			fdlLogger.Err(err).Msg("Failed to load configurations")
 			return
 		}
-		_, err = pipeline.CreateLookupConfigs(config.DictionaryPath, cfgs)
+		lookupCfgs, err := pipeline.CreateLookupConfigs(config.DictionaryPath, path.Join(config.DirPath, "resources"), cfgs)
 		if err != nil {
 			fatalErrLogger.Err(err).Msg("Failed to build config indexes cache")
 			os.Exit(1)
 		} else {
 			fdlLogger.Info().Msg("Configs indexes cache was built. Exit...")
 		}
+		pipeline.ReleaseLookupConfigs(lookupCfgs)
 		return
 	}
 
@@ -67,8 +89,7 @@ func main() {
 			fdlLogger.Info().Msgf("Loaded %d configurations", len(cfgs))
 			fdlLogger.Info().Msg("Starting pipelines loading")
 
-			pipelineParams := pipeline.GetDefaultClinicalParams(config.DirPath, config.DictionaryPath, cfgs)
-			ppln, err := pipeline.DefaultClinical(pipelineParams)
+			ppln, err := createPipeline(config, cfgs)
 			if err != nil {
 				fdlLogger.Err(err).Msg("Failed to start default clinical pipeline. Retrying in 5 sec")
 				time.Sleep(5 * time.Second)
@@ -93,6 +114,13 @@ func main() {
 				Pipeline: ppln,
 			}
 			http.HandleFunc("/", apiRequest.ProcessData)
+			http.HandleFunc(api.HTMLPath, apiRequest.ProcessHTML)
+			http.HandleFunc(api.SchemaPath, api.ProcessSchema)
+			if config.AdminAPIActive {
+				userDictionary := &api.UserDictionary{Token: config.AdminAPIToken}
+				http.HandleFunc(api.UserDictionaryPath, userDictionary.ProcessRequest)
+				fdlLogger.Info().Msg("Admin API is active")
+			}
 			host := fmt.Sprintf(":%s", config.RestAPIPort)
 			fdlLogger.Info().Msgf("REST API on %s", host)
 			err := http.ListenAndServe(host, nil)
@@ -114,3 +142,13 @@ func main() {
 		}
 	}
 }
+
+// createPipeline starts the default clinical pipeline of the configurations
+func createPipeline(config Config, cfgs []types.Configuration) (pipeline.Pipeline, error) {
+	pipelineParams := pipeline.GetDefaultClinicalParams(config.DirPath, config.DictionaryPath, cfgs)
+	pipelineParams.Unified = pipeline.UnifiedParams{
+		Enabled:  config.UnifiedResult,
+		Priority: config.UnifiedPriority,
+	}
+	return pipeline.DefaultClinical(pipelineParams)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"text2phenotype.com/fdl/output"
+	"fmt"
+	"os"
+)
+
+const schemaCommand = "schema"
+
+// runSchemaCommand prints the JSON Schema of the response version, resources/schema/response_v2.schema.json
+// is regenerated with "fdl schema v2 > resources/schema/response_v2.schema.json"
+func runSchemaCommand(args []string) int {
+	if len(args) != 1 || args[0] != "v2" {
+		fmt.Fprintln(os.Stderr, "Usage: fdl schema v2")
+		return 2
+	}
+	schema, err := output.ResponseV2Schema()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprintln(os.Stdout, string(schema))
+	return 0
+}
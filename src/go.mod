@@ -1,6 +1,6 @@
 module text2phenotype.com/fdl
 
-go 1.20
+go 1.22
 
 //
 require (
@@ -10,6 +10,7 @@ require (
 	github.com/go-redis/redis/v8 v8.11.0
 	github.com/google/go-cmp v0.5.6
 	github.com/kelseyhightower/envconfig v1.4.0
+	github.com/klauspost/compress v1.18.0
 	github.com/rs/zerolog v1.19.0
 	github.com/streadway/amqp v1.0.0
 	github.com/stretchr/testify v1.6.1
@@ -0,0 +1,882 @@
+package lookup
+
+import (
+	"bytes"
+	"text2phenotype.com/fdl/utils"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+)
+
+// Binary indexes are little endian files which are opened by memory mapping.
+//
+// Term index layout:
+//
+//	header       | magic [8]byte, version u32, string count u32, key count u32, term count u32,
+//	             | token count u32, reserved u32, strings/blob/keys/terms/tokens section offsets u64
+//	strings      | string count * (blob offset u32, length u32)
+//	blob         | string values
+//	keys         | key count * (rare word string id u32, first term u32, term count u32), sorted by rare word
+//	terms        | term count * (cui string id u32, text length u32, first token u32, token count u16,
+//	             | rare word index u8, flags u8)
+//	tokens       | token string ids u32, cased terms keep the ids of the cased tokens right after the tokens,
+//	             | terms with lemmas keep the lemma ids (noLemma if the token is its own lemma) after them
+//
+// Concept index layout:
+//
+//	header       | magic [8]byte, version u32, cui count u32, line count u32, reserved u32,
+//	             | cuis/lines/blob section offsets u64
+//	cuis         | cui count * (blob offset u32, length u32, first line u32, line count u32), sorted by cui
+//	lines        | line count * (blob offset u32, length u32)
+//	blob         | cui and line values
+//
+// Fuzzy index layout:
+//
+//	header       | magic [8]byte, version u32, max distance u32, min length u32, known count u32, delete count u32,
+//	             | rare word count u32, posting count u32, reserved u32, known/deletes/rare words/postings/blob
+//	             | section offsets u64
+//	known        | known count * (blob offset u32, length u32), sorted by word
+//	deletes      | delete count * (blob offset u32, length u32, first posting u32, posting count u32), sorted by delete
+//	rare words   | rare word count * (blob offset u32, length u32)
+//	postings     | rare word ids u32
+//	blob         | word, delete and rare word values
+const (
+	TermIndexVersion    uint32 = 2
+	ConceptIndexVersion uint32 = 1
+	FuzzyIndexVersion   uint32 = 1
+
+	TermIndexExt    = ".tidx"
+	ConceptIndexExt = ".cidx"
+	FuzzyIndexExt   = ".fidx"
+
+	termIndexHeaderSize    = 72
+	conceptIndexHeaderSize = 48
+	fuzzyIndexHeaderSize   = 80
+
+	stringEntrySize  = 8
+	keyEntrySize     = 12
+	termEntrySize    = 16
+	tokenEntrySize   = 4
+	cuiEntrySize     = 16
+	lineEntrySize    = 8
+	deleteEntrySize  = 16
+	postingEntrySize = 4
+	termFlagCaseSens = 1
+	termFlagLemmas   = 2
+
+	noLemma uint32 = 0xFFFFFFFF
+)
+
+var (
+	termIndexMagic    = [8]byte{'F', 'D', 'L', 'T', 'E', 'R', 'M', 'S'}
+	conceptIndexMagic = [8]byte{'F', 'D', 'L', 'C', 'O', 'N', 'C', 'P'}
+	fuzzyIndexMagic   = [8]byte{'F', 'D', 'L', 'F', 'U', 'Z', 'Z', 'Y'}
+
+	ErrIndexVersion = errors.New("index has unsupported format version")
+	ErrIndexFormat  = errors.New("index file is corrupted")
+)
+
+var byteOrder = binary.LittleEndian
+
+type termIndexHeader struct {
+	Magic         [8]byte
+	Version       uint32
+	StringCount   uint32
+	KeyCount      uint32
+	TermCount     uint32
+	TokenCount    uint32
+	Reserved      uint32
+	StringsOffset uint64
+	BlobOffset    uint64
+	KeysOffset    uint64
+	TermsOffset   uint64
+	TokensOffset  uint64
+}
+
+type conceptIndexHeader struct {
+	Magic       [8]byte
+	Version     uint32
+	CuiCount    uint32
+	LineCount   uint32
+	Reserved    uint32
+	CuisOffset  uint64
+	LinesOffset uint64
+	BlobOffset  uint64
+}
+
+type fuzzyIndexHeader struct {
+	Magic           [8]byte
+	Version         uint32
+	MaxDistance     uint32
+	MinLength       uint32
+	KnownCount      uint32
+	DeleteCount     uint32
+	RareWordCount   uint32
+	PostingCount    uint32
+	Reserved        uint32
+	KnownOffset     uint64
+	DeletesOffset   uint64
+	RareWordsOffset uint64
+	PostingsOffset  uint64
+	BlobOffset      uint64
+}
+
+// stringTable collects unique strings of the index
+type stringTable struct {
+	ids    map[string]uint32
+	values []string
+}
+
+func newStringTable() *stringTable {
+	return &stringTable{ids: make(map[string]uint32)}
+}
+
+func (table *stringTable) add(s string) uint32 {
+	id, ok := table.ids[s]
+	if !ok {
+		id = uint32(len(table.values))
+		table.ids[s] = id
+		table.values = append(table.values, s)
+	}
+	return id
+}
+
+func writeValues(buf *bytes.Buffer, values ...interface{}) {
+	for _, v := range values {
+		// writing into bytes.Buffer never fails
+		_ = binary.Write(buf, byteOrder, v)
+	}
+}
+
+// EncodeTermIndex serializes the terms into the binary term index
+func EncodeTermIndex(index TermIndex) ([]byte, error) {
+	strings := newStringTable()
+
+	type keyTerms struct {
+		rareWord string
+		terms    []*RareWordTerm
+	}
+	var keys []keyTerms
+	index.ForEach(func(rareWord *string, terms []*RareWordTerm) {
+		keys = append(keys, keyTerms{*rareWord, terms})
+	})
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].rareWord < keys[j].rareWord
+	})
+
+	var keysBuf, termsBuf, tokensBuf bytes.Buffer
+	termCount, tokenCount := uint32(0), uint32(0)
+	for _, key := range keys {
+		writeValues(&keysBuf, strings.add(key.rareWord), termCount, uint32(len(key.terms)))
+		for _, term := range key.terms {
+			if len(term.Tokens) > 0xFFFF {
+				return nil, fmt.Errorf("term has too many tokens: %d", len(term.Tokens))
+			}
+
+			var flags uint8
+			if term.IsCaseSensitive() {
+				flags |= termFlagCaseSens
+			}
+			if len(term.Lemmas) > 0 {
+				flags |= termFlagLemmas
+			}
+			writeValues(&termsBuf, strings.add(*term.CUI), term.TextLength, tokenCount, uint16(len(term.Tokens)), term.RareWordIndex, flags)
+			termCount++
+
+			for _, token := range term.Tokens {
+				writeValues(&tokensBuf, strings.add(*token))
+				tokenCount++
+			}
+			if term.IsCaseSensitive() {
+				for _, token := range term.CasedTokens {
+					writeValues(&tokensBuf, strings.add(token))
+					tokenCount++
+				}
+			}
+			if len(term.Lemmas) > 0 {
+				for i := range term.Tokens {
+					lemmaID := noLemma
+					if lemma := term.GetLemma(i); lemma != nil {
+						lemmaID = strings.add(*lemma)
+					}
+					writeValues(&tokensBuf, lemmaID)
+					tokenCount++
+				}
+			}
+		}
+	}
+
+	var stringsBuf, blobBuf bytes.Buffer
+	for _, s := range strings.values {
+		writeValues(&stringsBuf, uint32(blobBuf.Len()), uint32(len(s)))
+		blobBuf.WriteString(s)
+	}
+	if uint64(blobBuf.Len()) > 0xFFFFFFFF {
+		return nil, errors.New("term index strings are too large")
+	}
+
+	header := termIndexHeader{
+		Magic:       termIndexMagic,
+		Version:     TermIndexVersion,
+		StringCount: uint32(len(strings.values)),
+		KeyCount:    uint32(len(keys)),
+		TermCount:   termCount,
+		TokenCount:  tokenCount,
+	}
+	header.StringsOffset = termIndexHeaderSize
+	header.BlobOffset = header.StringsOffset + uint64(stringsBuf.Len())
+	header.KeysOffset = header.BlobOffset + uint64(blobBuf.Len())
+	header.TermsOffset = header.KeysOffset + uint64(keysBuf.Len())
+	header.TokensOffset = header.TermsOffset + uint64(termsBuf.Len())
+
+	var out bytes.Buffer
+	out.Grow(int(header.TokensOffset) + tokensBuf.Len())
+	writeValues(&out, header)
+	out.Write(stringsBuf.Bytes())
+	out.Write(blobBuf.Bytes())
+	out.Write(keysBuf.Bytes())
+	out.Write(termsBuf.Bytes())
+	out.Write(tokensBuf.Bytes())
+	return out.Bytes(), nil
+}
+
+// termCacheSize is the number of slots of the decoded terms cache of BinaryTermIndex
+const termCacheSize = 4096
+
+// cachedTerms are the decoded terms of the rare word with index key
+type cachedTerms struct {
+	key   uint32
+	terms []*RareWordTerm
+}
+
+// BinaryTermIndex is TermIndex over the encoded (usually memory mapped) term index.
+// Terms are decoded on demand and kept in a direct-mapped cache of termCacheSize rare words, so the frequent rare
+// words are decoded once and the memory of the decoded terms stays bounded.
+type BinaryTermIndex struct {
+	data   []byte
+	header termIndexHeader
+	file   *utils.MappedFile
+	cache  []atomic.Pointer[cachedTerms]
+}
+
+func NewBinaryTermIndex(data []byte) (*BinaryTermIndex, error) {
+	var header termIndexHeader
+	if len(data) < termIndexHeaderSize {
+		return nil, ErrIndexFormat
+	}
+	if err := binary.Read(bytes.NewReader(data[:termIndexHeaderSize]), byteOrder, &header); err != nil {
+		return nil, err
+	}
+	if header.Magic != termIndexMagic {
+		return nil, ErrIndexFormat
+	}
+	if header.Version != TermIndexVersion {
+		return nil, ErrIndexVersion
+	}
+	index := &BinaryTermIndex{data: data, header: header, cache: make([]atomic.Pointer[cachedTerms], termCacheSize)}
+	if !index.isValid() {
+		return nil, ErrIndexFormat
+	}
+	return index, nil
+}
+
+// isSection checks that the section of count entries lies between offset and the next section offset
+func isSection(offset uint64, count uint32, entrySize uint64, next uint64) bool {
+	return offset <= next && uint64(count)*entrySize <= next-offset
+}
+
+// isValid checks the section bounds of the header and every entry of the sections, so the lookup never reads
+// outside of the data of a truncated or corrupted index
+func (index *BinaryTermIndex) isValid() bool {
+	header := index.header
+	size := uint64(len(index.data))
+	if header.StringsOffset < termIndexHeaderSize || header.BlobOffset > size || header.KeysOffset > size ||
+		header.TermsOffset > size || header.TokensOffset > size {
+		return false
+	}
+	if !isSection(header.StringsOffset, header.StringCount, stringEntrySize, header.BlobOffset) ||
+		header.BlobOffset > header.KeysOffset ||
+		!isSection(header.KeysOffset, header.KeyCount, keyEntrySize, header.TermsOffset) ||
+		!isSection(header.TermsOffset, header.TermCount, termEntrySize, header.TokensOffset) ||
+		!isSection(header.TokensOffset, header.TokenCount, tokenEntrySize, size) {
+		return false
+	}
+
+	blobSize := header.KeysOffset - header.BlobOffset
+	for i := uint64(0); i < uint64(header.StringCount); i++ {
+		entry := header.StringsOffset + i*stringEntrySize
+		if uint64(index.u32(entry))+uint64(index.u32(entry+4)) > blobSize {
+			return false
+		}
+	}
+	isString := func(id uint32) bool {
+		return id < header.StringCount
+	}
+	for i := uint64(0); i < uint64(header.KeyCount); i++ {
+		entry := header.KeysOffset + i*keyEntrySize
+		if !isString(index.u32(entry)) || uint64(index.u32(entry+4))+uint64(index.u32(entry+8)) > uint64(header.TermCount) {
+			return false
+		}
+	}
+	for i := uint64(0); i < uint64(header.TermCount); i++ {
+		entry := header.TermsOffset + i*termEntrySize
+		firstToken := uint64(index.u32(entry + 8))
+		tokenCount := uint64(byteOrder.Uint16(index.data[entry+12 : entry+14]))
+		flags := index.data[entry+15]
+		if !isString(index.u32(entry)) || uint64(index.data[entry+14]) >= tokenCount {
+			return false
+		}
+		slots := tokenCount
+		if flags&termFlagCaseSens != 0 {
+			slots += tokenCount
+		}
+		lemmasOffset := firstToken + slots
+		if flags&termFlagLemmas != 0 {
+			slots += tokenCount
+		}
+		if firstToken+slots > uint64(header.TokenCount) {
+			return false
+		}
+		for t := firstToken; t < firstToken+slots; t++ {
+			id := index.u32(header.TokensOffset + t*tokenEntrySize)
+			if !isString(id) && (t < lemmasOffset || id != noLemma) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func OpenTermIndex(path string) (*BinaryTermIndex, error) {
+	file, err := utils.OpenMappedFile(path)
+	if err != nil {
+		return nil, err
+	}
+	index, err := NewBinaryTermIndex(file.Bytes())
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	index.file = file
+	return index, nil
+}
+
+func (index *BinaryTermIndex) Close() error {
+	if index.file == nil {
+		return nil
+	}
+	return index.file.Close()
+}
+
+func (index *BinaryTermIndex) u32(offset uint64) uint32 {
+	return byteOrder.Uint32(index.data[offset : offset+4])
+}
+
+func (index *BinaryTermIndex) stringBytes(id uint32) []byte {
+	entry := index.header.StringsOffset + uint64(id)*stringEntrySize
+	offset := index.header.BlobOffset + uint64(index.u32(entry))
+	return index.data[offset : offset+uint64(index.u32(entry+4))]
+}
+
+// stringPointer reuses the interned pointer if the string store already has the string, the locked store doesn't
+// keep the new strings
+func (index *BinaryTermIndex) stringPointer(id uint32) *string {
+	return utils.GlobalStringStore().GetPointer(string(index.stringBytes(id)))
+}
+
+func (index *BinaryTermIndex) findKey(rareWord string) (uint64, bool) {
+	keyCount := int(index.header.KeyCount)
+	i := sort.Search(keyCount, func(i int) bool {
+		entry := index.header.KeysOffset + uint64(i)*keyEntrySize
+		return string(index.stringBytes(index.u32(entry))) >= rareWord
+	})
+	if i >= keyCount {
+		return 0, false
+	}
+	entry := index.header.KeysOffset + uint64(i)*keyEntrySize
+	if string(index.stringBytes(index.u32(entry))) != rareWord {
+		return 0, false
+	}
+	return entry, true
+}
+
+func (index *BinaryTermIndex) readTerms(keyEntry uint64) []*RareWordTerm {
+	firstTerm := uint64(index.u32(keyEntry + 4))
+	termCount := uint64(index.u32(keyEntry + 8))
+
+	terms := make([]*RareWordTerm, termCount)
+	for i := uint64(0); i < termCount; i++ {
+		entry := index.header.TermsOffset + (firstTerm+i)*termEntrySize
+		firstToken := uint64(index.u32(entry + 8))
+		tokenCount := uint64(byteOrder.Uint16(index.data[entry+12 : entry+14]))
+		flags := index.data[entry+15]
+
+		term := RareWordTerm{
+			CUI:           index.stringPointer(index.u32(entry)),
+			TextLength:    index.u32(entry + 4),
+			RareWordIndex: index.data[entry+14],
+			Tokens:        make([]*string, tokenCount),
+		}
+		for t := uint64(0); t < tokenCount; t++ {
+			term.Tokens[t] = index.stringPointer(index.u32(index.header.TokensOffset + (firstToken+t)*tokenEntrySize))
+		}
+		lemmasOffset := firstToken + tokenCount
+		if flags&termFlagCaseSens != 0 {
+			term.CasedTokens = make([]string, tokenCount)
+			for t := uint64(0); t < tokenCount; t++ {
+				id := index.u32(index.header.TokensOffset + (firstToken+tokenCount+t)*tokenEntrySize)
+				term.CasedTokens[t] = string(index.stringBytes(id))
+			}
+			lemmasOffset += tokenCount
+		}
+		if flags&termFlagLemmas != 0 {
+			term.Lemmas = make([]*string, tokenCount)
+			for t := uint64(0); t < tokenCount; t++ {
+				if id := index.u32(index.header.TokensOffset + (lemmasOffset+t)*tokenEntrySize); id != noLemma {
+					term.Lemmas[t] = index.stringPointer(id)
+				}
+			}
+		}
+		terms[i] = &term
+	}
+	return terms
+}
+
+func (index *BinaryTermIndex) Terms(rareWord *string) []*RareWordTerm {
+	if rareWord == nil {
+		return nil
+	}
+	keyEntry, ok := index.findKey(*rareWord)
+	if !ok {
+		return nil
+	}
+	key := uint32((keyEntry - index.header.KeysOffset) / keyEntrySize)
+	slot := &index.cache[key%termCacheSize]
+	if cached := slot.Load(); cached != nil && cached.key == key {
+		return cached.terms
+	}
+	terms := index.readTerms(keyEntry)
+	slot.Store(&cachedTerms{key: key, terms: terms})
+	return terms
+}
+
+func (index *BinaryTermIndex) ForEach(f func(rareWord *string, terms []*RareWordTerm)) {
+	for i := uint64(0); i < uint64(index.header.KeyCount); i++ {
+		entry := index.header.KeysOffset + i*keyEntrySize
+		f(index.stringPointer(index.u32(entry)), index.readTerms(entry))
+	}
+}
+
+func (index *BinaryTermIndex) Len() int {
+	return int(index.header.KeyCount)
+}
+
+// Size returns size of the encoded index in bytes
+func (index *BinaryTermIndex) Size() int {
+	return len(index.data)
+}
+
+// EncodeConceptIndex serializes lines of the concept dictionary grouped by CUI
+func EncodeConceptIndex(conceptLines map[string][]string) ([]byte, error) {
+	cuis := make([]string, 0, len(conceptLines))
+	for cui := range conceptLines {
+		cuis = append(cuis, cui)
+	}
+	sort.Strings(cuis)
+
+	var cuisBuf, linesBuf, blobBuf bytes.Buffer
+	lineCount := uint32(0)
+	for _, cui := range cuis {
+		lines := conceptLines[cui]
+		writeValues(&cuisBuf, uint32(blobBuf.Len()), uint32(len(cui)), lineCount, uint32(len(lines)))
+		blobBuf.WriteString(cui)
+		for _, line := range lines {
+			writeValues(&linesBuf, uint32(blobBuf.Len()), uint32(len(line)))
+			blobBuf.WriteString(line)
+			lineCount++
+		}
+	}
+	if uint64(blobBuf.Len()) > 0xFFFFFFFF {
+		return nil, errors.New("concept index is too large")
+	}
+
+	header := conceptIndexHeader{
+		Magic:     conceptIndexMagic,
+		Version:   ConceptIndexVersion,
+		CuiCount:  uint32(len(cuis)),
+		LineCount: lineCount,
+	}
+	header.CuisOffset = conceptIndexHeaderSize
+	header.LinesOffset = header.CuisOffset + uint64(cuisBuf.Len())
+	header.BlobOffset = header.LinesOffset + uint64(linesBuf.Len())
+
+	var out bytes.Buffer
+	out.Grow(int(header.BlobOffset) + blobBuf.Len())
+	writeValues(&out, header)
+	out.Write(cuisBuf.Bytes())
+	out.Write(linesBuf.Bytes())
+	out.Write(blobBuf.Bytes())
+	return out.Bytes(), nil
+}
+
+// BinaryConceptIndex gives access to the encoded (usually memory mapped) concept dictionary lines
+type BinaryConceptIndex struct {
+	data   []byte
+	header conceptIndexHeader
+	file   *utils.MappedFile
+}
+
+func NewBinaryConceptIndex(data []byte) (*BinaryConceptIndex, error) {
+	var header conceptIndexHeader
+	if len(data) < conceptIndexHeaderSize {
+		return nil, ErrIndexFormat
+	}
+	if err := binary.Read(bytes.NewReader(data[:conceptIndexHeaderSize]), byteOrder, &header); err != nil {
+		return nil, err
+	}
+	if header.Magic != conceptIndexMagic {
+		return nil, ErrIndexFormat
+	}
+	if header.Version != ConceptIndexVersion {
+		return nil, ErrIndexVersion
+	}
+	index := &BinaryConceptIndex{data: data, header: header}
+	if !index.isValid() {
+		return nil, ErrIndexFormat
+	}
+	return index, nil
+}
+
+// isValid checks the section bounds of the header and every entry of the sections
+func (index *BinaryConceptIndex) isValid() bool {
+	header := index.header
+	size := uint64(len(index.data))
+	if header.CuisOffset < conceptIndexHeaderSize || header.LinesOffset > size || header.BlobOffset > size ||
+		!isSection(header.CuisOffset, header.CuiCount, cuiEntrySize, header.LinesOffset) ||
+		!isSection(header.LinesOffset, header.LineCount, lineEntrySize, header.BlobOffset) {
+		return false
+	}
+	blobSize := size - header.BlobOffset
+	for i := 0; i < int(header.CuiCount); i++ {
+		entry := index.cuiEntry(i)
+		if uint64(index.u32(entry))+uint64(index.u32(entry+4)) > blobSize ||
+			uint64(index.u32(entry+8))+uint64(index.u32(entry+12)) > uint64(header.LineCount) {
+			return false
+		}
+	}
+	for i := uint64(0); i < uint64(header.LineCount); i++ {
+		entry := header.LinesOffset + i*lineEntrySize
+		if uint64(index.u32(entry))+uint64(index.u32(entry+4)) > blobSize {
+			return false
+		}
+	}
+	return true
+}
+
+func OpenConceptIndex(path string) (*BinaryConceptIndex, error) {
+	file, err := utils.OpenMappedFile(path)
+	if err != nil {
+		return nil, err
+	}
+	index, err := NewBinaryConceptIndex(file.Bytes())
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	index.file = file
+	return index, nil
+}
+
+func (index *BinaryConceptIndex) Close() error {
+	if index.file == nil {
+		return nil
+	}
+	return index.file.Close()
+}
+
+func (index *BinaryConceptIndex) u32(offset uint64) uint32 {
+	return byteOrder.Uint32(index.data[offset : offset+4])
+}
+
+func (index *BinaryConceptIndex) blob(offset uint32, length uint32) []byte {
+	begin := index.header.BlobOffset + uint64(offset)
+	return index.data[begin : begin+uint64(length)]
+}
+
+func (index *BinaryConceptIndex) cuiEntry(i int) uint64 {
+	return index.header.CuisOffset + uint64(i)*cuiEntrySize
+}
+
+func (index *BinaryConceptIndex) cui(i int) string {
+	entry := index.cuiEntry(i)
+	return string(index.blob(index.u32(entry), index.u32(entry+4)))
+}
+
+// Lines returns the dictionary lines of the CUI
+func (index *BinaryConceptIndex) Lines(cui string) []string {
+	cuiCount := int(index.header.CuiCount)
+	i := sort.Search(cuiCount, func(i int) bool {
+		return index.cui(i) >= cui
+	})
+	if i >= cuiCount || index.cui(i) != cui {
+		return nil
+	}
+
+	entry := index.cuiEntry(i)
+	firstLine := uint64(index.u32(entry + 8))
+	lineCount := uint64(index.u32(entry + 12))
+
+	lines := make([]string, lineCount)
+	for l := uint64(0); l < lineCount; l++ {
+		lineEntry := index.header.LinesOffset + (firstLine+l)*lineEntrySize
+		lines[l] = string(index.blob(index.u32(lineEntry), index.u32(lineEntry+4)))
+	}
+	return lines
+}
+
+func (index *BinaryConceptIndex) Len() int {
+	return int(index.header.CuiCount)
+}
+
+// Size returns size of the encoded index in bytes
+func (index *BinaryConceptIndex) Size() int {
+	return len(index.data)
+}
+
+// EncodeFuzzyIndex builds the deletion index of the rare words and serializes it into the binary fuzzy index
+func EncodeFuzzyIndex(termIndex TermIndex, params FuzzyParams) ([]byte, error) {
+	maps := buildFuzzyWordMaps(termIndex, params)
+
+	known := make([]string, 0, len(maps.known))
+	for word := range maps.known {
+		known = append(known, word)
+	}
+	sort.Strings(known)
+	deletes := make([]string, 0, len(maps.deletes))
+	for del := range maps.deletes {
+		deletes = append(deletes, del)
+	}
+	sort.Strings(deletes)
+
+	var knownBuf, deletesBuf, rareWordsBuf, postingsBuf, blobBuf bytes.Buffer
+	for _, word := range known {
+		writeValues(&knownBuf, uint32(blobBuf.Len()), uint32(len(word)))
+		blobBuf.WriteString(word)
+	}
+	rareWords := newStringTable()
+	postingCount := uint32(0)
+	for _, del := range deletes {
+		words := maps.deletes[del]
+		writeValues(&deletesBuf, uint32(blobBuf.Len()), uint32(len(del)), postingCount, uint32(len(words)))
+		blobBuf.WriteString(del)
+		for _, word := range words {
+			writeValues(&postingsBuf, rareWords.add(*word))
+			postingCount++
+		}
+	}
+	for _, word := range rareWords.values {
+		writeValues(&rareWordsBuf, uint32(blobBuf.Len()), uint32(len(word)))
+		blobBuf.WriteString(word)
+	}
+	if uint64(blobBuf.Len()) > 0xFFFFFFFF {
+		return nil, errors.New("fuzzy index is too large")
+	}
+
+	header := fuzzyIndexHeader{
+		Magic:         fuzzyIndexMagic,
+		Version:       FuzzyIndexVersion,
+		MaxDistance:   uint32(params.MaxDistance),
+		MinLength:     uint32(params.MinLength),
+		KnownCount:    uint32(len(known)),
+		DeleteCount:   uint32(len(deletes)),
+		RareWordCount: uint32(len(rareWords.values)),
+		PostingCount:  postingCount,
+	}
+	header.KnownOffset = fuzzyIndexHeaderSize
+	header.DeletesOffset = header.KnownOffset + uint64(knownBuf.Len())
+	header.RareWordsOffset = header.DeletesOffset + uint64(deletesBuf.Len())
+	header.PostingsOffset = header.RareWordsOffset + uint64(rareWordsBuf.Len())
+	header.BlobOffset = header.PostingsOffset + uint64(postingsBuf.Len())
+
+	var out bytes.Buffer
+	out.Grow(int(header.BlobOffset) + blobBuf.Len())
+	writeValues(&out, header)
+	out.Write(knownBuf.Bytes())
+	out.Write(deletesBuf.Bytes())
+	out.Write(rareWordsBuf.Bytes())
+	out.Write(postingsBuf.Bytes())
+	out.Write(blobBuf.Bytes())
+	return out.Bytes(), nil
+}
+
+// BinaryFuzzyIndex gives the fuzzy index access to the encoded (usually memory mapped) deletion index
+type BinaryFuzzyIndex struct {
+	data   []byte
+	header fuzzyIndexHeader
+	file   *utils.MappedFile
+}
+
+// NewBinaryFuzzyIndex opens the encoded deletion index, it has to be built with the same parameters
+func NewBinaryFuzzyIndex(data []byte, params FuzzyParams) (*BinaryFuzzyIndex, error) {
+	var header fuzzyIndexHeader
+	if len(data) < fuzzyIndexHeaderSize {
+		return nil, ErrIndexFormat
+	}
+	if err := binary.Read(bytes.NewReader(data[:fuzzyIndexHeaderSize]), byteOrder, &header); err != nil {
+		return nil, err
+	}
+	if header.Magic != fuzzyIndexMagic {
+		return nil, ErrIndexFormat
+	}
+	if header.Version != FuzzyIndexVersion {
+		return nil, ErrIndexVersion
+	}
+	if header.MaxDistance != uint32(params.MaxDistance) || header.MinLength != uint32(params.MinLength) {
+		return nil, fmt.Errorf("fuzzy index is built with max distance %d and min length %d",
+			header.MaxDistance, header.MinLength)
+	}
+	index := &BinaryFuzzyIndex{data: data, header: header}
+	if !index.isValid() {
+		return nil, ErrIndexFormat
+	}
+	return index, nil
+}
+
+// isValid checks the section bounds of the header and every entry of the sections
+func (index *BinaryFuzzyIndex) isValid() bool {
+	header := index.header
+	size := uint64(len(index.data))
+	if header.KnownOffset < fuzzyIndexHeaderSize || header.DeletesOffset > size || header.RareWordsOffset > size ||
+		header.PostingsOffset > size || header.BlobOffset > size ||
+		!isSection(header.KnownOffset, header.KnownCount, stringEntrySize, header.DeletesOffset) ||
+		!isSection(header.DeletesOffset, header.DeleteCount, deleteEntrySize, header.RareWordsOffset) ||
+		!isSection(header.RareWordsOffset, header.RareWordCount, stringEntrySize, header.PostingsOffset) ||
+		!isSection(header.PostingsOffset, header.PostingCount, postingEntrySize, header.BlobOffset) {
+		return false
+	}
+	blobSize := size - header.BlobOffset
+	isString := func(entry uint64) bool {
+		return uint64(index.u32(entry))+uint64(index.u32(entry+4)) <= blobSize
+	}
+	for i := uint64(0); i < uint64(header.KnownCount); i++ {
+		if !isString(header.KnownOffset + i*stringEntrySize) {
+			return false
+		}
+	}
+	for i := uint64(0); i < uint64(header.DeleteCount); i++ {
+		entry := header.DeletesOffset + i*deleteEntrySize
+		if !isString(entry) || uint64(index.u32(entry+8))+uint64(index.u32(entry+12)) > uint64(header.PostingCount) {
+			return false
+		}
+	}
+	for i := uint64(0); i < uint64(header.RareWordCount); i++ {
+		if !isString(header.RareWordsOffset + i*stringEntrySize) {
+			return false
+		}
+	}
+	for i := uint64(0); i < uint64(header.PostingCount); i++ {
+		if index.u32(header.PostingsOffset+i*postingEntrySize) >= header.RareWordCount {
+			return false
+		}
+	}
+	return true
+}
+
+func OpenFuzzyIndex(path string, params FuzzyParams) (*BinaryFuzzyIndex, error) {
+	file, err := utils.OpenMappedFile(path)
+	if err != nil {
+		return nil, err
+	}
+	index, err := NewBinaryFuzzyIndex(file.Bytes(), params)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	index.file = file
+	return index, nil
+}
+
+func (index *BinaryFuzzyIndex) Close() error {
+	if index.file == nil {
+		return nil
+	}
+	return index.file.Close()
+}
+
+func (index *BinaryFuzzyIndex) u32(offset uint64) uint32 {
+	return byteOrder.Uint32(index.data[offset : offset+4])
+}
+
+// stringBytes returns the value of the (blob offset, length) entry
+func (index *BinaryFuzzyIndex) stringBytes(entry uint64) []byte {
+	begin := index.header.BlobOffset + uint64(index.u32(entry))
+	return index.data[begin : begin+uint64(index.u32(entry+4))]
+}
+
+// search returns the entry of the sorted section with the value
+func (index *BinaryFuzzyIndex) search(offset uint64, count uint32, entrySize uint64, value string) (uint64, bool) {
+	i := sort.Search(int(count), func(i int) bool {
+		return string(index.stringBytes(offset+uint64(i)*entrySize)) >= value
+	})
+	if i >= int(count) {
+		return 0, false
+	}
+	entry := offset + uint64(i)*entrySize
+	return entry, string(index.stringBytes(entry)) == value
+}
+
+func (index *BinaryFuzzyIndex) isKnown(word string) bool {
+	_, ok := index.search(index.header.KnownOffset, index.header.KnownCount, stringEntrySize, word)
+	return ok
+}
+
+func (index *BinaryFuzzyIndex) rareWords(del string) []*string {
+	entry, ok := index.search(index.header.DeletesOffset, index.header.DeleteCount, deleteEntrySize, del)
+	if !ok {
+		return nil
+	}
+	firstPosting := uint64(index.u32(entry + 8))
+	postingCount := uint64(index.u32(entry + 12))
+
+	words := make([]*string, postingCount)
+	for p := uint64(0); p < postingCount; p++ {
+		id := uint64(index.u32(index.header.PostingsOffset + (firstPosting+p)*postingEntrySize))
+		words[p] = utils.GlobalStringStore().GetPointer(string(index.stringBytes(index.header.RareWordsOffset + id*stringEntrySize)))
+	}
+	return words
+}
+
+func (index *BinaryFuzzyIndex) deleteCount() int {
+	return int(index.header.DeleteCount)
+}
+
+// Size returns size of the encoded index in bytes
+func (index *BinaryFuzzyIndex) Size() int {
+	return len(index.data)
+}
+
+// writeIndexFile writes the index into temporary file and renames it, so other replicas never see partially written index
+func writeIndexFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
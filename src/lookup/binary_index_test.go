@@ -0,0 +1,204 @@
+package lookup
+
+import (
+	"text2phenotype.com/fdl/types"
+	"text2phenotype.com/fdl/utils"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBinaryTermIndex(t *testing.T) {
+	store := utils.GlobalStringStore()
+	rwMap := createRareWordMap([]*RareWordTerm{
+		{Tokens: store.GetPointers([]string{"multiple", "sclerosis"}), CUI: store.GetPointer("c0026769"), TextLength: 18},
+		{Tokens: store.GetPointers([]string{"ms"}), CUI: store.GetPointer("c0026769"), TextLength: 2, CasedTokens: []string{"MS"}},
+		{Tokens: store.GetPointers([]string{"pneumonia"}), CUI: store.GetPointer("c0032285"), TextLength: 9},
+	})
+
+	data, err := EncodeTermIndex(rwMap)
+	require.NoError(t, err)
+
+	idxPath := filepath.Join(t.TempDir(), "test"+TermIndexExt)
+	require.NoError(t, writeIndexFile(idxPath, data))
+
+	index, err := OpenTermIndex(idxPath)
+	require.NoError(t, err)
+	defer index.Close()
+
+	require.Equal(t, rwMap.Len(), index.Len())
+
+	rwMap.ForEach(func(rareWord *string, expected []*RareWordTerm) {
+		// not interned string has to be found as well
+		word := string([]byte(*rareWord))
+		actual := index.Terms(&word)
+		require.Len(t, actual, len(expected))
+		for i := range expected {
+			require.Equal(t, *expected[i].CUI, *actual[i].CUI)
+			require.Equal(t, expected[i].TextLength, actual[i].TextLength)
+			require.Equal(t, expected[i].RareWordIndex, actual[i].RareWordIndex)
+			require.Equal(t, expected[i].CasedTokens, actual[i].CasedTokens)
+			require.Len(t, actual[i].Tokens, len(expected[i].Tokens))
+			for j := range expected[i].Tokens {
+				require.True(t, SameString(expected[i].Tokens[j], actual[i].Tokens[j]))
+			}
+		}
+	})
+
+	missing := "fracture"
+	require.Empty(t, index.Terms(&missing))
+}
+
+func TestBinaryTermIndexTermsCache(t *testing.T) {
+	store := utils.GlobalStringStore()
+	rwMap := createRareWordMap([]*RareWordTerm{
+		{Tokens: store.GetPointers([]string{"multiple", "sclerosis"}), CUI: store.GetPointer("c0026769"), TextLength: 18},
+		{Tokens: store.GetPointers([]string{"pneumonia"}), CUI: store.GetPointer("c0032285"), TextLength: 9},
+	})
+	data, err := EncodeTermIndex(rwMap)
+	require.NoError(t, err)
+	index, err := NewBinaryTermIndex(data)
+	require.NoError(t, err)
+
+	var rareWords []string
+	index.ForEach(func(rareWord *string, _ []*RareWordTerm) {
+		rareWords = append(rareWords, *rareWord)
+	})
+	require.Len(t, rareWords, 2)
+	word, other := rareWords[0], rareWords[1]
+	terms := index.Terms(&word)
+	require.Len(t, terms, 1)
+	require.Same(t, terms[0], index.Terms(&word)[0])
+
+	// cached terms are returned without allocations
+	allocs := testing.AllocsPerRun(100, func() {
+		index.Terms(&word)
+		index.Terms(&other)
+	})
+	require.Zero(t, allocs)
+
+	// the slot of the rare word is taken by another one
+	index.cache[0].Store(&cachedTerms{key: termCacheSize})
+	index.cache[1].Store(&cachedTerms{key: termCacheSize + 1})
+	require.Len(t, index.Terms(&word), 1)
+	require.Len(t, index.Terms(&other), 1)
+}
+
+func BenchmarkBinaryTermIndexTerms(b *testing.B) {
+	store := utils.GlobalStringStore()
+	rwMap := createRareWordMap([]*RareWordTerm{
+		{Tokens: store.GetPointers([]string{"multiple", "sclerosis"}), CUI: store.GetPointer("c0026769"), TextLength: 18},
+		{Tokens: store.GetPointers([]string{"pneumonia"}), CUI: store.GetPointer("c0032285"), TextLength: 9},
+	})
+	data, err := EncodeTermIndex(rwMap)
+	require.NoError(b, err)
+	index, err := NewBinaryTermIndex(data)
+	require.NoError(b, err)
+
+	word := "pneumonia"
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		index.Terms(&word)
+	}
+}
+
+func TestBinaryTermIndexCorrupted(t *testing.T) {
+	store := utils.GlobalStringStore()
+	rwMap := createRareWordMap([]*RareWordTerm{
+		{Tokens: store.GetPointers([]string{"multiple", "sclerosis"}), CUI: store.GetPointer("c0026769"), TextLength: 18},
+		{Tokens: store.GetPointers([]string{"ms"}), CUI: store.GetPointer("c0026769"), TextLength: 2, CasedTokens: []string{"MS"}},
+	})
+	data, err := EncodeTermIndex(rwMap)
+	require.NoError(t, err)
+	_, err = NewBinaryTermIndex(data)
+	require.NoError(t, err)
+
+	// truncated index fails at open instead of panicking on lookup
+	for size := 0; size < len(data); size++ {
+		_, err := NewBinaryTermIndex(data[:size])
+		require.Equal(t, ErrIndexFormat, err, "size %d", size)
+	}
+
+	corrupt := func(offset uint64, value uint32) []byte {
+		corrupted := append([]byte{}, data...)
+		byteOrder.PutUint32(corrupted[offset:], value)
+		return corrupted
+	}
+	index, err := NewBinaryTermIndex(data)
+	require.NoError(t, err)
+	header := index.header
+	tests := map[string][]byte{
+		"keys offset":       corrupt(48, 0xFFFFFF),
+		"string length":     corrupt(header.StringsOffset+4, 0xFFFF),
+		"key string id":     corrupt(header.KeysOffset, header.StringCount),
+		"key term count":    corrupt(header.KeysOffset+8, header.TermCount+1),
+		"term cui id":       corrupt(header.TermsOffset, header.StringCount),
+		"term first token":  corrupt(header.TermsOffset+8, header.TokenCount),
+		"token string id":   corrupt(header.TokensOffset, header.StringCount),
+		"token not a lemma": corrupt(header.TokensOffset, noLemma),
+	}
+	for name, corrupted := range tests {
+		_, err := NewBinaryTermIndex(corrupted)
+		require.Equal(t, ErrIndexFormat, err, name)
+	}
+}
+
+func TestCorruptedTermIndexIsRebuilt(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "resources", "dictionaries", "test")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	path := filepath.Join(dir, "terms.bsv")
+	require.NoError(t, os.WriteFile(path, []byte("C0032285|Pneumonia\nC0026769|Multiple sclerosis\n"), 0644))
+
+	scheme := []string{types.CUI, types.STR}
+	casePolicy, err := NewCasePolicy(types.FDLConfig{})
+	require.NoError(t, err)
+	analyzer, err := NewTermAnalyzer(types.TermTokenizerRegex, nil, nil)
+	require.NoError(t, err)
+
+	_, index, err := loadDictionary("test", path, scheme, casePolicy, analyzer, FuzzyParams{})
+	require.NoError(t, err)
+	require.NoError(t, index.(*BinaryTermIndex).Close())
+
+	nop := zerolog.Nop()
+	idxPath, err := getDstFilepath(path, "CUISTR", TermIndexExt, &nop)
+	require.NoError(t, err)
+	data, err := os.ReadFile(idxPath)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(idxPath, data[:len(data)/2], 0644))
+
+	dict, index, err := loadDictionary("test", path, scheme, casePolicy, analyzer, FuzzyParams{})
+	require.NoError(t, err)
+	defer index.(*BinaryTermIndex).Close()
+	require.Len(t, collectTerms(dict(utils.GlobalStringStore().GetPointers([]string{"pneumonia"}))), 1)
+
+	rebuilt, err := os.ReadFile(idxPath)
+	require.NoError(t, err)
+	require.Equal(t, data, rebuilt)
+}
+
+func TestBinaryConceptIndex(t *testing.T) {
+	data, err := EncodeConceptIndex(map[string][]string{
+		"c0032285": {"c0032285|t047|pneumonia"},
+		"c0026769": {"c0026769|t047|multiple sclerosis", "c0026769|t047|ms"},
+	})
+	require.NoError(t, err)
+
+	index, err := NewBinaryConceptIndex(data)
+	require.NoError(t, err)
+
+	require.Equal(t, 2, index.Len())
+	require.Equal(t, []string{"c0026769|t047|multiple sclerosis", "c0026769|t047|ms"}, index.Lines("c0026769"))
+	require.Empty(t, index.Lines("c0000000"))
+
+	for size := 0; size < len(data); size++ {
+		_, err := NewBinaryConceptIndex(data[:size])
+		require.Equal(t, ErrIndexFormat, err, "size %d", size)
+	}
+
+	data[8] = 0xFF
+	_, err = NewBinaryConceptIndex(data)
+	require.Equal(t, ErrIndexVersion, err)
+}
@@ -0,0 +1,61 @@
+package lookup
+
+import (
+	"text2phenotype.com/fdl/types"
+	"fmt"
+	"unicode/utf8"
+)
+
+const defaultCaseSensitiveMaxLength = 3
+
+// CasePolicy decides which dictionary terms have to be matched with the exact case
+type CasePolicy struct {
+	Mode      string
+	MaxLength int
+}
+
+func NewCasePolicy(cfg types.FDLConfig) (CasePolicy, error) {
+	policy := CasePolicy{
+		Mode:      cfg.CaseSensitivity,
+		MaxLength: cfg.CaseSensitiveMaxLength,
+	}
+
+	if len(policy.Mode) == 0 {
+		policy.Mode = types.CaseInsensitive
+	}
+
+	switch policy.Mode {
+	case types.CaseInsensitive, types.CaseExact:
+	case types.CaseShortAcronyms:
+		if policy.MaxLength <= 0 {
+			policy.MaxLength = defaultCaseSensitiveMaxLength
+		}
+	default:
+		return CasePolicy{}, fmt.Errorf("unknown case sensitivity mode %q", policy.Mode)
+	}
+
+	return policy, nil
+}
+
+func (policy CasePolicy) IsEnabled() bool {
+	return policy.Mode == types.CaseExact || policy.Mode == types.CaseShortAcronyms
+}
+
+// IsCaseSensitive checks if the term (as it is written in the dictionary) should be matched with the exact case
+func (policy CasePolicy) IsCaseSensitive(term string) bool {
+	switch policy.Mode {
+	case types.CaseExact:
+		return true
+	case types.CaseShortAcronyms:
+		return utf8.RuneCountInString(term) <= policy.MaxLength && isUpperText(term)
+	}
+	return false
+}
+
+// GetHashCode is used as a part of the index cache key, so indexes built with different policies don't clash
+func (policy CasePolicy) GetHashCode() string {
+	if !policy.IsEnabled() {
+		return ""
+	}
+	return fmt.Sprintf("%s%d", policy.Mode, policy.MaxLength)
+}
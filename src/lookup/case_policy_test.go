@@ -0,0 +1,121 @@
+package lookup
+
+import (
+	"text2phenotype.com/fdl/types"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNewCasePolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       types.FDLConfig
+		expected  CasePolicy
+		isEnabled bool
+		isError   bool
+	}{
+		{name: "default", cfg: types.FDLConfig{}, expected: CasePolicy{Mode: types.CaseInsensitive}},
+		{name: "insensitive", cfg: types.FDLConfig{CaseSensitivity: types.CaseInsensitive}, expected: CasePolicy{Mode: types.CaseInsensitive}},
+		{name: "exact", cfg: types.FDLConfig{CaseSensitivity: types.CaseExact}, expected: CasePolicy{Mode: types.CaseExact}, isEnabled: true},
+		{
+			name:      "short acronyms with default length",
+			cfg:       types.FDLConfig{CaseSensitivity: types.CaseShortAcronyms},
+			expected:  CasePolicy{Mode: types.CaseShortAcronyms, MaxLength: defaultCaseSensitiveMaxLength},
+			isEnabled: true,
+		},
+		{
+			name:      "short acronyms with length",
+			cfg:       types.FDLConfig{CaseSensitivity: types.CaseShortAcronyms, CaseSensitiveMaxLength: 5},
+			expected:  CasePolicy{Mode: types.CaseShortAcronyms, MaxLength: 5},
+			isEnabled: true,
+		},
+		{name: "unknown mode", cfg: types.FDLConfig{CaseSensitivity: "upper"}, isError: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy, err := NewCasePolicy(test.cfg)
+			if test.isError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, policy)
+			require.Equal(t, test.isEnabled, policy.IsEnabled())
+		})
+	}
+}
+
+func TestCasePolicyIsCaseSensitive(t *testing.T) {
+	insensitive := CasePolicy{Mode: types.CaseInsensitive}
+	exact := CasePolicy{Mode: types.CaseExact}
+	acronyms := CasePolicy{Mode: types.CaseShortAcronyms, MaxLength: 3}
+
+	tests := []struct {
+		policy   CasePolicy
+		term     string
+		expected bool
+	}{
+		{insensitive, "HTN", false},
+		{insensitive, "htn", false},
+		{exact, "HTN", true},
+		{exact, "htn", true},
+		{exact, "Hypertension", true},
+		{acronyms, "HTN", true},
+		{acronyms, "htn", false},
+		{acronyms, "Htn", false},
+		// MaxLength boundary
+		{acronyms, "MI", true},
+		{acronyms, "COPD", false},
+		{CasePolicy{Mode: types.CaseShortAcronyms, MaxLength: 4}, "COPD", true},
+		// letters decide, digits and punctuation don't count as lower case
+		{acronyms, "T2", true},
+		{acronyms, "123", false},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.expected, test.policy.IsCaseSensitive(test.term), "%s %q", test.policy.Mode, test.term)
+	}
+}
+
+func TestCasePolicyGetHashCode(t *testing.T) {
+	policies := []CasePolicy{
+		{Mode: types.CaseInsensitive},
+		{Mode: types.CaseExact},
+		{Mode: types.CaseShortAcronyms, MaxLength: 3},
+		{Mode: types.CaseShortAcronyms, MaxLength: 4},
+	}
+	// the insensitive policy keeps the cache keys of the indexes built before the case policies
+	require.Empty(t, policies[0].GetHashCode())
+
+	hashes := make(map[string]bool)
+	for _, policy := range policies {
+		hashes[policy.GetHashCode()] = true
+	}
+	require.Len(t, hashes, len(policies))
+}
+
+func TestRareWordTermMatchesCase(t *testing.T) {
+	newToken := func(text string, shape string) *types.Token {
+		return &types.Token{Span: types.Span{Text: &text}, Shape: shape}
+	}
+	htn := "htn"
+	term := RareWordTerm{Tokens: []*string{&htn}, CasedTokens: []string{"HTN"}}
+	insensitiveTerm := RareWordTerm{Tokens: []*string{&htn}}
+
+	tests := []struct {
+		token    *types.Token
+		expected bool
+	}{
+		{newToken("htn", "XXX"), true},
+		{newToken("htn", "xxx"), false},
+		{newToken("htn", "Xxx"), false},
+		// shape shorter than the text, the text is compared as it is
+		{newToken("htn", "X"), false},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.expected, term.MatchesCase(0, test.token), "%s %s", *test.token.Text, test.token.Shape)
+		require.Equal(t, test.expected, term.MatchesToken(0, test.token))
+		require.True(t, insensitiveTerm.MatchesCase(0, test.token))
+	}
+	require.Equal(t, "HTN", newToken("htn", "XXX").GetShapedText())
+	require.Equal(t, "Htn", newToken("htn", "Xxx").GetShapedText())
+}
@@ -2,12 +2,12 @@ package lookup
 
 import (
 	"bufio"
-	"bytes"
 	"text2phenotype.com/fdl/logger"
 	"text2phenotype.com/fdl/types"
-	"text2phenotype.com/fdl/utils"
+	"fmt"
+	"github.com/rs/zerolog"
 	"io"
-	"io/ioutil"
+	"os"
 	"strings"
 )
 
@@ -15,11 +15,6 @@ type SemanticConcepts map[types.Semantic]*types.Concept // semantic -> concept
 
 type ConceptFactory func(cuis []*string) (map[*string]SemanticConcepts, error) // cui -> semantic concepts
 
-type ConceptOffset struct {
-	Offset int64
-	Length int
-}
-
 func parseTUIs(tui string) []string {
 	if strings.HasPrefix(tui, "[") {
 		return strings.Split(tui[1:len(tui)-1], ",")
@@ -29,6 +24,12 @@ func parseTUIs(tui string) []string {
 }
 
 func CreateConceptFactory(configName string, path string, scheme []string, ignoreParams []string) (ConceptFactory, error) {
+	factory, _, err := loadConceptFactory(configName, path, scheme, ignoreParams)
+	return factory, err
+}
+
+// loadConceptFactory creates the concept factory and returns its index, so the caller can close the index when it's not needed
+func loadConceptFactory(configName string, path string, scheme []string, ignoreParams []string) (ConceptFactory, *BinaryConceptIndex, error) {
 	fdlLogger := logger.NewLogger("Concept factory loader").With().
 		Str("config_name", configName).
 		Str("path", path).Logger()
@@ -49,81 +50,113 @@ func CreateConceptFactory(configName string, path string, scheme []string, ignor
 
 	cuiIdx := schemaMap[types.CUI]
 
-	dictBytes, err := ioutil.ReadFile(path)
+	errLogger := fdlLogger.With().Caller().Logger()
+	idxCachePath, err := getDstFilepath(path, strings.Join(scheme, ""), ConceptIndexExt, &errLogger)
 	if err != nil {
-		return nil, err
+		errLogger.Err(err).Msg("Could not create index cache path")
+		return nil, nil, err
+	}
+	fdlLogger = fdlLogger.With().Str("index_cache_path", idxCachePath).Logger()
+	errLogger = errLogger.With().Str("index_cache_path", idxCachePath).Logger()
+
+	conceptIndex, err := OpenConceptIndex(idxCachePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			errLogger.Err(err).Msg("Could not open index cache, it will be rebuilt")
+		}
+
+		fdlLogger.Info().Msg("Building new index")
+		conceptIndex, err = buildConceptIndex(path, cuiIdx, idxCachePath, &errLogger)
+		if err != nil {
+			errLogger.Err(err).Msg("Could not build concept index")
+			return nil, nil, err
+		}
 	}
-	bytesReader := bytes.NewReader(dictBytes)
-	reader := bufio.NewReader(bytesReader)
-	store := utils.GlobalStringStore()
 
-	conceptMap := make(map[*string][]ConceptOffset)
+	fdlLogger.Info().Msgf("Loaded %d concepts", conceptIndex.Len())
+
+	return func(cuis []*string) (map[*string]SemanticConcepts, error) {
+		result := make(map[*string]SemanticConcepts)
+
+		for _, cuiPtr := range cuis {
+			cuiSemantics, err := createSemanticConcepts(cuiPtr, conceptIndex.Lines(*cuiPtr), schemaMap)
+			if err != nil {
+				errLogger.Err(err).Str("cui", *cuiPtr).Msg("")
+				return nil, err
+			}
+			result[cuiPtr] = cuiSemantics
+		}
+		return result, nil
+	}, conceptIndex, nil
+}
+
+// createSemanticConcepts groups concept lines of the CUI by semantic groups of their TUIs
+func createSemanticConcepts(cuiPtr *string, lines []string, schemaMap map[string]int) (SemanticConcepts, error) {
+	tuiIdx := schemaMap[types.TUI]
+	cuiSemantics := make(SemanticConcepts)
 
-	offset := int64(0)
+	for _, line := range lines {
+		columns := strings.Split(line, "|")
+		if tuiIdx >= len(columns) {
+			return nil, fmt.Errorf("concept line has %d columns, TUI index is %d", len(columns), tuiIdx)
+		}
+
+		tuis := parseTUIs(columns[tuiIdx])
+
+		for _, tui := range tuis {
+			tuiSemantic := GutTUISemanticGroupID(tui)
+			semanticConcept, ok := cuiSemantics[tuiSemantic]
+			if !ok {
+				semanticConcept = types.CreateConcept(columns, cuiPtr, schemaMap)
+			}
+			semanticConcept.Update(tui, columns, schemaMap)
+			cuiSemantics[tuiSemantic] = semanticConcept
+
+		}
+	}
+	return cuiSemantics, nil
+}
+
+// buildConceptIndex groups lines of the concept dictionary by CUI, saves binary index and opens it with memory mapping.
+// If the index can't be saved, in-memory index is used.
+func buildConceptIndex(path string, cuiIdx int, idxCachePath string, errLogger *zerolog.Logger) (*BinaryConceptIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	conceptLines := make(map[string][]string)
 	for {
 		line, err := reader.ReadString('\n')
-		if err == io.EOF {
+		if err == io.EOF && len(line) == 0 {
 			break
-		} else if err != nil {
+		} else if err != nil && err != io.EOF {
 			return nil, err
 		}
-		offset += int64(len(line))
 		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
 			continue
 		}
 		cutLine := strings.ToLower(strings.Trim(line, "\n"))
 		columns := strings.Split(cutLine, "|")
+		if cuiIdx >= len(columns) {
+			continue
+		}
 
 		cui := columns[cuiIdx]
-		cuiPtr := store.GetPointer(cui)
-
-		conceptData := ConceptOffset{
-			Offset: offset - int64(len(line)),
-			Length: len(line),
-		}
-		conceptMap[cuiPtr] = append(conceptMap[cuiPtr], conceptData)
+		conceptLines[cui] = append(conceptLines[cui], cutLine)
 	}
 
-	tuiIdx := schemaMap[types.TUI]
-
-	fdlLogger.Info().Msgf("Loaded %d concepts", len(conceptMap))
-	errLogger := fdlLogger.With().Caller().Logger()
+	data, err := EncodeConceptIndex(conceptLines)
+	if err != nil {
+		return nil, err
+	}
 
-	return func(cuis []*string) (map[*string]SemanticConcepts, error) {
-		result := make(map[*string]SemanticConcepts)
+	if err := writeIndexFile(idxCachePath, data); err != nil {
+		errLogger.Err(err).Msg("Could not save index cache, in-memory index will be used")
+		return NewBinaryConceptIndex(data)
+	}
 
-		for _, cuiPtr := range cuis {
-			cuiOffsets := conceptMap[cuiPtr]
-
-			cuiSemantics := make(SemanticConcepts)
-
-			for _, cuiOffset := range cuiOffsets {
-				buf := make([]byte, cuiOffset.Length)
-				_, err := bytesReader.ReadAt(buf, cuiOffset.Offset)
-				if err != nil {
-					errLogger.Err(err).Msg("")
-					return nil, err
-				}
-				line := string(buf)
-
-				line = strings.ToLower(strings.Trim(line, "\n"))
-				columns := strings.Split(line, "|")
-
-				tuis := parseTUIs(columns[tuiIdx])
-
-				for _, tui := range tuis {
-					tuiSemantic := GutTUISemanticGroupID(tui)
-					semanticConcept, ok := cuiSemantics[tuiSemantic]
-					if !ok {
-						semanticConcept = types.CreateConcept(columns, cuiPtr, schemaMap)
-					}
-					semanticConcept.Update(tui, columns, schemaMap)
-					cuiSemantics[tuiSemantic] = semanticConcept
-
-				}
-			}
-			result[cuiPtr] = cuiSemantics
-		}
-		return result, nil
-	}, nil
+	return OpenConceptIndex(idxCachePath)
 }
@@ -93,7 +93,10 @@ func CreatePresideTerms(textSpans []types.Span, cuis [][]*string) ([]types.Span,
 	return presideSpans, presideCuis
 }
 
-func CreateConsumer(precisionMode bool) Consumer {
+// CreateConsumer creates annotations of every semantic group of the spans, overlapping spans are resolved
+// by the strategy: within the semantic group (longest, prefer_semantic) or before the spans are grouped
+// (longest_across_groups, leftmost_longest)
+func CreateConsumer(strategy OverlapStrategy) Consumer {
 
 	consumeTypeIdHits := func(
 		semantic types.Semantic,
@@ -102,7 +105,8 @@ func CreateConsumer(precisionMode bool) Consumer {
 		conceptMap map[*string]SemanticConcepts,
 		annotations *[]types.Annotation) {
 
-		if precisionMode {
+		switch strategy.Name {
+		case types.OverlapResolutionLongest, types.OverlapResolutionPreferSemantic:
 			spans, cuis = CreatePresideTerms(spans, cuis)
 		}
 
@@ -136,6 +140,13 @@ func CreateConsumer(precisionMode bool) Consumer {
 	}
 
 	return func(spans []types.Span, spanCuis [][]*string, conceptMap map[*string]SemanticConcepts) []types.Annotation {
+		switch strategy.Name {
+		case types.OverlapResolutionLongestAcrossGroups:
+			spans, spanCuis = CreatePresideTerms(spans, spanCuis)
+		case types.OverlapResolutionLeftmostLongest:
+			spans, spanCuis = CreateLeftmostLongestTerms(spans, spanCuis)
+		}
+
 		semantics := GetUsedSemantics(conceptMap)
 
 		var annotation = make([]types.Annotation, 0)
@@ -174,6 +185,10 @@ func CreateConsumer(precisionMode bool) Consumer {
 			consumeTypeIdHits(semantic, semanticSpans, semanticCuis, conceptMap, &annotation)
 		}
 
+		if strategy.Name == types.OverlapResolutionPreferSemantic {
+			annotation = filterBySemanticPreference(annotation, strategy.Semantics)
+		}
+
 		return annotation
 	}
 }
@@ -1,7 +1,6 @@
 package lookup
 
 import (
-	"bufio"
 	"text2phenotype.com/fdl/logger"
 	"text2phenotype.com/fdl/types"
 	"text2phenotype.com/fdl/utils"
@@ -9,155 +8,314 @@ import (
 	"encoding/hex"
 	"github.com/rs/zerolog"
 	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 type Dictionary func(words []*string) MapListIterator
 
-func CreateDictionary(configName string, path string, scheme []string) (Dictionary, error) {
+func CreateDictionary(configName string, path string, scheme []string, casePolicy CasePolicy, analyzer TermAnalyzer, fuzzyParams FuzzyParams) (Dictionary, error) {
+	dict, _, err := loadDictionary(configName, path, scheme, casePolicy, analyzer, fuzzyParams)
+	return dict, err
+}
+
+// loadDictionary creates the dictionary and returns its term index, so the caller can close the index when it's not needed
+func loadDictionary(configName string, path string, scheme []string, casePolicy CasePolicy, analyzer TermAnalyzer, fuzzyParams FuzzyParams) (Dictionary, TermIndex, error) {
 	fdlLogger := logger.NewLogger("Dictionary loader").With().
 		Str("config_name", configName).
 		Str("path", path).Logger()
 	errLogger := fdlLogger.With().Caller().Logger()
 	fdlLogger.Info().Msg("Started loading")
 
-	idxCachePath, err := getDstFilepath(path, scheme, &errLogger)
+	indexParams := strings.Join(scheme, "") + casePolicy.GetHashCode() + analyzer.GetHashCode()
+	idxCachePath, err := getDstFilepath(path, indexParams, TermIndexExt, &errLogger)
 	if err != nil {
 		errLogger.Err(err).Msg("Could not create index cache path")
-		return nil, err
+		return nil, nil, err
 	}
 	fdlLogger = fdlLogger.With().Str("index_cache_path", idxCachePath).Logger()
 	errLogger = errLogger.With().Str("index_cache_path", idxCachePath).Logger()
 
-	indexExists := func() bool {
-		_, err := os.Stat(idxCachePath)
-		return err == nil
-	}()
-
-	rwMap := make(RareWordTermMap)
+	var index TermIndex
+	binIndex, err := OpenTermIndex(idxCachePath)
+	if err == nil {
+		fdlLogger.Info().Msg("Loaded index from cache")
+		index = binIndex
+	} else {
+		if !os.IsNotExist(err) {
+			errLogger.Err(err).Msg("Could not open index cache, it will be rebuilt")
+		}
 
-	if !indexExists {
 		fdlLogger.Info().Msg("Building new index")
-		var schemaMap = make(map[string]byte)
-		for i, columnName := range scheme {
-			schemaMap[columnName] = byte(i)
+		rwMap, report, err := BuildRareWordTermMap(path, scheme, casePolicy, analyzer)
+		if err != nil {
+			errLogger.Err(err).Msg("Could not build rare words map")
+			return nil, nil, err
+		}
+		if analyzer.IsRuntime() {
+			fdlLogger.Info().
+				Int("changed_terms", report.Changed).
+				Interface("examples", report.Examples).
+				Msgf("%d of %d terms are tokenized differently by the runtime tokenizer", report.Changed, report.Terms)
 		}
 
-		cuiIdx := schemaMap[types.CUI]
-		strIdx := schemaMap[types.STR]
-
-		tokenizr, err := NewTermTokenizer()
+		index, err = saveTermIndex(idxCachePath, rwMap)
 		if err != nil {
-			errLogger.Err(err).Msg("Could not create term tokenizer")
-			return nil, err
+			errLogger.Err(err).Msg("Could not save index cache, in-memory index will be used")
+			index = rwMap
 		}
+	}
+
+	fdlLogger.Info().Msgf("%d terms were loaded", index.Len())
 
-		var rare_words []*RareWordTerm
+	if !fuzzyParams.IsEnabled() {
+		return func(words []*string) MapListIterator {
+			return CreateMapListIterator(index, words)
+		}, index, nil
+	}
+
+	fuzzyIndex, binFuzzyIndex := loadFuzzyIndex(path, indexParams, index, fuzzyParams, &fdlLogger, &errLogger)
+	fdlLogger.Info().Msgf("Fuzzy index has %d deletes", fuzzyIndex.DeleteCount())
 
-		getHash := func(columns []string) uint64 {
-			cui := columns[cuiIdx]
-			term := columns[strIdx]
-			return utils.HashString(cui + "_" + term)
+	dict := func(words []*string) MapListIterator {
+		candidates := fuzzyIndex.Candidates(words)
+		if len(candidates) == 0 {
+			return CreateMapListIterator(index, words)
 		}
+		return createFuzzyMapListIterator(index, candidates)
+	}
+	if binFuzzyIndex != nil {
+		index = fuzzyTermIndex{TermIndex: index, fuzzy: binFuzzyIndex}
+	}
+	return dict, index, nil
+}
 
-		reader, err := utils.NewBSVReader(path, getHash)
-		if err != nil {
-			errLogger.Err(err).Msg("Could not create BSV reader")
-			return nil, err
+// loadFuzzyIndex opens the cached deletion index of the dictionary or builds and saves it next to the term index,
+// the in-memory index is used if it can't be saved. The binary index is nil for the in-memory index.
+func loadFuzzyIndex(dictPath string, indexParams string, index TermIndex, params FuzzyParams, fdlLogger *zerolog.Logger, errLogger *zerolog.Logger) (*FuzzyIndex, *BinaryFuzzyIndex) {
+	fuzzyCachePath, err := getDstFilepath(dictPath, indexParams+params.GetHashCode(), FuzzyIndexExt, errLogger)
+	if err != nil {
+		return NewFuzzyIndex(index, params), nil
+	}
+	cacheLogger := errLogger.With().Str("fuzzy_index_cache_path", fuzzyCachePath).Logger()
+
+	binIndex, err := OpenFuzzyIndex(fuzzyCachePath, params)
+	if err == nil {
+		fdlLogger.Info().Str("fuzzy_index_cache_path", fuzzyCachePath).Msg("Loaded fuzzy index from cache")
+		return &FuzzyIndex{params: params, words: binIndex}, binIndex
+	}
+	if !os.IsNotExist(err) {
+		cacheLogger.Err(err).Msg("Could not open fuzzy index cache, it will be rebuilt")
+	}
+
+	fdlLogger.Info().Msg("Building new fuzzy index")
+	data, err := EncodeFuzzyIndex(index, params)
+	if err == nil {
+		err = writeIndexFile(fuzzyCachePath, data)
+	}
+	if err == nil {
+		if binIndex, err = OpenFuzzyIndex(fuzzyCachePath, params); err == nil {
+			return &FuzzyIndex{params: params, words: binIndex}, binIndex
 		}
+	}
+	cacheLogger.Err(err).Msg("Could not save fuzzy index cache, in-memory index will be used")
+	return NewFuzzyIndex(index, params), nil
+}
 
-		for columns := range reader {
-			cui := columns[cuiIdx]
-			term := columns[strIdx]
+// fuzzyTermIndex closes the fuzzy index together with the term index
+type fuzzyTermIndex struct {
+	TermIndex
+	fuzzy *BinaryFuzzyIndex
+}
 
-			tokenizedTerm := tokenizr(term)
+func (index fuzzyTermIndex) Close() error {
+	var err error
+	if closer, ok := index.TermIndex.(io.Closer); ok {
+		err = closer.Close()
+	}
+	if fuzzyErr := index.fuzzy.Close(); err == nil {
+		err = fuzzyErr
+	}
+	return err
+}
 
-			if len(tokenizedTerm) == 0 {
-				continue
-			}
+// Size returns size of the encoded indexes in bytes
+func (index fuzzyTermIndex) Size() int {
+	size := index.fuzzy.Size()
+	if sized, ok := index.TermIndex.(interface{ Size() int }); ok {
+		size += sized.Size()
+	}
+	return size
+}
 
-			tokenPointers := make([]*string, len(tokenizedTerm))
-			for i, token := range tokenizedTerm {
-				tokenPointers[i] = utils.GlobalStringStore().GetPointer(token)
-			}
+// BuildRareWordTermMap reads the term dictionary and groups its terms by rare words. The report lists the terms
+// which are split differently by the runtime tokenizer, it's empty for the default term tokenizer.
+func BuildRareWordTermMap(path string, scheme []string, casePolicy CasePolicy, analyzer TermAnalyzer) (RareWordTermMap, TokenizationReport, error) {
+	var report TokenizationReport
 
-			intst := RareWordTerm{
-				Tokens:        tokenPointers,
-				CUI:           utils.GlobalStringStore().GetPointer(cui),
-				TextLength:    uint32(len(term)),
-				RareWordIndex: 0,
-			}
+	var schemaMap = make(map[string]byte)
+	for i, columnName := range scheme {
+		schemaMap[columnName] = byte(i)
+	}
 
-			rare_words = append(rare_words, &intst)
-		}
+	cuiIdx := schemaMap[types.CUI]
+	strIdx := schemaMap[types.STR]
 
-		rwMap = createRareWordMap(rare_words)
-		serialized, err := rwMap.MarshalJSON()
-		if err != nil {
-			errLogger.Err(err).Msg("Got error while marshalling rare words map")
-			return nil, err
+	var rare_words []*RareWordTerm
+
+	getHash := func(columns []string) uint64 {
+		cui := columns[cuiIdx]
+		term := columns[strIdx]
+		return utils.HashString(cui + "_" + term)
+	}
+
+	newReader := utils.NewBSVReader
+	if casePolicy.IsEnabled() {
+		newReader = utils.NewCasedBSVReader
+	}
+
+	reader, err := newReader(path, getHash)
+	if err != nil {
+		return nil, report, err
+	}
+
+	for columns := range reader {
+		cui := columns[cuiIdx]
+		term := columns[strIdx]
+
+		intst := createRareWordTerm(cui, term, analyzer, casePolicy, utils.GlobalStringStore().GetPointer)
+		if intst == nil {
+			continue
 		}
+		report.add(analyzer, term, intst)
+
+		rare_words = append(rare_words, intst)
+	}
+
+	return createRareWordMap(rare_words), report, nil
+}
+
+// createRareWordTerm tokenizes the term, returns nil if the term has no tokens
+func createRareWordTerm(cui string, term string, analyzer TermAnalyzer, casePolicy CasePolicy, intern func(s string) *string) *RareWordTerm {
+	tokenizedTerm, lemmas := analyzer.Tokenize(term)
+
+	if len(tokenizedTerm) == 0 {
+		return nil
+	}
+
+	var casedTokens []string
+	if casePolicy.IsCaseSensitive(term) {
+		casedTokens = tokenizedTerm
+	}
+
+	tokenPointers := make([]*string, len(tokenizedTerm))
+	for i, token := range tokenizedTerm {
+		tokenPointers[i] = intern(token)
+	}
 
-		go func(data []byte) {
-			err := os.MkdirAll(filepath.Dir(idxCachePath), 0700)
-			if err != nil {
-				errLogger.Err(err).Msg("Could not create dictionary for index cache")
-				return
+	var lemmaPointers []*string
+	if len(lemmas) > 0 {
+		lemmaPointers = make([]*string, len(lemmas))
+		for i, lemma := range lemmas {
+			if len(lemma) > 0 {
+				lemmaPointers[i] = intern(lemma)
 			}
-			f, err := os.Create(idxCachePath)
-			if err != nil {
-				errLogger.Err(err).Msg("Could not create file for index cache")
+		}
+	}
+
+	return &RareWordTerm{
+		Tokens:        tokenPointers,
+		CUI:           intern(cui),
+		TextLength:    uint32(len(term)),
+		RareWordIndex: 0,
+		CasedTokens:   casedTokens,
+		Lemmas:        lemmaPointers,
+	}
+}
+
+// saveTermIndex writes binary index and opens it with memory mapping
+func saveTermIndex(idxCachePath string, rwMap RareWordTermMap) (TermIndex, error) {
+	data, err := EncodeTermIndex(rwMap)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeIndexFile(idxCachePath, data); err != nil {
+		return nil, err
+	}
+	return OpenTermIndex(idxCachePath)
+}
+
+func createFuzzyMapListIterator(index TermIndex, candidates map[*string]uint8) MapListIterator {
+	keys := make([]*string, 0, len(candidates))
+	// terms of the binary index don't share the pointers of the candidates
+	distances := make(map[string]uint8, len(candidates))
+	for candidate, distance := range candidates {
+		keys = append(keys, candidate)
+		distances[*candidate] = distance
+	}
+	itr := CreateMapListIterator(index, keys)
+
+	return func() (*RareWordTerm, bool) {
+		for {
+			term, ok := itr()
+			if !ok {
+				return nil, false
 			}
-			defer func(f *os.File) {
-				err := f.Close()
-				if err != nil {
-					errLogger.Err(err).Msg("Caught error while closing cache file")
-				}
-			}(f)
-			w := bufio.NewWriter(f)
-			_, err = w.Write(data)
-			if err != nil {
-				errLogger.Err(err).Msg("Could not write serialized rare words map")
+			// case sensitive terms are short acronyms, they never match fuzzy
+			if term.IsCaseSensitive() {
+				continue
 			}
-		}(serialized)
-
-	} else {
-		fdlLogger.Info().Msg("Loading index from cache")
-		indCache, err := ioutil.ReadFile(idxCachePath)
-		if err != nil {
-			return nil, err
+			term.EditDistance = distances[*term.GetRareWord()]
+			return term, true
 		}
+	}
+}
 
-		err = rwMap.UnmarshalJSON(indCache)
-		if err != nil {
-			return nil, err
-		}
+type fileHashKey struct {
+	path    string
+	size    int64
+	modTime int64
+}
+
+// content hashes of the dictionary files, the same files are used by several configurations
+var fileHashes sync.Map // fileHashKey -> string
+
+func getFileHash(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	key := fileHashKey{path: path, size: info.Size(), modTime: info.ModTime().UnixNano()}
+	if hash, ok := fileHashes.Load(key); ok {
+		return hash.(string), nil
 	}
 
-	fdlLogger.Info().Msgf("%d terms were loaded", len(rwMap))
-	return func(words []*string) MapListIterator {
-		return CreateMapListIterator(rwMap, words)
-	}, nil
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	fileHashes.Store(key, hash)
+	return hash, nil
 }
 
-func getDstFilepath(dictPath string, scheme []string, errLogger *zerolog.Logger) (string, error) {
+func getDstFilepath(dictPath string, params string, ext string, errLogger *zerolog.Logger) (string, error) {
 	hash, err := func() (string, error) {
-		f, err := os.Open(dictPath)
+		fileHash, err := getFileHash(dictPath)
 		if err != nil {
 			return "", err
 		}
-		defer func(f *os.File) {
-			_ = f.Close()
-		}(f)
-		hasher := sha256.New()
-		if _, err := io.Copy(hasher, f); err != nil {
-			return "", err
-		}
-		result := utils.HashString(strings.Join(scheme, "") + hex.EncodeToString(hasher.Sum(nil)))
+		result := utils.HashString(params + fileHash)
 		return strconv.FormatUint(result, 10), nil
 	}()
 
@@ -169,7 +327,7 @@ func getDstFilepath(dictPath string, scheme []string, errLogger *zerolog.Logger)
 	idxDictDir := filepath.Base(filepath.Dir(dictPath))
 
 	idxName := strings.TrimSuffix(filepath.Base(dictPath), filepath.Ext(dictPath))
-	filename := strings.Join([]string{idxName, hash, ".json"}, "")
+	filename := strings.Join([]string{idxName, hash, ext}, "")
 
 	return filepath.Join(resourcePath, "tmp_index", idxDictDir, filename), nil
 }
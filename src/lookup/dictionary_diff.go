@@ -0,0 +1,163 @@
+package lookup
+
+import (
+	"text2phenotype.com/fdl/types"
+	"text2phenotype.com/fdl/utils"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type DiffTerm struct {
+	CUI  string
+	Term string
+}
+
+// DictionaryDiff lists differences between two versions of the term dictionary. A CUI is changed when it exists
+// in both versions with different lines, a term (CUI and STR pair) is changed when its other columns differ.
+type DictionaryDiff struct {
+	AddedCUIs    []string
+	RemovedCUIs  []string
+	ChangedCUIs  []string
+	AddedTerms   []DiffTerm
+	RemovedTerms []DiffTerm
+	ChangedTerms []DiffTerm
+}
+
+func (diff DictionaryDiff) IsEmpty() bool {
+	return len(diff.AddedCUIs) == 0 && len(diff.RemovedCUIs) == 0 && len(diff.ChangedCUIs) == 0 &&
+		len(diff.AddedTerms) == 0 && len(diff.RemovedTerms) == 0 && len(diff.ChangedTerms) == 0
+}
+
+// dictionary version: CUI -> STR -> sorted unique lines
+type dictionaryLines map[string]map[string][]string
+
+func readDictionaryLines(path string, scheme []string) (dictionaryLines, error) {
+	var schemaMap = make(map[string]int)
+	for i, columnName := range scheme {
+		schemaMap[columnName] = i
+	}
+	cuiIdx, ok := schemaMap[types.CUI]
+	if !ok {
+		return nil, fmt.Errorf("scheme %s has no %s column", strings.Join(scheme, "|"), types.CUI)
+	}
+	strIdx, ok := schemaMap[types.STR]
+	if !ok {
+		return nil, fmt.Errorf("scheme %s has no %s column", strings.Join(scheme, "|"), types.STR)
+	}
+
+	reader, err := utils.NewCasedBSVReader(path, func(columns []string) uint64 {
+		return utils.HashString(strings.Join(columns, "|"))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(dictionaryLines)
+	for columns := range reader {
+		if cuiIdx >= len(columns) || strIdx >= len(columns) {
+			continue
+		}
+		cui := strings.ToUpper(columns[cuiIdx])
+		terms, ok := result[cui]
+		if !ok {
+			terms = make(map[string][]string)
+			result[cui] = terms
+		}
+		term := columns[strIdx]
+		terms[term] = append(terms[term], strings.Join(columns, "|"))
+	}
+
+	for _, terms := range result {
+		for _, lines := range terms {
+			sort.Strings(lines)
+		}
+	}
+	return result, nil
+}
+
+// DiffDictionaries compares two versions of the term dictionary with the same scheme
+func DiffDictionaries(oldPath string, newPath string, scheme []string) (DictionaryDiff, error) {
+	var diff DictionaryDiff
+
+	oldLines, err := readDictionaryLines(oldPath, scheme)
+	if err != nil {
+		return diff, err
+	}
+	newLines, err := readDictionaryLines(newPath, scheme)
+	if err != nil {
+		return diff, err
+	}
+
+	for cui, oldTerms := range oldLines {
+		newTerms, ok := newLines[cui]
+		if !ok {
+			diff.RemovedCUIs = append(diff.RemovedCUIs, cui)
+			for term := range oldTerms {
+				diff.RemovedTerms = append(diff.RemovedTerms, DiffTerm{CUI: cui, Term: term})
+			}
+			continue
+		}
+
+		isChanged := false
+		for term, lines := range oldTerms {
+			newTermLines, ok := newTerms[term]
+			if !ok {
+				diff.RemovedTerms = append(diff.RemovedTerms, DiffTerm{CUI: cui, Term: term})
+				isChanged = true
+			} else if !equalLines(lines, newTermLines) {
+				diff.ChangedTerms = append(diff.ChangedTerms, DiffTerm{CUI: cui, Term: term})
+				isChanged = true
+			}
+		}
+		for term := range newTerms {
+			if _, ok := oldTerms[term]; !ok {
+				diff.AddedTerms = append(diff.AddedTerms, DiffTerm{CUI: cui, Term: term})
+				isChanged = true
+			}
+		}
+		if isChanged {
+			diff.ChangedCUIs = append(diff.ChangedCUIs, cui)
+		}
+	}
+
+	for cui, newTerms := range newLines {
+		if _, ok := oldLines[cui]; ok {
+			continue
+		}
+		diff.AddedCUIs = append(diff.AddedCUIs, cui)
+		for term := range newTerms {
+			diff.AddedTerms = append(diff.AddedTerms, DiffTerm{CUI: cui, Term: term})
+		}
+	}
+
+	sort.Strings(diff.AddedCUIs)
+	sort.Strings(diff.RemovedCUIs)
+	sort.Strings(diff.ChangedCUIs)
+	sortDiffTerms(diff.AddedTerms)
+	sortDiffTerms(diff.RemovedTerms)
+	sortDiffTerms(diff.ChangedTerms)
+
+	return diff, nil
+}
+
+func equalLines(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sortDiffTerms(terms []DiffTerm) {
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].CUI != terms[j].CUI {
+			return terms[i].CUI < terms[j].CUI
+		}
+		return terms[i].Term < terms[j].Term
+	})
+}
@@ -0,0 +1,40 @@
+package lookup
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffDictionaries(t *testing.T) {
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "old.bsv")
+	newPath := filepath.Join(dir, "new.bsv")
+	require.NoError(t, os.WriteFile(oldPath, []byte(strings.Join([]string{
+		"C0032285|T047|SY|233604007|SNOMEDCT_US|pneumonia|Pneumonia",
+		"C0026769|T047|PT|24700007|SNOMEDCT_US|Multiple sclerosis|Multiple sclerosis",
+		"C0026769|T047|SY|24700007|SNOMEDCT_US|MS|Multiple sclerosis",
+		"C0000001|T047|PT|1|SNOMEDCT_US|Removed|Removed",
+	}, "\n")+"\n"), 0644))
+	require.NoError(t, os.WriteFile(newPath, []byte(strings.Join([]string{
+		"C0032285|T047|PT|233604007|SNOMEDCT_US|pneumonia|Pneumonia",
+		"C0026769|T047|PT|24700007|SNOMEDCT_US|Multiple sclerosis|Multiple sclerosis",
+		"C0026769|T047|SY|24700007|SNOMEDCT_US|MS|Multiple sclerosis",
+		"C0000002|T047|PT|2|SNOMEDCT_US|Added|Added",
+	}, "\n")+"\n"), 0644))
+
+	diff, err := DiffDictionaries(oldPath, newPath, []string{"CUI", "TUI", "TTY", "CODE", "SAB", "STR", "PREF"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"C0000002"}, diff.AddedCUIs)
+	require.Equal(t, []string{"C0000001"}, diff.RemovedCUIs)
+	require.Equal(t, []string{"C0032285"}, diff.ChangedCUIs)
+	require.Equal(t, []DiffTerm{{CUI: "C0000002", Term: "Added"}}, diff.AddedTerms)
+	require.Equal(t, []DiffTerm{{CUI: "C0000001", Term: "Removed"}}, diff.RemovedTerms)
+	require.Equal(t, []DiffTerm{{CUI: "C0032285", Term: "pneumonia"}}, diff.ChangedTerms)
+
+	diff, err = DiffDictionaries(oldPath, oldPath, []string{"CUI", "TUI", "TTY", "CODE", "SAB", "STR", "PREF"})
+	require.NoError(t, err)
+	require.True(t, diff.IsEmpty())
+}
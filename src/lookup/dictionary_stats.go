@@ -0,0 +1,128 @@
+package lookup
+
+import (
+	"text2phenotype.com/fdl/types"
+	"text2phenotype.com/fdl/utils"
+	"sort"
+	"strings"
+)
+
+type ValueCount struct {
+	Value string
+	Count int
+}
+
+type DictionaryStats struct {
+	Terms    int
+	Concepts int
+	SABs     []ValueCount
+	TTYs     []ValueCount
+	TUIs     []ValueCount
+
+	RareWords int
+	// count of the rare words by count of their terms
+	TermsPerRareWord map[int]int
+	// count of the terms by count of their tokens
+	TokensPerTerm map[int]int
+	// rare words with the most terms, they are the most expensive to look up
+	TopRareWords []ValueCount
+	// terms which are split differently by the runtime tokenizer, set only in the PTB mode
+	Tokenization TokenizationReport
+}
+
+// ComputeDictionaryStats reads the term dictionary and returns its column and rare word distributions
+func ComputeDictionaryStats(path string, scheme []string, casePolicy CasePolicy, analyzer TermAnalyzer, top int) (DictionaryStats, error) {
+	var stats DictionaryStats
+
+	var schemaMap = make(map[string]int)
+	for i, columnName := range scheme {
+		schemaMap[columnName] = i
+	}
+	cuiIdx := schemaMap[types.CUI]
+	strIdx := schemaMap[types.STR]
+
+	// terms are deduplicated the same way as the dictionary does, but the original case is kept for the output
+	reader, err := utils.NewCasedBSVReader(path, func(columns []string) uint64 {
+		if cuiIdx >= len(columns) || strIdx >= len(columns) {
+			// broken lines are skipped
+			return 0
+		}
+		key := columns[cuiIdx] + "_" + columns[strIdx]
+		if !casePolicy.IsEnabled() {
+			key = strings.ToLower(key)
+		}
+		return utils.HashString(key)
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	cuis := make(map[string]bool)
+	sabs := make(map[string]int)
+	ttys := make(map[string]int)
+	tuis := make(map[string]int)
+	countColumn := func(counts map[string]int, columnName string, columns []string) {
+		idx, ok := schemaMap[columnName]
+		if ok && idx < len(columns) {
+			counts[columns[idx]]++
+		}
+	}
+
+	for columns := range reader {
+		if cuiIdx >= len(columns) || strIdx >= len(columns) {
+			continue
+		}
+		stats.Terms++
+		cuis[columns[cuiIdx]] = true
+		countColumn(sabs, types.SAB, columns)
+		countColumn(ttys, types.TTY, columns)
+		if tuiIdx, ok := schemaMap[types.TUI]; ok && tuiIdx < len(columns) {
+			for _, tui := range parseTUIs(columns[tuiIdx]) {
+				tuis[tui]++
+			}
+		}
+	}
+	stats.Concepts = len(cuis)
+	stats.SABs = sortCounts(sabs, 0)
+	stats.TTYs = sortCounts(ttys, 0)
+	stats.TUIs = sortCounts(tuis, 0)
+
+	rwMap, report, err := BuildRareWordTermMap(path, scheme, casePolicy, analyzer)
+	if err != nil {
+		return stats, err
+	}
+	stats.Tokenization = report
+
+	stats.RareWords = rwMap.Len()
+	stats.TermsPerRareWord = make(map[int]int)
+	stats.TokensPerTerm = make(map[int]int)
+	rareWordTerms := make(map[string]int)
+	rwMap.ForEach(func(rareWord *string, terms []*RareWordTerm) {
+		stats.TermsPerRareWord[len(terms)]++
+		rareWordTerms[*rareWord] = len(terms)
+		for _, term := range terms {
+			stats.TokensPerTerm[term.GetTokenCount()]++
+		}
+	})
+	stats.TopRareWords = sortCounts(rareWordTerms, top)
+
+	return stats, nil
+}
+
+// sortCounts sorts values by count descending and by value, limit <= 0 returns all values
+func sortCounts(counts map[string]int, limit int) []ValueCount {
+	result := make([]ValueCount, 0, len(counts))
+	for value, count := range counts {
+		result = append(result, ValueCount{Value: value, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Value < result[j].Value
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
@@ -0,0 +1,222 @@
+package lookup
+
+import (
+	"text2phenotype.com/fdl/types"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// weights of the context and document evidence, the prior is added as is
+const (
+	contextWeight  = 1.0
+	documentWeight = 1.0
+
+	// support of the concept which is found elsewhere in the document only together with other candidates
+	ambiguousDocumentSupport = 0.5
+	// shorter words of the preferred texts are not used as context words
+	minContextWordLength = 3
+)
+
+var contextStopWords = map[string]bool{
+	"and": true, "the": true, "with": true, "without": true, "for": true, "from": true, "due": true,
+	"nos": true, "other": true, "unspecified": true, "not": true, "disorder": true, "finding": true,
+}
+
+// DisambiguationParams configure ranking of the concepts of the annotations. Priors are keyed by TUI (T047)
+// or by semantic group name (prob, symp, drug...), TUI priors win.
+type DisambiguationParams struct {
+	Enabled bool
+	KeepTop bool
+	Priors  map[string]float64
+}
+
+func NewDisambiguationParams(cfg types.FDLConfig) (DisambiguationParams, error) {
+	params := DisambiguationParams{
+		Enabled: cfg.Disambiguation,
+		KeepTop: cfg.DisambiguationKeepTop,
+		Priors:  make(map[string]float64),
+	}
+	for key, prior := range cfg.DisambiguationPriors {
+		if !isTUI(key) && !isSemanticGroupName(key) {
+			return params, fmt.Errorf("disambiguation prior key %q is neither TUI nor semantic group name", key)
+		}
+		params.Priors[strings.ToLower(key)] = prior
+	}
+	return params, nil
+}
+
+func isTUI(key string) bool {
+	if len(key) != 4 || (key[0] != 'T' && key[0] != 't') {
+		return false
+	}
+	for _, c := range key[1:] {
+		if !unicode.IsDigit(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func isSemanticGroupName(key string) bool {
+	_, ok := types.ParseSemantic(key)
+	return ok
+}
+
+// getPrior returns the highest prior of the concept TUIs
+func (params DisambiguationParams) getPrior(concept *types.Concept) float64 {
+	var result float64
+	isSet := false
+	for _, tui := range concept.TUI {
+		prior, ok := params.Priors[strings.ToLower(tui)]
+		if !ok {
+			prior, ok = params.Priors[GutTUISemanticGroupID(tui).Name()]
+		}
+		if ok && (!isSet || prior > result) {
+			result, isSet = prior, true
+		}
+	}
+	return result
+}
+
+// splitContextWords returns lower case words of the text which can be used as the context evidence
+func splitContextWords(text string) []string {
+	var result []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len(word) >= minContextWordLength && !contextStopWords[word] {
+			result = append(result, word)
+		}
+	}
+	return result
+}
+
+// documentConcepts counts for every CUI the spans of the document which have it as the only candidate or among others
+type documentConcepts struct {
+	unambiguous map[string]map[types.Span]bool
+	ambiguous   map[string]map[types.Span]bool
+}
+
+func collectDocumentConcepts(annotations []types.Annotation) documentConcepts {
+	result := documentConcepts{
+		unambiguous: make(map[string]map[types.Span]bool),
+		ambiguous:   make(map[string]map[types.Span]bool),
+	}
+	for _, ann := range annotations {
+		target := result.ambiguous
+		if len(ann.Concepts) == 1 {
+			target = result.unambiguous
+		}
+		span := types.Span{Begin: ann.Begin, End: ann.End}
+		for _, concept := range ann.Concepts {
+			spans, ok := target[*concept.CUI]
+			if !ok {
+				spans = make(map[types.Span]bool)
+				target[*concept.CUI] = spans
+			}
+			spans[span] = true
+		}
+	}
+	return result
+}
+
+// getSupport returns 1 if the CUI is the only candidate of another span of the document, ambiguousDocumentSupport
+// if it's one of the candidates of another span and 0 otherwise
+func (concepts documentConcepts) getSupport(cui string, span types.Span) float64 {
+	hasOther := func(spans map[types.Span]bool) bool {
+		for other := range spans {
+			if other != span {
+				return true
+			}
+		}
+		return false
+	}
+	if hasOther(concepts.unambiguous[cui]) {
+		return 1
+	}
+	if hasOther(concepts.ambiguous[cui]) {
+		return ambiguousDocumentSupport
+	}
+	return 0
+}
+
+// RankConcepts scores the concepts of every annotation of the document by the semantic priors, the words of their
+// preferred texts found in the sentence and the concepts found elsewhere in the document. Concepts are sorted by
+// score and their scores are set to ann.Scores, only the best concept is kept if KeepTop is set.
+func RankConcepts(annotations []types.Annotation, params DisambiguationParams) {
+	document := collectDocumentConcepts(annotations)
+	conceptWords := make(map[*types.Concept][]string)
+
+	for i := range annotations {
+		ann := &annotations[i]
+		if len(ann.Concepts) == 0 {
+			continue
+		}
+
+		spanWords := make(map[string]bool)
+		if ann.Text != nil {
+			for _, word := range splitContextWords(*ann.Text) {
+				spanWords[word] = true
+			}
+		}
+		sentenceWords := make(map[string]bool)
+		if ann.Sentence != nil {
+			for _, token := range ann.Sentence.Tokens {
+				if token.Text != nil {
+					sentenceWords[strings.ToLower(*token.Text)] = true
+				}
+				if token.Lemma != nil {
+					sentenceWords[strings.ToLower(*token.Lemma)] = true
+				}
+			}
+		}
+
+		span := types.Span{Begin: ann.Begin, End: ann.End}
+		scores := make(map[*types.Concept]float64, len(ann.Concepts))
+		for _, concept := range ann.Concepts {
+			words, ok := conceptWords[concept]
+			if !ok {
+				words = splitContextWords(concept.PrefText)
+				conceptWords[concept] = words
+			}
+
+			var contextWords, foundWords int
+			for _, word := range words {
+				if spanWords[word] {
+					continue
+				}
+				contextWords++
+				if sentenceWords[word] {
+					foundWords++
+				}
+			}
+			var context float64
+			if contextWords > 0 {
+				context = float64(foundWords) / float64(contextWords)
+			}
+
+			scores[concept] = params.getPrior(concept) +
+				contextWeight*context +
+				documentWeight*document.getSupport(*concept.CUI, span)
+		}
+
+		concepts := append([]*types.Concept(nil), ann.Concepts...)
+		sort.SliceStable(concepts, func(a, b int) bool {
+			if scores[concepts[a]] != scores[concepts[b]] {
+				return scores[concepts[a]] > scores[concepts[b]]
+			}
+			return *concepts[a].CUI < *concepts[b].CUI
+		})
+		if params.KeepTop {
+			concepts = concepts[:1]
+		}
+
+		ann.Concepts = concepts
+		ann.Scores = make([]float64, len(concepts))
+		for j, concept := range concepts {
+			ann.Scores[j] = scores[concept]
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package lookup
+
+import (
+	"text2phenotype.com/fdl/types"
+	"text2phenotype.com/fdl/utils"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func makeDisambiguationSentence(text string) *types.Sentence {
+	store := utils.GlobalStringStore()
+	sent := &types.Sentence{Span: types.Span{Text: &text}}
+	for _, word := range strings.Fields(text) {
+		sent.Tokens = append(sent.Tokens, &types.Token{Span: types.Span{Text: store.GetPointer(word)}})
+	}
+	return sent
+}
+
+func TestRankConcepts(t *testing.T) {
+	store := utils.GlobalStringStore()
+	commonCold := &types.Concept{CUI: store.GetPointer("c0009443"), PrefText: "Common Cold", TUI: []string{"T047"}}
+	coldTemperature := &types.Concept{CUI: store.GetPointer("c0009264"), PrefText: "Cold Temperature", TUI: []string{"T070"}}
+	copd := &types.Concept{CUI: store.GetPointer("c0024117"), PrefText: "Chronic Obstructive Airway Disease", TUI: []string{"T047"}}
+
+	cold := "cold"
+	makeAnnotation := func(sentence string, begin int32, concepts ...*types.Concept) types.Annotation {
+		return types.Annotation{
+			Span:     types.Span{Begin: begin, End: begin + 4, Text: &cold},
+			Concepts: concepts,
+			Sentence: makeDisambiguationSentence(sentence),
+		}
+	}
+
+	cfg := types.FDLConfig{DisambiguationPriors: map[string]float64{"prob": 0.1, "T070": 0.2}}
+	params, err := NewDisambiguationParams(cfg)
+	require.NoError(t, err)
+
+	// context words win over the priors
+	annotations := []types.Annotation{makeAnnotation("exposure to cold temperature", 0, commonCold, coldTemperature, copd)}
+	RankConcepts(annotations, params)
+	require.Equal(t, coldTemperature, annotations[0].Concepts[0])
+	require.Equal(t, []float64{1.2, 0.1, 0.1}, annotations[0].Scores)
+	require.Equal(t, commonCold, annotations[0].Concepts[1])
+
+	// the prior decides without the other evidence, the concept found elsewhere in the document wins
+	annotations = []types.Annotation{
+		makeAnnotation("she has a cold", 0, commonCold, coldTemperature, copd),
+		{Span: types.Span{Begin: 20, End: 24}, Concepts: []*types.Concept{copd}},
+	}
+	params.KeepTop = true
+	RankConcepts(annotations, params)
+	require.Equal(t, []*types.Concept{copd}, annotations[0].Concepts)
+	require.Equal(t, []float64{1.1}, annotations[0].Scores)
+
+	_, err = NewDisambiguationParams(types.FDLConfig{DisambiguationPriors: map[string]float64{"disease": 1}})
+	require.Error(t, err)
+}
@@ -0,0 +1,240 @@
+package lookup
+
+import (
+	"text2phenotype.com/fdl/types"
+	"text2phenotype.com/fdl/utils"
+	"fmt"
+)
+
+const (
+	MatchTypeFuzzy = "fuzzy"
+
+	maxFuzzyDistance       = 2
+	defaultFuzzyMinLength  = 5
+	fuzzyIndexPrefixLength = 7
+)
+
+type FuzzyParams struct {
+	MaxDistance int
+	MinLength   int
+}
+
+func NewFuzzyParams(cfg types.FDLConfig) (FuzzyParams, error) {
+	params := FuzzyParams{
+		MaxDistance: cfg.FuzzyMaxDistance,
+		MinLength:   cfg.FuzzyMinLength,
+	}
+
+	if params.MaxDistance < 0 || params.MaxDistance > maxFuzzyDistance {
+		return FuzzyParams{}, fmt.Errorf("fuzzy max distance must be between 0 and %d, got %d", maxFuzzyDistance, params.MaxDistance)
+	}
+
+	if params.MinLength <= 0 {
+		params.MinLength = defaultFuzzyMinLength
+	}
+
+	return params, nil
+}
+
+func (params FuzzyParams) IsEnabled() bool {
+	return params.MaxDistance > 0
+}
+
+// GetHashCode is used as a part of the fuzzy index cache key
+func (params FuzzyParams) GetHashCode() string {
+	return fmt.Sprintf("fuzzy%d_%d", params.MaxDistance, params.MinLength)
+}
+
+func (params FuzzyParams) isFuzzyWord(word string) bool {
+	return len([]rune(word)) >= params.MinLength && isRarableToken(&word)
+}
+
+// fuzzyWords are the known words of the dictionary and the deletion index of its rare words
+type fuzzyWords interface {
+	isKnown(word string) bool
+	// rareWords returns the rare words which have the delete
+	rareWords(del string) []*string
+	deleteCount() int
+}
+
+// FuzzyIndex is SymSpell-like deletion index over the rare words of the dictionary.
+// Only the first fuzzyIndexPrefixLength runes of the words are indexed, candidates are verified with the full edit distance.
+type FuzzyIndex struct {
+	params FuzzyParams
+	words  fuzzyWords
+}
+
+// fuzzyWordMaps keeps the deletion index in memory
+type fuzzyWordMaps struct {
+	deletes map[string][]*string
+	known   map[string]bool
+}
+
+func (maps *fuzzyWordMaps) isKnown(word string) bool {
+	return maps.known[word]
+}
+
+func (maps *fuzzyWordMaps) rareWords(del string) []*string {
+	return maps.deletes[del]
+}
+
+func (maps *fuzzyWordMaps) deleteCount() int {
+	return len(maps.deletes)
+}
+
+func buildFuzzyWordMaps(termIndex TermIndex, params FuzzyParams) *fuzzyWordMaps {
+	maps := fuzzyWordMaps{
+		deletes: make(map[string][]*string),
+		known:   make(map[string]bool),
+	}
+
+	termIndex.ForEach(func(rareWord *string, terms []*RareWordTerm) {
+		for _, term := range terms {
+			for _, token := range term.Tokens {
+				maps.known[*token] = true
+			}
+		}
+
+		if !params.isFuzzyWord(*rareWord) {
+			return
+		}
+
+		for del := range getDeletes(getPrefix(*rareWord), params.MaxDistance) {
+			maps.deletes[del] = append(maps.deletes[del], rareWord)
+		}
+	})
+
+	return &maps
+}
+
+// NewFuzzyIndex builds the deletion index in memory
+func NewFuzzyIndex(termIndex TermIndex, params FuzzyParams) *FuzzyIndex {
+	return &FuzzyIndex{params: params, words: buildFuzzyWordMaps(termIndex, params)}
+}
+
+// DeleteCount returns count of the indexed deletes
+func (index *FuzzyIndex) DeleteCount() int {
+	return index.words.deleteCount()
+}
+
+// Candidates returns rare words within the max edit distance (rare word -> distance) for the words which are not known by
+// the dictionary. If any of the words is known, the lookup is exact and nothing is returned.
+func (index *FuzzyIndex) Candidates(words []*string) map[*string]uint8 {
+	for _, word := range words {
+		if index.words.isKnown(*word) {
+			return nil
+		}
+	}
+
+	var result map[*string]uint8
+	// the binary index returns new pointers, so candidates are deduplicated by values
+	pointers := make(map[string]*string)
+	for _, word := range words {
+		if !index.params.isFuzzyWord(*word) {
+			continue
+		}
+
+		checked := make(map[string]bool)
+		for del := range getDeletes(getPrefix(*word), index.params.MaxDistance) {
+			for _, candidate := range index.words.rareWords(del) {
+				if checked[*candidate] {
+					continue
+				}
+				checked[*candidate] = true
+				if ptr, ok := pointers[*candidate]; ok {
+					candidate = ptr
+				} else {
+					pointers[*candidate] = candidate
+				}
+
+				distance := EditDistance(*word, *candidate, index.params.MaxDistance)
+				if distance <= 0 || distance > index.params.MaxDistance {
+					continue
+				}
+
+				if result == nil {
+					result = make(map[*string]uint8)
+				}
+				if current, ok := result[candidate]; !ok || uint8(distance) < current {
+					result[candidate] = uint8(distance)
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+func getPrefix(word string) string {
+	runes := []rune(word)
+	if len(runes) > fuzzyIndexPrefixLength {
+		return string(runes[:fuzzyIndexPrefixLength])
+	}
+	return word
+}
+
+func getDeletes(word string, maxDistance int) map[string]bool {
+	deletes := map[string]bool{word: true}
+	edits := []string{word}
+	for distance := 0; distance < maxDistance; distance++ {
+		var next []string
+		for _, edit := range edits {
+			runes := []rune(edit)
+			if len(runes) <= 1 {
+				continue
+			}
+			for i := range runes {
+				del := string(runes[:i]) + string(runes[i+1:])
+				if !deletes[del] {
+					deletes[del] = true
+					next = append(next, del)
+				}
+			}
+		}
+		edits = next
+	}
+	return deletes
+}
+
+// EditDistance calculates Damerau-Levenshtein (optimal string alignment) distance.
+// Returns maxDistance+1 when the distance is greater than maxDistance.
+func EditDistance(a string, b string, maxDistance int) int {
+	ra, rb := []rune(a), []rune(b)
+	if utils.AbsInt(len(ra)-len(rb)) > maxDistance {
+		return maxDistance + 1
+	}
+
+	prevPrev := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(minInt(prev[j]+1, curr[j-1]+1), prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				curr[j] = minInt(curr[j], prevPrev[j-2]+1)
+			}
+		}
+		prevPrev, prev, curr = prev, curr, prevPrev
+	}
+
+	if prev[len(rb)] > maxDistance {
+		return maxDistance + 1
+	}
+	return prev[len(rb)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
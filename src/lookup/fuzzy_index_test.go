@@ -0,0 +1,133 @@
+package lookup
+
+import (
+	"text2phenotype.com/fdl/types"
+	"text2phenotype.com/fdl/utils"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"pneumonia", "pneumonia", 0},
+		{"pnuemonia", "pneumonia", 1},
+		{"diabetis", "diabetes", 1},
+		{"hypertenstion", "hypertension", 1},
+		{"hypertnsion", "hypertension", 1},
+		{"pain", "cardiomyopathy", 3},
+	}
+
+	for _, tc := range testCases {
+		require.Equal(t, tc.expected, EditDistance(tc.a, tc.b, 2), tc.a)
+	}
+}
+
+func TestFuzzyIndexCandidates(t *testing.T) {
+	store := utils.GlobalStringStore()
+	pneumonia := store.GetPointer("pneumonia")
+	lobe := store.GetPointer("lobe")
+
+	rwMap := createRareWordMap([]*RareWordTerm{
+		{Tokens: []*string{pneumonia}, CUI: store.GetPointer("c0032285")},
+		{Tokens: []*string{lobe, pneumonia}, CUI: store.GetPointer("c0032300")},
+	})
+
+	index := NewFuzzyIndex(rwMap, FuzzyParams{MaxDistance: 2, MinLength: 5})
+
+	require.Equal(t, map[*string]uint8{pneumonia: 1}, index.Candidates([]*string{store.GetPointer("pnuemonia")}))
+	require.Nil(t, index.Candidates([]*string{pneumonia}))
+	require.Nil(t, index.Candidates([]*string{lobe}))
+	require.Nil(t, index.Candidates([]*string{store.GetPointer("fracture")}))
+}
+
+func TestBinaryFuzzyIndex(t *testing.T) {
+	store := utils.GlobalStringStore()
+	pneumonia := store.GetPointer("pneumonia")
+	lobe := store.GetPointer("lobe")
+	rwMap := createRareWordMap([]*RareWordTerm{
+		{Tokens: []*string{pneumonia}, CUI: store.GetPointer("c0032285")},
+		{Tokens: []*string{lobe, pneumonia}, CUI: store.GetPointer("c0032300")},
+		{Tokens: store.GetPointers([]string{"diabetes"}), CUI: store.GetPointer("c0011849")},
+	})
+	params := FuzzyParams{MaxDistance: 2, MinLength: 5}
+
+	data, err := EncodeFuzzyIndex(rwMap, params)
+	require.NoError(t, err)
+	binIndex, err := NewBinaryFuzzyIndex(data, params)
+	require.NoError(t, err)
+
+	memory := NewFuzzyIndex(rwMap, params)
+	index := &FuzzyIndex{params: params, words: binIndex}
+	require.Equal(t, memory.DeleteCount(), index.DeleteCount())
+	for _, word := range []string{"pnuemonia", "diabetis", "pneumonia", "lobe", "fracture"} {
+		words := []*string{store.GetPointer(word)}
+		expected := map[string]uint8{}
+		for candidate, distance := range memory.Candidates(words) {
+			expected[*candidate] = distance
+		}
+		actual := map[string]uint8{}
+		for candidate, distance := range index.Candidates(words) {
+			actual[*candidate] = distance
+		}
+		require.Equal(t, expected, actual, word)
+	}
+
+	_, err = NewBinaryFuzzyIndex(data, FuzzyParams{MaxDistance: 1, MinLength: 5})
+	require.Error(t, err)
+
+	for size := 0; size < len(data); size++ {
+		_, err := NewBinaryFuzzyIndex(data[:size], params)
+		require.Equal(t, ErrIndexFormat, err, "size %d", size)
+	}
+	corrupted := append([]byte{}, data...)
+	byteOrder.PutUint32(corrupted[binIndex.header.PostingsOffset:], binIndex.header.RareWordCount)
+	_, err = NewBinaryFuzzyIndex(corrupted, params)
+	require.Equal(t, ErrIndexFormat, err)
+}
+
+func TestFuzzyIndexIsCached(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "resources", "dictionaries", "test")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	path := filepath.Join(dir, "terms.bsv")
+	require.NoError(t, os.WriteFile(path, []byte("C0032285|Pneumonia\nC0026769|Multiple sclerosis\n"), 0644))
+
+	scheme := []string{types.CUI, types.STR}
+	casePolicy, err := NewCasePolicy(types.FDLConfig{})
+	require.NoError(t, err)
+	analyzer, err := NewTermAnalyzer(types.TermTokenizerRegex, nil, nil)
+	require.NoError(t, err)
+	params := FuzzyParams{MaxDistance: 2, MinLength: 5}
+	misspelled := utils.GlobalStringStore().GetPointers([]string{"pnuemonia"})
+
+	_, index, err := loadDictionary("test", path, scheme, casePolicy, analyzer, params)
+	require.NoError(t, err)
+	require.NoError(t, index.(io.Closer).Close())
+
+	nop := zerolog.Nop()
+	fuzzyPath, err := getDstFilepath(path, "CUISTR"+params.GetHashCode(), FuzzyIndexExt, &nop)
+	require.NoError(t, err)
+	data, err := os.ReadFile(fuzzyPath)
+	require.NoError(t, err)
+
+	// the cached index is opened, the corrupted one is rebuilt
+	for _, content := range [][]byte{data, data[:len(data)/2]} {
+		require.NoError(t, os.WriteFile(fuzzyPath, content, 0644))
+		dict, index, err := loadDictionary("test", path, scheme, casePolicy, analyzer, params)
+		require.NoError(t, err)
+		terms := collectTerms(dict(misspelled))
+		require.Len(t, terms, 1)
+		require.Equal(t, uint8(1), terms[0].EditDistance)
+		require.NoError(t, index.(io.Closer).Close())
+
+		rebuilt, err := os.ReadFile(fuzzyPath)
+		require.NoError(t, err)
+		require.Equal(t, data, rebuilt)
+	}
+}
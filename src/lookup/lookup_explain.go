@@ -0,0 +1,133 @@
+package lookup
+
+import (
+	"text2phenotype.com/fdl/utils"
+	"fmt"
+)
+
+// LookupHit describes a term returned by the dictionary for a phrase and whether the term matches the phrase tokens
+type LookupHit struct {
+	CUI          string
+	Tokens       []string
+	RareWord     string
+	EditDistance uint8
+	Matched      bool
+	// token offsets of the match in the phrase, End is exclusive
+	Begin  int
+	End    int
+	Reason string
+}
+
+// ExplainLookup tokenizes the phrase the same way as the dictionary terms, looks up all phrase tokens
+// in the dictionary and checks every returned term against the phrase. Lemma variants of the phrase tokens are
+// looked up as well in the PTB mode.
+func ExplainLookup(dict Dictionary, analyzer TermAnalyzer, phrase string) ([]string, []LookupHit, error) {
+	tokens, lemmas := analyzer.Tokenize(phrase)
+	words := utils.GlobalStringStore().GetPointers(tokens)
+
+	lemmaWords := make([]*string, len(words))
+	query := words
+	for i, lemma := range lemmas {
+		if len(lemma) > 0 {
+			lemmaWords[i] = utils.GlobalStringStore().GetPointer(lemma)
+			query = append(query[:len(query):len(query)], lemmaWords[i])
+		}
+	}
+
+	var hits []LookupHit
+	itr := dict(query)
+	for term, ok := itr(); ok; term, ok = itr() {
+		hits = append(hits, explainTerm(term, tokens, words, lemmaWords))
+	}
+
+	return tokens, hits, nil
+}
+
+func explainTerm(term *RareWordTerm, tokens []string, words []*string, lemmaWords []*string) LookupHit {
+	hit := LookupHit{
+		CUI:          *term.CUI,
+		RareWord:     *term.GetRareWord(),
+		EditDistance: term.EditDistance,
+		Begin:        -1,
+		End:          -1,
+	}
+	for _, token := range term.Tokens {
+		hit.Tokens = append(hit.Tokens, *token)
+	}
+
+	rareIdx := int(term.RareWordIndex)
+	for i, word := range words {
+		if !isRareWordMatch(term, word) && !isRareWordMatch(term, lemmaWords[i]) {
+			continue
+		}
+
+		reason := checkTermAt(term, tokens, words, lemmaWords, i-rareIdx)
+		if len(reason) == 0 {
+			hit.Matched = true
+			hit.Begin = i - rareIdx
+			hit.End = hit.Begin + term.GetTokenCount()
+			hit.Reason = "all tokens match"
+			if term.IsFuzzy() {
+				hit.Reason = fmt.Sprintf("all tokens match, rare word with edit distance %d", term.EditDistance)
+			} else if term.IsCaseSensitive() {
+				hit.Reason = "all tokens match with the exact case"
+			}
+			return hit
+		}
+
+		// the first failed position explains the miss
+		if len(hit.Reason) == 0 {
+			hit.Reason = reason
+		}
+	}
+
+	if len(hit.Reason) == 0 {
+		hit.Reason = fmt.Sprintf("rare word %q is not found in the phrase", hit.RareWord)
+	}
+	return hit
+}
+
+func isRareWordMatch(term *RareWordTerm, word *string) bool {
+	if word == nil {
+		return false
+	}
+	rareWord := term.GetRareWord()
+	if SameString(rareWord, word) || SameString(term.GetLemma(int(term.RareWordIndex)), word) {
+		return true
+	}
+	return term.IsFuzzy() && EditDistance(*rareWord, *word, int(term.EditDistance)) <= int(term.EditDistance)
+}
+
+// checkTermAt returns the reason why the term doesn't match the phrase starting from the token start
+// or empty string if it matches
+func checkTermAt(term *RareWordTerm, tokens []string, words []*string, lemmaWords []*string, start int) string {
+	if start < 0 {
+		return fmt.Sprintf("term starts %d token(s) before the phrase", -start)
+	}
+	if start+term.GetTokenCount() > len(words) {
+		return fmt.Sprintf("term ends %d token(s) after the phrase", start+term.GetTokenCount()-len(words))
+	}
+
+	for j, termToken := range term.Tokens {
+		idx := start + j
+		// rare word can be a fuzzy match
+		isMatch := isTokenMatch(term, j, words[idx]) || isTokenMatch(term, j, lemmaWords[idx]) ||
+			(j == int(term.RareWordIndex) && isRareWordMatch(term, words[idx]))
+		if !isMatch {
+			return fmt.Sprintf("token %d %q doesn't match term token %q", idx, tokens[idx], *termToken)
+		}
+
+		if term.IsCaseSensitive() && tokens[idx] != term.CasedTokens[j] {
+			return fmt.Sprintf("token %d %q doesn't match case sensitive term token %q", idx, tokens[idx], term.CasedTokens[j])
+		}
+	}
+
+	return ""
+}
+
+func isTokenMatch(term *RareWordTerm, tokenIdx int, word *string) bool {
+	if word == nil {
+		return false
+	}
+	return SameString(term.Tokens[tokenIdx], word) || SameString(term.GetLemma(tokenIdx), word)
+}
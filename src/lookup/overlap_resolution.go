@@ -0,0 +1,120 @@
+package lookup
+
+import (
+	"text2phenotype.com/fdl/types"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// OverlapStrategy decides which of the overlapping spans are kept
+type OverlapStrategy struct {
+	Name string
+	// semantic groups of the prefer_semantic strategy, the first one wins
+	Semantics []types.Semantic
+}
+
+// ParseOverlapStrategy parses the overlap_resolution value, prefer_semantic takes the list of semantic group
+// names as "prefer_semantic:[drug,prob]"
+func ParseOverlapStrategy(value string) (OverlapStrategy, error) {
+	name, list, hasList := strings.Cut(strings.TrimSpace(value), ":")
+	strategy := OverlapStrategy{Name: strings.ToLower(strings.TrimSpace(name))}
+
+	switch strategy.Name {
+	case types.OverlapResolutionAll, types.OverlapResolutionLongest, types.OverlapResolutionLongestAcrossGroups,
+		types.OverlapResolutionLeftmostLongest:
+		if hasList {
+			return strategy, fmt.Errorf("overlap resolution %q doesn't take parameters", strategy.Name)
+		}
+	case types.OverlapResolutionPreferSemantic:
+		list = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(list), "["), "]")
+		for _, semanticName := range strings.Split(list, ",") {
+			if semanticName = strings.TrimSpace(semanticName); len(semanticName) == 0 {
+				continue
+			}
+			semantic, ok := types.ParseSemantic(semanticName)
+			if !ok {
+				return strategy, fmt.Errorf("unknown semantic group %q of overlap resolution %q", semanticName, value)
+			}
+			strategy.Semantics = append(strategy.Semantics, semantic)
+		}
+		if len(strategy.Semantics) == 0 {
+			return strategy, fmt.Errorf("overlap resolution %q should list semantic groups", value)
+		}
+	default:
+		return strategy, fmt.Errorf("unknown overlap resolution %q", value)
+	}
+	return strategy, nil
+}
+
+// GetOverlapStrategy returns the strategy of the configuration, precision_mode is used if overlap_resolution is not set
+func GetOverlapStrategy(cfg types.FDLConfig) (OverlapStrategy, error) {
+	if len(cfg.OverlapResolution) > 0 {
+		return ParseOverlapStrategy(cfg.OverlapResolution)
+	}
+	if cfg.PrecisionMode {
+		return OverlapStrategy{Name: types.OverlapResolutionLongest}, nil
+	}
+	return OverlapStrategy{Name: types.OverlapResolutionAll}, nil
+}
+
+// CreateLeftmostLongestTerms keeps the spans which don't overlap the spans found before them going from left to
+// right, the longest span wins when several spans begin at the same token
+func CreateLeftmostLongestTerms(textSpans []types.Span, cuis [][]*string) ([]types.Span, [][]*string) {
+	order := make([]int, len(textSpans))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		spanA, spanB := textSpans[order[a]], textSpans[order[b]]
+		if spanA.Begin != spanB.Begin {
+			return spanA.Begin < spanB.Begin
+		}
+		return spanA.End > spanB.End
+	})
+
+	var resultSpans []types.Span
+	var resultCuis [][]*string
+	var lastEnd int32
+	for _, idx := range order {
+		if len(resultSpans) > 0 && textSpans[idx].Begin < lastEnd {
+			continue
+		}
+		resultSpans = append(resultSpans, textSpans[idx])
+		resultCuis = append(resultCuis, cuis[idx])
+		lastEnd = textSpans[idx].End
+	}
+	return resultSpans, resultCuis
+}
+
+// filterBySemanticPreference drops the annotations which overlap an annotation of the preferred semantic group,
+// groups which are not listed are preferred the least
+func filterBySemanticPreference(annotations []types.Annotation, semantics []types.Semantic) []types.Annotation {
+	getRank := func(semantic types.Semantic) int {
+		for i, preferred := range semantics {
+			if preferred == semantic {
+				return i
+			}
+		}
+		return len(semantics)
+	}
+
+	result := make([]types.Annotation, 0, len(annotations))
+	for i, ann := range annotations {
+		rank := getRank(ann.Semantic)
+		isDiscarded := false
+		for j, other := range annotations {
+			if i == j || other.Begin >= ann.End || ann.Begin >= other.End {
+				continue
+			}
+			if getRank(other.Semantic) < rank {
+				isDiscarded = true
+				break
+			}
+		}
+		if !isDiscarded {
+			result = append(result, ann)
+		}
+	}
+	return result
+}
@@ -0,0 +1,70 @@
+package lookup
+
+import (
+	"text2phenotype.com/fdl/types"
+	"text2phenotype.com/fdl/utils"
+	"github.com/stretchr/testify/require"
+	"sort"
+	"testing"
+)
+
+func TestParseOverlapStrategy(t *testing.T) {
+	strategy, err := ParseOverlapStrategy("prefer_semantic:[drug, prob]")
+	require.NoError(t, err)
+	require.Equal(t, OverlapStrategy{
+		Name:      types.OverlapResolutionPreferSemantic,
+		Semantics: []types.Semantic{types.SemanticDrug, types.SemanticDisorder},
+	}, strategy)
+
+	for _, value := range []string{"shortest", "prefer_semantic", "prefer_semantic:[drug,food]", "longest:[drug]"} {
+		_, err = ParseOverlapStrategy(value)
+		require.Error(t, err, value)
+	}
+
+	strategy, err = GetOverlapStrategy(types.FDLConfig{PrecisionMode: true})
+	require.NoError(t, err)
+	require.Equal(t, types.OverlapResolutionLongest, strategy.Name)
+	strategy, err = GetOverlapStrategy(types.FDLConfig{PrecisionMode: true, OverlapResolution: "all"})
+	require.NoError(t, err)
+	require.Equal(t, types.OverlapResolutionAll, strategy.Name)
+}
+
+func TestOverlapStrategies(t *testing.T) {
+	store := utils.GlobalStringStore()
+	text := "left knee pain"
+	spans := []types.Span{
+		{Begin: 0, End: 9},
+		{Begin: 5, End: 9},
+		{Begin: 5, End: 14},
+		{Begin: 10, End: 14},
+	}
+	semantics := []types.Semantic{types.SemanticAnatomicalSite, types.SemanticDisorder, types.SemanticFinding, types.SemanticFinding}
+
+	var cuis [][]*string
+	conceptMap := make(map[*string]SemanticConcepts)
+	for i := range spans {
+		spanText := text[spans[i].Begin:spans[i].End]
+		spans[i].Text = &spanText
+		cui := store.GetPointer(spanText + semantics[i].Name())
+		cuis = append(cuis, []*string{cui})
+		conceptMap[cui] = SemanticConcepts{semantics[i]: &types.Concept{CUI: cui}}
+	}
+
+	consume := func(value string) []string {
+		strategy, err := ParseOverlapStrategy(value)
+		require.NoError(t, err)
+		var result []string
+		for _, ann := range CreateConsumer(strategy)(spans, cuis, conceptMap) {
+			result = append(result, *ann.Text+"/"+ann.Semantic.Name())
+		}
+		sort.Strings(result)
+		return result
+	}
+
+	require.Equal(t, []string{"knee pain/symp", "knee/prob", "left knee/anat", "pain/symp"}, consume("all"))
+	require.Equal(t, []string{"knee pain/symp", "knee/prob", "left knee/anat"}, consume("longest"))
+	require.Equal(t, []string{"knee pain/symp", "left knee/anat"}, consume("longest_across_groups"))
+	require.Equal(t, []string{"left knee/anat", "pain/symp"}, consume("leftmost_longest"))
+	require.Equal(t, []string{"knee pain/symp"}, consume("prefer_semantic:[symp,anat]"))
+	require.Equal(t, []string{"knee/prob"}, consume("prefer_semantic:[prob]"))
+}
@@ -0,0 +1,462 @@
+package lookup
+
+import (
+	"bufio"
+	"text2phenotype.com/fdl/logger"
+	"text2phenotype.com/fdl/types"
+	"text2phenotype.com/fdl/utils"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// UserDictionarySource is the source of the terms which come from the user dictionary
+const UserDictionarySource = "user_dictionary"
+
+// UserDictionaryScheme is the column scheme of the user dictionary files
+var UserDictionaryScheme = []string{types.CUI, types.TUI, types.TTY, types.CODE, types.SAB, types.STR, types.PREF}
+
+// UserTerm is a site specific term of the user dictionary
+type UserTerm struct {
+	CUI  string `json:"cui"`
+	TUI  string `json:"tui"`
+	TTY  string `json:"tty,omitempty"`
+	Code string `json:"code,omitempty"`
+	SAB  string `json:"sab,omitempty"`
+	Term string `json:"term"`
+	Pref string `json:"pref,omitempty"`
+}
+
+func (term UserTerm) validate() error {
+	if len(term.CUI) == 0 || len(term.TUI) == 0 || len(strings.TrimSpace(term.Term)) == 0 {
+		return fmt.Errorf("user term %q must have CUI, TUI and term", term.Term)
+	}
+	for _, value := range []string{term.CUI, term.TUI, term.TTY, term.Code, term.SAB, term.Term, term.Pref} {
+		if strings.ContainsAny(value, "|\n\r") {
+			return fmt.Errorf("user term %q must not contain '|' or line breaks", term.Term)
+		}
+	}
+	return nil
+}
+
+func (term UserTerm) getKey() string {
+	return strings.ToLower(term.CUI + "|" + term.Term)
+}
+
+func (term UserTerm) getLine() string {
+	pref := term.Pref
+	if len(pref) == 0 {
+		pref = term.Term
+	}
+	return strings.Join([]string{term.CUI, term.TUI, term.TTY, term.Code, term.SAB, term.Term, pref}, "|")
+}
+
+func parseUserTerm(line string) (UserTerm, error) {
+	columns := strings.Split(line, "|")
+	if len(columns) != len(UserDictionaryScheme) {
+		return UserTerm{}, fmt.Errorf("user dictionary line has %d columns, expected %s", len(columns), strings.Join(UserDictionaryScheme, "|"))
+	}
+	term := UserTerm{
+		CUI:  columns[0],
+		TUI:  columns[1],
+		TTY:  columns[2],
+		Code: columns[3],
+		SAB:  columns[4],
+		Term: columns[5],
+		Pref: columns[6],
+	}
+	return term, term.validate()
+}
+
+// overlayIndex is keyed by strings, because the string store is locked when the user dictionary is updated
+type overlayIndex map[string][]*RareWordTerm
+
+func (index overlayIndex) Terms(rareWord *string) []*RareWordTerm {
+	return index[*rareWord]
+}
+
+func (index overlayIndex) ForEach(f func(rareWord *string, terms []*RareWordTerm)) {
+	for rareWord, terms := range index {
+		key := rareWord
+		f(&key, terms)
+	}
+}
+
+func (index overlayIndex) Len() int {
+	return len(index)
+}
+
+type overlaySnapshot struct {
+	terms    []UserTerm
+	index    overlayIndex
+	concepts map[string][]string // lower case CUI -> concept lines
+}
+
+func newOverlaySnapshot(terms []UserTerm, casePolicy CasePolicy, analyzer TermAnalyzer) *overlaySnapshot {
+	// strings are interned locally, the global store returns new pointers when it's locked
+	pointers := make(map[string]*string)
+	intern := func(s string) *string {
+		s = strings.ToLower(s)
+		ptr, ok := pointers[s]
+		if !ok {
+			ptr = utils.GlobalStringStore().GetPointer(s)
+			pointers[s] = ptr
+		}
+		return ptr
+	}
+
+	rareWords := make([]*RareWordTerm, 0, len(terms))
+	concepts := make(map[string][]string)
+	for _, term := range terms {
+		text := term.Term
+		if !casePolicy.IsEnabled() {
+			text = strings.ToLower(text)
+		}
+		rareWordTerm := createRareWordTerm(term.CUI, text, analyzer, casePolicy, intern)
+		if rareWordTerm == nil {
+			continue
+		}
+		rareWordTerm.Source = UserDictionarySource
+
+		cui := rareWordTerm.CUI
+		rareWords = append(rareWords, rareWordTerm)
+		concepts[*cui] = append(concepts[*cui], strings.ToLower(term.getLine()))
+	}
+
+	index := make(overlayIndex)
+	createRareWordMap(rareWords).ForEach(func(rareWord *string, terms []*RareWordTerm) {
+		index[*rareWord] = terms
+	})
+
+	return &overlaySnapshot{
+		terms:    terms,
+		index:    index,
+		concepts: concepts,
+	}
+}
+
+// Overlay is a small user dictionary of the configuration which is merged with the main dictionary and
+// concept factory at query time. It's loaded from the BSV file in UserDictionaryScheme and can be updated
+// without restart, the updates are saved to the file.
+type Overlay struct {
+	configName string
+	path       string
+	casePolicy CasePolicy
+	analyzer   TermAnalyzer
+
+	// serializes updates, lookups read the current snapshot without locks
+	mu       sync.Mutex
+	snapshot atomic.Value // *overlaySnapshot
+	modTime  time.Time
+}
+
+// NewOverlay creates the user dictionary, the file is optional and it's created on the first update
+func NewOverlay(configName string, path string, casePolicy CasePolicy, analyzer TermAnalyzer) (*Overlay, error) {
+	overlay := &Overlay{
+		configName: configName,
+		path:       path,
+		casePolicy: casePolicy,
+		analyzer:   analyzer,
+	}
+	overlay.snapshot.Store(newOverlaySnapshot(nil, casePolicy, analyzer))
+
+	if len(path) > 0 {
+		if err := overlay.Reload(); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return overlay, nil
+}
+
+func (overlay *Overlay) getSnapshot() *overlaySnapshot {
+	return overlay.snapshot.Load().(*overlaySnapshot)
+}
+
+func (overlay *Overlay) ConfigName() string {
+	return overlay.configName
+}
+
+func (overlay *Overlay) Path() string {
+	return overlay.path
+}
+
+// Terms returns a copy of the user terms
+func (overlay *Overlay) Terms() []UserTerm {
+	terms := overlay.getSnapshot().terms
+	result := make([]UserTerm, len(terms))
+	copy(result, terms)
+	return result
+}
+
+// Reload reads the user dictionary file
+func (overlay *Overlay) Reload() error {
+	overlay.mu.Lock()
+	defer overlay.mu.Unlock()
+
+	info, err := os.Stat(overlay.path)
+	if err != nil {
+		return err
+	}
+	terms, err := readUserTerms(overlay.path)
+	if err != nil {
+		return err
+	}
+	if err := overlay.setTerms(terms); err != nil {
+		return err
+	}
+	overlay.modTime = info.ModTime()
+
+	fdlLogger := logger.NewLogger("User dictionary")
+	fdlLogger.Info().
+		Str("config_name", overlay.configName).
+		Str("path", overlay.path).
+		Msgf("Loaded %d user terms", len(terms))
+	return nil
+}
+
+// Replace replaces all user terms
+func (overlay *Overlay) Replace(terms []UserTerm) error {
+	overlay.mu.Lock()
+	defer overlay.mu.Unlock()
+
+	return overlay.update(mergeUserTerms(nil, terms))
+}
+
+// Add adds user terms, the terms with the same CUI and text are replaced
+func (overlay *Overlay) Add(terms []UserTerm) error {
+	overlay.mu.Lock()
+	defer overlay.mu.Unlock()
+
+	return overlay.update(mergeUserTerms(overlay.getSnapshot().terms, terms))
+}
+
+// Remove removes the user terms by CUI and text, empty text removes all terms of the CUI. Returns count of the removed terms.
+func (overlay *Overlay) Remove(cui string, term string) (int, error) {
+	overlay.mu.Lock()
+	defer overlay.mu.Unlock()
+
+	current := overlay.getSnapshot().terms
+	terms := make([]UserTerm, 0, len(current))
+	for _, userTerm := range current {
+		isMatch := strings.EqualFold(userTerm.CUI, cui) && (len(term) == 0 || strings.EqualFold(userTerm.Term, term))
+		if !isMatch {
+			terms = append(terms, userTerm)
+		}
+	}
+
+	removed := len(current) - len(terms)
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, overlay.update(terms)
+}
+
+func mergeUserTerms(current []UserTerm, added []UserTerm) []UserTerm {
+	positions := make(map[string]int)
+	result := make([]UserTerm, 0, len(current)+len(added))
+	for _, terms := range [][]UserTerm{current, added} {
+		for _, term := range terms {
+			if idx, ok := positions[term.getKey()]; ok {
+				result[idx] = term
+				continue
+			}
+			positions[term.getKey()] = len(result)
+			result = append(result, term)
+		}
+	}
+	return result
+}
+
+// update validates and saves the terms, the caller must hold the lock
+func (overlay *Overlay) update(terms []UserTerm) error {
+	for _, term := range terms {
+		if err := term.validate(); err != nil {
+			return err
+		}
+	}
+
+	if len(overlay.path) > 0 {
+		if err := writeUserTerms(overlay.path, terms); err != nil {
+			return err
+		}
+		if info, err := os.Stat(overlay.path); err == nil {
+			overlay.modTime = info.ModTime()
+		}
+	}
+
+	return overlay.setTerms(terms)
+}
+
+func (overlay *Overlay) setTerms(terms []UserTerm) error {
+	overlay.snapshot.Store(newOverlaySnapshot(terms, overlay.casePolicy, overlay.analyzer))
+	return nil
+}
+
+// Watch reloads the user dictionary when its file is changed until stop is closed
+func (overlay *Overlay) Watch(interval time.Duration, stop <-chan struct{}) {
+	if len(overlay.path) == 0 {
+		return
+	}
+
+	fdlLogger := logger.NewLogger("User dictionary").With().
+		Str("config_name", overlay.configName).
+		Str("path", overlay.path).Logger()
+	errLogger := fdlLogger.With().Caller().Logger()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			info, err := os.Stat(overlay.path)
+			if err != nil {
+				continue
+			}
+			overlay.mu.Lock()
+			isChanged := !info.ModTime().Equal(overlay.modTime)
+			overlay.mu.Unlock()
+			if !isChanged {
+				continue
+			}
+			if err := overlay.Reload(); err != nil {
+				errLogger.Err(err).Msg("Could not reload user dictionary, previous version is used")
+			}
+		}
+	}
+}
+
+// Dictionary merges the user terms with the terms of the main dictionary
+func (overlay *Overlay) Dictionary(dict Dictionary) Dictionary {
+	return func(words []*string) MapListIterator {
+		itr := dict(words)
+		index := overlay.getSnapshot().index
+		if len(index) == 0 {
+			return itr
+		}
+
+		userItr := CreateMapListIterator(index, words)
+		return func() (*RareWordTerm, bool) {
+			if term, ok := itr(); ok {
+				return term, true
+			}
+			return userItr()
+		}
+	}
+}
+
+// ConceptFactory creates concepts of the user dictionary CUIs which are not known by the main concept factory
+func (overlay *Overlay) ConceptFactory(factory ConceptFactory) ConceptFactory {
+	// STR is ignored the same way as concept_params_ignore: [STR] of the configurations
+	schemaMap := make(map[string]int)
+	for i, columnName := range UserDictionaryScheme {
+		if columnName != types.STR {
+			schemaMap[columnName] = i
+		}
+	}
+
+	return func(cuis []*string) (map[*string]SemanticConcepts, error) {
+		result, err := factory(cuis)
+		if err != nil {
+			return nil, err
+		}
+
+		concepts := overlay.getSnapshot().concepts
+		if len(concepts) == 0 {
+			return result, nil
+		}
+
+		for _, cui := range cuis {
+			lines, ok := concepts[*cui]
+			if !ok || len(result[cui]) > 0 {
+				continue
+			}
+			cuiSemantics, err := createSemanticConcepts(cui, lines, schemaMap)
+			if err != nil {
+				return nil, err
+			}
+			result[cui] = cuiSemantics
+		}
+		return result, nil
+	}
+}
+
+func readUserTerms(path string) ([]UserTerm, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var terms []UserTerm
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		term, err := parseUserTerm(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNum, err)
+		}
+		terms = append(terms, term)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return mergeUserTerms(nil, terms), nil
+}
+
+func writeUserTerms(path string, terms []UserTerm) error {
+	var sb strings.Builder
+	sb.WriteString("# " + strings.Join(UserDictionaryScheme, "|") + "\n")
+	for _, term := range terms {
+		sb.WriteString(term.getLine() + "\n")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(sb.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+var overlays sync.Map // config name -> *Overlay
+
+var ErrUnknownOverlay = errors.New("user dictionary of the configuration is not found")
+
+// RegisterOverlay makes the user dictionary of the configuration available for the admin API
+func RegisterOverlay(overlay *Overlay) {
+	overlays.Store(overlay.configName, overlay)
+}
+
+func GetOverlay(configName string) (*Overlay, error) {
+	overlay, ok := overlays.Load(configName)
+	if !ok {
+		return nil, ErrUnknownOverlay
+	}
+	return overlay.(*Overlay), nil
+}
+
+// GetOverlayNames returns sorted names of the configurations with user dictionaries
+func GetOverlayNames() []string {
+	var names []string
+	overlays.Range(func(key, value interface{}) bool {
+		names = append(names, key.(string))
+		return true
+	})
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,71 @@
+package lookup
+
+import (
+	"text2phenotype.com/fdl/types"
+	"text2phenotype.com/fdl/utils"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func collectTerms(itr MapListIterator) []*RareWordTerm {
+	var result []*RareWordTerm
+	for term, ok := itr(); ok; term, ok = itr() {
+		result = append(result, term)
+	}
+	return result
+}
+
+func TestOverlay(t *testing.T) {
+	store := utils.GlobalStringStore()
+	rwMap := createRareWordMap([]*RareWordTerm{
+		{Tokens: store.GetPointers([]string{"pneumonia"}), CUI: store.GetPointer("c0032285")},
+	})
+	dict := func(words []*string) MapListIterator {
+		return CreateMapListIterator(rwMap, words)
+	}
+	factory := func(cuis []*string) (map[*string]SemanticConcepts, error) {
+		result := make(map[*string]SemanticConcepts)
+		for _, cui := range cuis {
+			result[cui] = make(SemanticConcepts)
+		}
+		return result, nil
+	}
+
+	path := filepath.Join(t.TempDir(), "user.bsv")
+	require.NoError(t, os.WriteFile(path, []byte("# comment\nC0010055|T061|PT|CABG|LOCAL|CABG x3|Coronary artery bypass graft\n"), 0644))
+
+	casePolicy, err := NewCasePolicy(types.FDLConfig{})
+	require.NoError(t, err)
+	analyzer, err := NewTermAnalyzer(types.TermTokenizerRegex, nil, nil)
+	require.NoError(t, err)
+	overlay, err := NewOverlay("test", path, casePolicy, analyzer)
+	require.NoError(t, err)
+	require.Len(t, overlay.Terms(), 1)
+
+	merged := overlay.Dictionary(dict)
+	terms := collectTerms(merged(store.GetPointers([]string{"cabg", "x3", "pneumonia"})))
+	require.Len(t, terms, 2)
+	require.Equal(t, "c0032285", *terms[0].CUI)
+	require.Empty(t, terms[0].Source)
+	require.Equal(t, "c0010055", *terms[1].CUI)
+	require.Equal(t, UserDictionarySource, terms[1].Source)
+
+	concepts, err := overlay.ConceptFactory(factory)([]*string{terms[1].CUI})
+	require.NoError(t, err)
+	require.Equal(t, "coronary artery bypass graft", concepts[terms[1].CUI][types.SemanticProcedure].PrefText)
+
+	require.Error(t, overlay.Add([]UserTerm{{CUI: "C0000001", Term: "no tui"}}))
+	require.NoError(t, overlay.Add([]UserTerm{{CUI: "C0000002", TUI: "T121", Term: "Zeltrix"}}))
+	require.Len(t, collectTerms(merged(store.GetPointers([]string{"zeltrix"}))), 1)
+
+	// updates are saved and survive reload
+	require.NoError(t, overlay.Reload())
+	require.Len(t, overlay.Terms(), 2)
+
+	removed, err := overlay.Remove("c0010055", "")
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+	require.Empty(t, collectTerms(merged(store.GetPointers([]string{"cabg"}))))
+}
@@ -1,8 +1,8 @@
 package lookup
 
 import (
+	"text2phenotype.com/fdl/types"
 	"text2phenotype.com/fdl/utils"
-	"encoding/json"
 )
 
 type RareWordTerm struct {
@@ -10,6 +10,14 @@ type RareWordTerm struct {
 	TextLength    uint32
 	CUI           *string
 	RareWordIndex byte
+	// original case of the tokens, is set only for terms which have to be matched with the exact case
+	CasedTokens []string `json:",omitempty"`
+	// lemma variants of the tokens, nil lemma means the token is its own lemma. Set only by the PTB term tokenizer.
+	Lemmas []*string `json:",omitempty"`
+	// edit distance between the rare word and the looked up word, is set only for fuzzy hits
+	EditDistance uint8 `json:"-"`
+	// dictionary the term comes from, is set only for the user dictionary terms
+	Source string `json:"-"`
 }
 
 func (term *RareWordTerm) GetHashCode() uint64 {
@@ -27,90 +35,72 @@ func (term *RareWordTerm) GetRareWord() *string {
 	return term.Tokens[term.RareWordIndex]
 }
 
+func (term *RareWordTerm) IsCaseSensitive() bool {
+	return len(term.CasedTokens) > 0
+}
+
+// MatchesCase checks the original case of the token against the term token with index tokenIdx
+func (term *RareWordTerm) MatchesCase(tokenIdx int, token *types.Token) bool {
+	if !term.IsCaseSensitive() {
+		return true
+	}
+	return token.GetShapedText() == term.CasedTokens[tokenIdx]
+}
+
+// GetLemma returns the lemma variant of the token with index tokenIdx or nil
+func (term *RareWordTerm) GetLemma(tokenIdx int) *string {
+	if tokenIdx >= len(term.Lemmas) {
+		return nil
+	}
+	return term.Lemmas[tokenIdx]
+}
+
+// MatchesToken checks the token against the term token with index tokenIdx and its lemma variant
+func (term *RareWordTerm) MatchesToken(tokenIdx int, token *types.Token) bool {
+	termToken := term.Tokens[tokenIdx]
+	isMatch := SameString(termToken, token.Text) || SameString(termToken, token.Lemma)
+	if lemma := term.GetLemma(tokenIdx); !isMatch && lemma != nil {
+		isMatch = SameString(lemma, token.Text) || SameString(lemma, token.Lemma)
+	}
+	return isMatch && term.MatchesCase(tokenIdx, token)
+}
+
+func (term *RareWordTerm) IsFuzzy() bool {
+	return term.EditDistance > 0
+}
+
 func (term *RareWordTerm) GetTokenCount() int {
 	return len(term.Tokens)
 }
 
 type MapListIterator func() (*RareWordTerm, bool)
 
-func CreateMapListIterator(m map[*string][]*RareWordTerm, keys []*string) MapListIterator {
-	currentKey := 0
-	cursor := 0
-
-	var actualKeys []*string
-	for _, k := range keys {
-		if _, hasKey := m[k]; hasKey {
-			actualKeys = append(actualKeys, k)
+func CreateMapListIterator(index TermIndex, keys []*string) MapListIterator {
+	var terms []*RareWordTerm
+	for i, k := range keys {
+		isDuplicate := false
+		for _, prev := range keys[:i] {
+			if SameString(prev, k) {
+				isDuplicate = true
+				break
+			}
+		}
+		if !isDuplicate {
+			terms = append(terms, index.Terms(k)...)
 		}
 	}
 
-	l := len(actualKeys)
+	cursor := 0
 
 	return func() (*RareWordTerm, bool) {
-
-		if l == 0 {
+		if cursor >= len(terms) {
 			return nil, false
 		}
 
-		key := actualKeys[currentKey]
-
-		if cursor >= len(m[key]) {
-			cursor = 0
-			currentKey = currentKey + 1
-
-			if currentKey >= l {
-				return nil, false
-			}
-			key = actualKeys[currentKey]
-		}
-
-		value := *m[key][cursor]
+		value := *terms[cursor]
 		cursor = cursor + 1
 		return &value, true
 	}
 }
 
 type RareWordTermMap map[*string][]*RareWordTerm
-
-func (rw RareWordTermMap) MarshalJSON() ([]byte, error) {
-	out := make(map[string][]*RareWordTerm)
-	for k, v := range rw {
-		out[*k] = v
-	}
-	res, err := json.Marshal(out)
-	if err != nil {
-		return nil, err
-	}
-	return res, nil
-}
-
-func (rw RareWordTermMap) UnmarshalJSON(data []byte) error {
-	ss := make(map[string][]*RareWordTerm)
-	err := json.Unmarshal(data, &ss)
-	if err != nil {
-		return err
-	}
-
-	localStore := make(map[string]*string)
-	getPtr := func(s string) *string {
-		ptr, isOk := localStore[s]
-		if !isOk {
-			ptr = utils.GlobalStringStore().GetPointer(s)
-			localStore[s] = ptr
-		}
-
-		return ptr
-	}
-
-	for k, v := range ss {
-		k_ptr := getPtr(k)
-		for _, rWord := range v {
-			rWord.CUI = getPtr(*rWord.CUI)
-			for ti, token := range rWord.Tokens {
-				rWord.Tokens[ti] = getPtr(*token)
-			}
-		}
-		rw[k_ptr] = v
-	}
-	return nil
-}
@@ -67,6 +67,11 @@ func createRareWordMap(rareWords []*RareWordTerm) RareWordTermMap {
 		}
 
 		termMap[rareWordHash] = rareWordTerms
+
+		// the term is found by the lemma of the rare word as well
+		if lemma := term.GetLemma(int(term.RareWordIndex)); lemma != nil && !SameString(lemma, rareWordHash) {
+			termMap[lemma] = append(termMap[lemma], term)
+		}
 	}
 	return termMap
 }
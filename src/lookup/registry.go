@@ -0,0 +1,219 @@
+package lookup
+
+import (
+	"text2phenotype.com/fdl/logger"
+	"text2phenotype.com/fdl/utils"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+var registryInstance *Registry
+var registryInitializer sync.Once
+
+type registryEntry struct {
+	ready   chan struct{}
+	dict    Dictionary
+	factory ConceptFactory
+	matcher TermMatcher
+	closer  io.Closer
+	err     error
+	refs    int
+	size    int64
+}
+
+// Registry shares dictionaries and concept factories between configurations. Entries are keyed by the dictionary
+// file content and the parameters which change the index, each unique entry is loaded once and released when
+// the last configuration which uses it releases it.
+type Registry struct {
+	mu      sync.Mutex
+	entries map[string]*registryEntry
+}
+
+type RegistryStats struct {
+	Entries    int
+	References int
+	// approximate memory which would be used by the duplicated dictionaries
+	SavedBytes int64
+}
+
+func NewRegistry() *Registry {
+	return &Registry{entries: make(map[string]*registryEntry)}
+}
+
+func GlobalRegistry() *Registry {
+	registryInitializer.Do(func() {
+		registryInstance = NewRegistry()
+	})
+
+	return registryInstance
+}
+
+// acquire returns entry for the key, the first caller loads the entry and others wait until it's loaded
+func (registry *Registry) acquire(key string, load func(entry *registryEntry)) (*registryEntry, func(), error) {
+	registry.mu.Lock()
+	entry, ok := registry.entries[key]
+	if !ok {
+		entry = &registryEntry{ready: make(chan struct{})}
+		registry.entries[key] = entry
+	}
+	entry.refs++
+	registry.mu.Unlock()
+
+	if !ok {
+		loadEntry(entry, load)
+	} else {
+		<-entry.ready
+	}
+
+	var releaseOnce sync.Once
+	release := func() {
+		releaseOnce.Do(func() {
+			registry.release(key, entry)
+		})
+	}
+
+	if entry.err != nil {
+		release()
+		return nil, nil, entry.err
+	}
+
+	return entry, release, nil
+}
+
+// loadEntry loads the entry and marks it as ready, the panic of the loader becomes the error of the entry,
+// so the callers waiting for the entry never block forever
+func loadEntry(entry *registryEntry, load func(entry *registryEntry)) {
+	defer close(entry.ready)
+	defer utils.RecoverWithError(&entry.err)
+	load(entry)
+}
+
+func (registry *Registry) release(key string, entry *registryEntry) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	entry.refs--
+	if entry.refs > 0 {
+		return
+	}
+
+	if registry.entries[key] == entry {
+		delete(registry.entries, key)
+	}
+	if entry.closer != nil {
+		if err := entry.closer.Close(); err != nil {
+			fdlLogger := logger.NewLogger("Registry")
+			fdlLogger.Err(err).Str("key", key).Msg("Could not close index")
+		}
+	}
+}
+
+func getIndexSize(index interface{}, path string) int64 {
+	if sized, ok := index.(interface{ Size() int }); ok {
+		return int64(sized.Size())
+	}
+	if info, err := os.Stat(path); err == nil {
+		return info.Size()
+	}
+	return 0
+}
+
+// AcquireDictionary returns shared dictionary and the function to release it
+func (registry *Registry) AcquireDictionary(configName string, path string, scheme []string, casePolicy CasePolicy, analyzer TermAnalyzer, fuzzyParams FuzzyParams) (Dictionary, func(), error) {
+	fileHash, err := getFileHash(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := fmt.Sprintf("dict|%s|%s|%s|%s|%d|%d", fileHash, strings.Join(scheme, "|"), casePolicy.GetHashCode(),
+		analyzer.Mode, fuzzyParams.MaxDistance, fuzzyParams.MinLength)
+
+	entry, release, err := registry.acquire(key, func(entry *registryEntry) {
+		dict, index, err := loadDictionary(configName, path, scheme, casePolicy, analyzer, fuzzyParams)
+		entry.dict, entry.err = dict, err
+		if err != nil {
+			return
+		}
+		if closer, ok := index.(io.Closer); ok {
+			entry.closer = closer
+		}
+		entry.size = getIndexSize(index, path)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return entry.dict, release, nil
+}
+
+// AcquireTermMatcher returns shared term trie of the dictionary and the function to release it
+func (registry *Registry) AcquireTermMatcher(configName string, path string, scheme []string, casePolicy CasePolicy, analyzer TermAnalyzer) (TermMatcher, func(), error) {
+	fileHash, err := getFileHash(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := fmt.Sprintf("trie|%s|%s|%s|%s", fileHash, strings.Join(scheme, "|"), casePolicy.GetHashCode(), analyzer.Mode)
+
+	entry, release, err := registry.acquire(key, func(entry *registryEntry) {
+		trie, err := loadTermTrie(configName, path, scheme, casePolicy, analyzer)
+		entry.err = err
+		if err != nil {
+			return
+		}
+		entry.matcher = trie.Match
+		entry.size = int64(trie.Size())
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return entry.matcher, release, nil
+}
+
+// AcquireConceptFactory returns shared concept factory and the function to release it
+func (registry *Registry) AcquireConceptFactory(configName string, path string, scheme []string, ignoreParams []string) (ConceptFactory, func(), error) {
+	fileHash, err := getFileHash(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := fmt.Sprintf("concept|%s|%s|%s", fileHash, strings.Join(scheme, "|"), strings.Join(ignoreParams, "|"))
+
+	entry, release, err := registry.acquire(key, func(entry *registryEntry) {
+		factory, index, err := loadConceptFactory(configName, path, scheme, ignoreParams)
+		entry.factory, entry.err = factory, err
+		if err != nil {
+			return
+		}
+		entry.closer = index
+		entry.size = getIndexSize(index, path)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return entry.factory, release, nil
+}
+
+func (registry *Registry) Stats() RegistryStats {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	var stats RegistryStats
+	for _, entry := range registry.entries {
+		select {
+		case <-entry.ready:
+		default:
+			// entry is still loading
+			continue
+		}
+		stats.Entries++
+		stats.References += entry.refs
+		stats.SavedBytes += int64(entry.refs-1) * entry.size
+	}
+	return stats
+}
@@ -0,0 +1,108 @@
+package lookup
+
+import (
+	"errors"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRegistrySharesConceptFactories(t *testing.T) {
+	// index cache is stored relative to the dictionary directory, so it's kept in the temporary directory
+	dir := filepath.Join(t.TempDir(), "resources", "dictionaries", "test")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	factPath := filepath.Join(dir, "concepts.bsv")
+	copyPath := filepath.Join(dir, "concepts_copy.bsv")
+	content := []byte("C0032285|T047|Pneumonia\nC0026769|T047|Multiple sclerosis\n")
+	require.NoError(t, os.WriteFile(factPath, content, 0644))
+	require.NoError(t, os.WriteFile(copyPath, content, 0644))
+
+	registry := NewRegistry()
+	scheme := []string{"CUI", "TUI", "STR"}
+
+	var wg sync.WaitGroup
+	releases := make([]func(), 4)
+	errs := make(chan error, len(releases))
+	for i := range releases {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// identical content has to be shared regardless of the file path
+			path := factPath
+			if i%2 == 1 {
+				path = copyPath
+			}
+			factory, release, err := registry.AcquireConceptFactory("test", path, scheme, nil)
+			if err == nil && factory == nil {
+				err = errors.New("concept factory is nil")
+			}
+			errs <- err
+			releases[i] = release
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	stats := registry.Stats()
+	require.Equal(t, 1, stats.Entries)
+	require.Equal(t, 4, stats.References)
+
+	_, release, err := registry.AcquireConceptFactory("test", factPath, []string{"CUI", "TUI"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, registry.Stats().Entries)
+	release()
+
+	for _, release := range releases {
+		release()
+		// releasing twice must not change the references
+		release()
+	}
+	require.Equal(t, 0, registry.Stats().Entries)
+}
+
+func TestRegistryLoaderPanic(t *testing.T) {
+	registry := NewRegistry()
+	loading := make(chan struct{})
+	results := make(chan error, 1)
+
+	go func() {
+		<-loading
+		_, _, err := registry.acquire("key", func(entry *registryEntry) {
+			results <- errors.New("entry must not be loaded twice")
+		})
+		results <- err
+	}()
+	_, _, err := registry.acquire("key", func(entry *registryEntry) {
+		close(loading)
+		// panic when the second caller waits for this entry
+		for {
+			registry.mu.Lock()
+			refs := entry.refs
+			registry.mu.Unlock()
+			if refs == 2 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		panic("corrupted index")
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "corrupted index")
+	err = <-results
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "corrupted index")
+	require.Equal(t, RegistryStats{}, registry.Stats())
+
+	// the failed entry is released, so the next caller loads it again
+	entry, release, err := registry.acquire("key", func(entry *registryEntry) {})
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+	require.Equal(t, 1, registry.Stats().Entries)
+	release()
+}
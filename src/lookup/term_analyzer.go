@@ -0,0 +1,159 @@
+package lookup
+
+import (
+	"text2phenotype.com/fdl/lemmatizer"
+	"text2phenotype.com/fdl/tokenizer"
+	"text2phenotype.com/fdl/types"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TermTagger returns the POS tags of the tokens, it's the runtime POS tagger
+type TermTagger func(tokens []*types.Token) []string
+
+// TermAnalyzer splits dictionary terms into tokens. In the PTB mode terms are tokenized by the runtime PTB tokenizer,
+// tagged by the runtime POS tagger and the lemma variants of the tokens are returned, so the terms are split and
+// lemmatized the same way as the document text.
+type TermAnalyzer struct {
+	Mode      string
+	regex     func(term string) []string
+	ptb       func(sent *types.Sentence) error
+	tag       TermTagger
+	lemmatize lemmatizer.MorphologicalAnalyzer
+}
+
+// TokenizationChange is a term which is split differently by the regex and the runtime tokenizers
+type TokenizationChange struct {
+	Term    string
+	Regex   []string
+	Runtime []string
+}
+
+// NewTermAnalyzer creates the term analyzer, the POS tagger and the lemmatizer are required only by the PTB mode
+func NewTermAnalyzer(mode string, tag TermTagger, lemmatize lemmatizer.MorphologicalAnalyzer) (TermAnalyzer, error) {
+	regex, err := NewTermTokenizer()
+	if err != nil {
+		return TermAnalyzer{}, err
+	}
+
+	analyzer := TermAnalyzer{
+		Mode:  mode,
+		regex: regex,
+	}
+	if len(analyzer.Mode) == 0 {
+		analyzer.Mode = types.TermTokenizerRegex
+	}
+
+	switch analyzer.Mode {
+	case types.TermTokenizerRegex:
+	case types.TermTokenizerPTB:
+		if tag == nil || lemmatize == nil {
+			return TermAnalyzer{}, errors.New("POS tagger and lemmatizer are required by the PTB term tokenizer")
+		}
+		analyzer.ptb = tokenizer.NewTokenizerPTB()
+		analyzer.tag = tag
+		analyzer.lemmatize = lemmatize
+	default:
+		return TermAnalyzer{}, fmt.Errorf("unknown term tokenizer %q", analyzer.Mode)
+	}
+	return analyzer, nil
+}
+
+func (analyzer TermAnalyzer) IsRuntime() bool {
+	return analyzer.Mode == types.TermTokenizerPTB
+}
+
+// GetHashCode returns the part of the index cache name, the default mode keeps the names of the existing indexes.
+// The PTB indexes lemmatized without POS tags are rebuilt.
+func (analyzer TermAnalyzer) GetHashCode() string {
+	if !analyzer.IsRuntime() {
+		return ""
+	}
+	return analyzer.Mode + "pos"
+}
+
+// Tokenize returns tokens of the term with their original case and lemma variants of the tokens,
+// lemma is empty if it's the same as the token. Lemmas are returned only in the PTB mode, the tokens are lemmatized
+// with their POS tags like the document tokens, no lemmas are returned if the term can't be tagged.
+func (analyzer TermAnalyzer) Tokenize(term string) ([]string, []string) {
+	if !analyzer.IsRuntime() {
+		return analyzer.regex(term), nil
+	}
+
+	sent := types.Sentence{Span: types.Span{Text: &term, End: int32(len([]rune(term)))}}
+	if err := analyzer.ptb(&sent); err != nil {
+		return analyzer.regex(term), nil
+	}
+
+	words := make([]*types.Token, 0, len(sent.Tokens))
+	for _, token := range sent.Tokens {
+		if !token.IsNewline {
+			words = append(words, token)
+		}
+	}
+	tags := analyzer.tag(words)
+
+	tokens := make([]string, 0, len(words))
+	var lemmas []string
+	for i, token := range words {
+		text := token.GetShapedText()
+		lemma := ""
+		if token.IsWord && len(tags) == len(words) {
+			lemma = analyzer.lemmatize(*token.Text, tags[i])
+			if lemma == strings.ToLower(text) {
+				lemma = ""
+			}
+		}
+		if len(lemma) > 0 && lemmas == nil {
+			lemmas = make([]string, len(tokens), len(sent.Tokens))
+		}
+		if lemmas != nil {
+			lemmas = append(lemmas, lemma)
+		}
+		tokens = append(tokens, text)
+	}
+	return tokens, lemmas
+}
+
+// maximal count of the examples in the tokenization report
+const maxTokenizationExamples = 20
+
+// TokenizationReport lists the terms which are split differently by the runtime tokenizer
+type TokenizationReport struct {
+	Terms    int
+	Changed  int
+	Examples []TokenizationChange
+}
+
+func (report *TokenizationReport) add(analyzer TermAnalyzer, term string, rareWordTerm *RareWordTerm) {
+	report.Terms++
+	if !analyzer.IsRuntime() {
+		return
+	}
+
+	change := TokenizationChange{Term: term, Regex: analyzer.regex(term)}
+	for _, token := range rareWordTerm.Tokens {
+		change.Runtime = append(change.Runtime, *token)
+	}
+	if isSameTokenization(change.Regex, change.Runtime) {
+		return
+	}
+
+	report.Changed++
+	if len(report.Examples) < maxTokenizationExamples {
+		report.Examples = append(report.Examples, change)
+	}
+}
+
+func isSameTokenization(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+package lookup
+
+import (
+	"text2phenotype.com/fdl/lemmatizer"
+	"text2phenotype.com/fdl/types"
+	"text2phenotype.com/fdl/utils"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// testTags are the POS tags of the test terms, the POS model isn't a part of the repository
+var testTags = map[string]string{
+	"kidney": "NN", "stones": "NNS", "infected": "VBN", "wound": "NN", "worsening": "VBG", "pain": "NN",
+	"bled": "VBD", "2.5": "CD", "mg": "NN",
+}
+
+func tagTestTokens(tokens []*types.Token) []string {
+	tags := make([]string, len(tokens))
+	for i, token := range tokens {
+		tags[i] = testTags[*token.Text]
+	}
+	return tags
+}
+
+func TestTermAnalyzer(t *testing.T) {
+	lemmatize, err := lemmatizer.LoadMorphologicalAnalyzer("../../resources/lemmatizer")
+	require.NoError(t, err)
+	_, err = NewTermAnalyzer(types.TermTokenizerPTB, nil, lemmatize)
+	require.Error(t, err)
+	_, err = NewTermAnalyzer(types.TermTokenizerPTB, tagTestTokens, nil)
+	require.Error(t, err)
+
+	analyzer, err := NewTermAnalyzer(types.TermTokenizerPTB, tagTestTokens, lemmatize)
+	require.NoError(t, err)
+
+	tokens, lemmas := analyzer.Tokenize("Kidney stones")
+	require.Equal(t, []string{"Kidney", "stones"}, tokens)
+	require.Equal(t, []string{"", "stone"}, lemmas)
+
+	// verbs are lemmatized by their tags like the document tokens
+	for term, expected := range map[string][]string{
+		"infected wound": {"infect", ""},
+		"worsening pain": {"worsen", ""},
+		"bled":           {"bleed"},
+	} {
+		_, lemmas := analyzer.Tokenize(term)
+		require.Equal(t, expected, lemmas, term)
+	}
+
+	// untagged terms have no lemma variants
+	untagged, err := NewTermAnalyzer(types.TermTokenizerPTB, func([]*types.Token) []string { return nil }, lemmatize)
+	require.NoError(t, err)
+	tokens, lemmas = untagged.Tokenize("Kidney stones")
+	require.Equal(t, []string{"Kidney", "stones"}, tokens)
+	require.Nil(t, lemmas)
+
+	casePolicy, err := NewCasePolicy(types.FDLConfig{})
+	require.NoError(t, err)
+	store := utils.GlobalStringStore()
+	term := createRareWordTerm("c0022650", "kidney stones", analyzer, casePolicy, store.GetPointer)
+	require.Equal(t, "stone", *term.GetLemma(1))
+
+	// the term is found by the rare word and by its lemma
+	rwMap := createRareWordMap([]*RareWordTerm{term})
+	require.Len(t, collectTerms(CreateMapListIterator(rwMap, store.GetPointers([]string{"kidney", "stones"}))), 1)
+	require.Len(t, collectTerms(CreateMapListIterator(rwMap, store.GetPointers([]string{"kidney", "stone"}))), 1)
+
+	var report TokenizationReport
+	report.add(analyzer, "2.5 mg", createRareWordTerm("c0000001", "2.5 mg", analyzer, casePolicy, store.GetPointer))
+	report.add(analyzer, "kidney stones", term)
+	require.Equal(t, 2, report.Terms)
+	require.Equal(t, 1, report.Changed)
+	require.Equal(t, []TokenizationChange{{Term: "2.5 mg", Regex: []string{"2", ".5", "mg"}, Runtime: []string{"2.5", "mg"}}}, report.Examples)
+}
@@ -0,0 +1,332 @@
+package lookup
+
+import (
+	"bufio"
+	"text2phenotype.com/fdl/logger"
+	"text2phenotype.com/fdl/types"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+const (
+	FilterKindCUI  = "cui"
+	FilterKindTerm = "term"
+
+	FilterCaseAny   = "any"
+	FilterCaseUpper = "upper"
+	FilterCaseLower = "lower"
+	FilterCaseExact = "exact"
+)
+
+// FilterRule is a single blocklist/allowlist entry. Filter files are BSV files with the layout
+// KIND|VALUE|CASE|FOLLOWED_BY|PRECEDED_BY where only KIND and VALUE are required:
+//
+//	cui|C0023449
+//	term|all|upper|leukemia,lymphoma
+//
+// CASE is one of any, upper, lower, exact. FOLLOWED_BY and PRECEDED_BY are comma separated words,
+// the rule matches when the neighbouring word (text or lemma) is one of them.
+type FilterRule struct {
+	Kind       string
+	Value      string
+	Case       string
+	FollowedBy map[string]bool
+	PrecededBy map[string]bool
+}
+
+// TermFilter removes blocked spans and CUIs found by the dictionary before they reach the Consumer
+type TermFilter func(sent types.Sentence, spans []types.Span, cuis [][]*string) ([]types.Span, [][]*string)
+
+func parseFilterRule(line string) (FilterRule, error) {
+	columns := strings.Split(line, "|")
+	if len(columns) < 2 {
+		return FilterRule{}, fmt.Errorf("filter rule must have at least KIND and VALUE columns: %q", line)
+	}
+
+	rule := FilterRule{
+		Kind:  strings.ToLower(strings.TrimSpace(columns[0])),
+		Value: strings.TrimSpace(columns[1]),
+		Case:  FilterCaseAny,
+	}
+
+	if rule.Kind != FilterKindCUI && rule.Kind != FilterKindTerm {
+		return FilterRule{}, fmt.Errorf("unknown filter rule kind %q", rule.Kind)
+	}
+
+	if len(rule.Value) == 0 {
+		return FilterRule{}, fmt.Errorf("filter rule value is empty: %q", line)
+	}
+
+	if len(columns) > 2 && len(strings.TrimSpace(columns[2])) > 0 {
+		rule.Case = strings.ToLower(strings.TrimSpace(columns[2]))
+		switch rule.Case {
+		case FilterCaseAny, FilterCaseUpper, FilterCaseLower, FilterCaseExact:
+		default:
+			return FilterRule{}, fmt.Errorf("unknown filter rule case %q", rule.Case)
+		}
+	}
+
+	if len(columns) > 3 {
+		rule.FollowedBy = parseFilterWords(columns[3])
+	}
+
+	if len(columns) > 4 {
+		rule.PrecededBy = parseFilterWords(columns[4])
+	}
+
+	return rule, nil
+}
+
+func parseFilterWords(column string) map[string]bool {
+	var words map[string]bool
+	for _, word := range strings.Split(column, ",") {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if len(word) == 0 {
+			continue
+		}
+		if words == nil {
+			words = make(map[string]bool)
+		}
+		words[word] = true
+	}
+	return words
+}
+
+func LoadFilterRules(path string) ([]FilterRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []FilterRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+			continue
+		}
+
+		rule, err := parseFilterRule(line)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// spanContext keeps the original-case text of the span and its neighbouring words
+type spanContext struct {
+	text     string
+	next     []*string
+	previous []*string
+}
+
+func isContextToken(token *types.Token) bool {
+	return !token.IsNewline && !token.IsPunct
+}
+
+func tokenWords(token *types.Token) []*string {
+	words := []*string{token.Text}
+	if token.Lemma != nil && token.Lemma != token.Text {
+		words = append(words, token.Lemma)
+	}
+	return words
+}
+
+func getSpanContext(sent *types.Sentence, span types.Span) spanContext {
+	var ctx spanContext
+	if text, ok := span.GetTextFromSentence(sent); ok {
+		ctx.text = text
+	} else if span.Text != nil {
+		ctx.text = *span.Text
+	}
+
+	for _, token := range sent.Tokens {
+		if !isContextToken(token) {
+			continue
+		}
+		if token.End <= span.Begin {
+			ctx.previous = tokenWords(token)
+			continue
+		}
+		if token.Begin >= span.End {
+			ctx.next = tokenWords(token)
+			break
+		}
+	}
+
+	return ctx
+}
+
+func hasAnyWord(expected map[string]bool, words []*string) bool {
+	for _, word := range words {
+		if expected[*word] {
+			return true
+		}
+	}
+	return false
+}
+
+func isUpperText(text string) bool {
+	hasLetter := false
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			hasLetter = true
+			if !unicode.IsUpper(r) {
+				return false
+			}
+		}
+	}
+	return hasLetter
+}
+
+func isLowerText(text string) bool {
+	for _, r := range text {
+		if unicode.IsUpper(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (rule *FilterRule) matchesContext(ctx *spanContext) bool {
+	switch rule.Case {
+	case FilterCaseUpper:
+		if !isUpperText(ctx.text) {
+			return false
+		}
+	case FilterCaseLower:
+		if !isLowerText(ctx.text) {
+			return false
+		}
+	case FilterCaseExact:
+		if rule.Kind == FilterKindTerm && ctx.text != rule.Value {
+			return false
+		}
+	}
+
+	if len(rule.FollowedBy) > 0 && !hasAnyWord(rule.FollowedBy, ctx.next) {
+		return false
+	}
+
+	if len(rule.PrecededBy) > 0 && !hasAnyWord(rule.PrecededBy, ctx.previous) {
+		return false
+	}
+
+	return true
+}
+
+func (rule *FilterRule) matchesTerm(ctx *spanContext) bool {
+	return strings.EqualFold(rule.Value, ctx.text) && rule.matchesContext(ctx)
+}
+
+func (rule *FilterRule) matchesCUI(cui *string, ctx *spanContext) bool {
+	return strings.EqualFold(rule.Value, *cui) && rule.matchesContext(ctx)
+}
+
+type filterRuleSet struct {
+	terms []FilterRule
+	cuis  []FilterRule
+}
+
+func newFilterRuleSet(rules []FilterRule) filterRuleSet {
+	var set filterRuleSet
+	for _, rule := range rules {
+		switch rule.Kind {
+		case FilterKindTerm:
+			set.terms = append(set.terms, rule)
+		case FilterKindCUI:
+			set.cuis = append(set.cuis, rule)
+		}
+	}
+	return set
+}
+
+func (set *filterRuleSet) matchesTerm(ctx *spanContext) bool {
+	for i := range set.terms {
+		if set.terms[i].matchesTerm(ctx) {
+			return true
+		}
+	}
+	return false
+}
+
+func (set *filterRuleSet) matchesCUI(cui *string, ctx *spanContext) bool {
+	for i := range set.cuis {
+		if set.cuis[i].matchesCUI(cui, ctx) {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateTermFilter creates filter from blocklist and allowlist files. Empty path means that list is not used.
+// Allowlist entries take priority: a span or CUI matched by the allowlist is never suppressed by the blocklist.
+func CreateTermFilter(configName string, blocklistPath string, allowlistPath string) (TermFilter, error) {
+	fdlLogger := logger.NewLogger("Term filter loader").With().
+		Str("config_name", configName).
+		Str("blocklist", blocklistPath).
+		Str("allowlist", allowlistPath).Logger()
+
+	if len(blocklistPath) == 0 && len(allowlistPath) == 0 {
+		return nil, errors.New("neither blocklist nor allowlist is specified")
+	}
+
+	var blockRules, allowRules []FilterRule
+	var err error
+	if len(blocklistPath) > 0 {
+		if blockRules, err = LoadFilterRules(blocklistPath); err != nil {
+			return nil, err
+		}
+	}
+	if len(allowlistPath) > 0 {
+		if allowRules, err = LoadFilterRules(allowlistPath); err != nil {
+			return nil, err
+		}
+	}
+
+	fdlLogger.Info().Msgf("Loaded %d blocklist and %d allowlist rules", len(blockRules), len(allowRules))
+
+	blocklist := newFilterRuleSet(blockRules)
+	allowlist := newFilterRuleSet(allowRules)
+
+	return func(sent types.Sentence, spans []types.Span, cuis [][]*string) ([]types.Span, [][]*string) {
+		filteredSpans := make([]types.Span, 0, len(spans))
+		filteredCuis := make([][]*string, 0, len(cuis))
+
+		for i, span := range spans {
+			ctx := getSpanContext(&sent, span)
+			isTermAllowed := allowlist.matchesTerm(&ctx)
+			if !isTermAllowed && blocklist.matchesTerm(&ctx) {
+				continue
+			}
+
+			spanCuis := make([]*string, 0, len(cuis[i]))
+			for _, cui := range cuis[i] {
+				if !isTermAllowed && !allowlist.matchesCUI(cui, &ctx) && blocklist.matchesCUI(cui, &ctx) {
+					continue
+				}
+				spanCuis = append(spanCuis, cui)
+			}
+
+			if len(spanCuis) == 0 {
+				continue
+			}
+
+			filteredSpans = append(filteredSpans, span)
+			filteredCuis = append(filteredCuis, spanCuis)
+		}
+
+		return filteredSpans, filteredCuis
+	}, nil
+}
@@ -0,0 +1,69 @@
+package lookup
+
+import (
+	"text2phenotype.com/fdl/types"
+	"text2phenotype.com/fdl/utils"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func makeFilterSentence(text string) types.Sentence {
+	sent := types.Sentence{
+		Span: types.Span{Begin: 0, End: int32(len(text)), Text: &text},
+	}
+	offset := 0
+	for _, word := range strings.Fields(text) {
+		begin := strings.Index(text[offset:], word) + offset
+		end := begin + len(word)
+		offset = end
+		sent.Tokens = append(sent.Tokens, &types.Token{
+			Span:   types.Span{Begin: int32(begin), End: int32(end), Text: utils.GlobalStringStore().GetPointer(word)},
+			IsWord: true,
+		})
+	}
+	return sent
+}
+
+func writeFilterFile(t *testing.T, dir string, name string, lines ...string) string {
+	filePath := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(filePath, []byte(strings.Join(lines, "\n")), 0600))
+	return filePath
+}
+
+func TestTermFilter(t *testing.T) {
+	dir := t.TempDir()
+	blocklist := writeFilterFile(t, dir, "blocklist.bsv",
+		"# KIND|VALUE|CASE|FOLLOWED_BY|PRECEDED_BY",
+		"term|all",
+		"cui|C0000002",
+	)
+	allowlist := writeFilterFile(t, dir, "allowlist.bsv",
+		"term|all|upper|leukemia,lymphoma",
+	)
+
+	filter, err := CreateTermFilter("test", blocklist, allowlist)
+	require.NoError(t, err)
+
+	store := utils.GlobalStringStore()
+	cuiA, cuiB := store.GetPointer("c0000001"), store.GetPointer("c0000002")
+
+	testCases := []struct {
+		text     string
+		span     types.Span
+		expected [][]*string
+	}{
+		{"all patients", types.Span{Begin: 0, End: 3}, [][]*string{}},
+		{"ALL patients", types.Span{Begin: 0, End: 3}, [][]*string{}},
+		{"ALL leukemia", types.Span{Begin: 0, End: 3}, [][]*string{{cuiA, cuiB}}},
+		{"severe pain", types.Span{Begin: 7, End: 11}, [][]*string{{cuiA}}},
+	}
+
+	for _, tc := range testCases {
+		sent := makeFilterSentence(tc.text)
+		_, cuis := filter(sent, []types.Span{tc.span}, [][]*string{{cuiA, cuiB}})
+		require.Equal(t, tc.expected, cuis, tc.text)
+	}
+}
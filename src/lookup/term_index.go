@@ -0,0 +1,37 @@
+package lookup
+
+// TermIndex gives access to the dictionary terms grouped by their rare words
+type TermIndex interface {
+	// Terms returns terms with the rare word, the terms are shared and must not be modified
+	Terms(rareWord *string) []*RareWordTerm
+	// ForEach calls f for every rare word of the index
+	ForEach(f func(rareWord *string, terms []*RareWordTerm))
+	// Len returns count of the rare words
+	Len() int
+}
+
+func (rw RareWordTermMap) Terms(rareWord *string) []*RareWordTerm {
+	return rw[rareWord]
+}
+
+func (rw RareWordTermMap) ForEach(f func(rareWord *string, terms []*RareWordTerm)) {
+	for rareWord, terms := range rw {
+		f(rareWord, terms)
+	}
+}
+
+func (rw RareWordTermMap) Len() int {
+	return len(rw)
+}
+
+// SameString compares interned strings. Strings of the memory mapped indexes are not interned by the global
+// string store, so pointers are compared first and the values are compared only if pointers differ.
+func SameString(a *string, b *string) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil {
+		return false
+	}
+	return *a == *b
+}
@@ -0,0 +1,162 @@
+package lookup
+
+import (
+	"text2phenotype.com/fdl/logger"
+	"io"
+)
+
+// approximate memory used by a trie node and by a term reference, used by the registry stats
+const (
+	trieNodeSize = 64
+	trieTermSize = 8
+)
+
+// TermMatcher finds dictionary terms in one left-to-right pass over the tokens. words keeps the alternatives
+// (text and lemma) of every token, visit is called with indices of the first and the last tokens of every found term.
+type TermMatcher func(words [][]*string, visit func(begin int, end int, term *RareWordTerm))
+
+type trieNode struct {
+	children map[*string]*trieNode
+	terms    []*RareWordTerm
+}
+
+// TermTrie is a token trie of the dictionary terms keyed by interned token pointers. Unlike the rare word index
+// it doesn't verify every term which shares a word with the text, only the terms whose tokens go one by one are found.
+// Terms with lemmas are added twice, by their tokens and by their lemma variants.
+type TermTrie struct {
+	root  *trieNode
+	nodes int
+	terms int
+}
+
+// NewTermTrie builds the trie of all terms of the index, the terms and their token pointers must be kept
+// by the caller, so the trie stays valid when the index is closed
+func NewTermTrie(index TermIndex) *TermTrie {
+	trie := &TermTrie{root: &trieNode{}}
+	index.ForEach(func(rareWord *string, terms []*RareWordTerm) {
+		for _, term := range terms {
+			// terms are listed under the lemma of their rare word as well
+			if !SameString(rareWord, term.GetRareWord()) {
+				continue
+			}
+			trie.terms++
+			trie.add(term.Tokens, term)
+			if len(term.Lemmas) == 0 {
+				continue
+			}
+			lemmas := make([]*string, len(term.Tokens))
+			for i, token := range term.Tokens {
+				lemmas[i] = token
+				if lemma := term.GetLemma(i); lemma != nil {
+					lemmas[i] = lemma
+				}
+			}
+			trie.add(lemmas, term)
+		}
+	})
+	return trie
+}
+
+func (trie *TermTrie) add(tokens []*string, term *RareWordTerm) {
+	node := trie.root
+	for _, token := range tokens {
+		child, ok := node.children[token]
+		if !ok {
+			if node.children == nil {
+				node.children = make(map[*string]*trieNode)
+			}
+			child = &trieNode{}
+			node.children[token] = child
+			trie.nodes++
+		}
+		node = child
+	}
+	for _, known := range node.terms {
+		if known == term {
+			return
+		}
+	}
+	node.terms = append(node.terms, term)
+}
+
+// Match walks all partial matches at once, every token starts a new one
+func (trie *TermTrie) Match(words [][]*string, visit func(begin int, end int, term *RareWordTerm)) {
+	type state struct {
+		node  *trieNode
+		begin int
+	}
+
+	var active, next []state
+	for i, alternatives := range words {
+		active = append(active, state{node: trie.root, begin: i})
+		next = next[:0]
+		for _, current := range active {
+			for j, word := range alternatives {
+				if word == nil || isPreviousAlternative(alternatives[:j], word) {
+					continue
+				}
+				child, ok := current.node.children[word]
+				if !ok {
+					continue
+				}
+				for _, term := range child.terms {
+					visit(current.begin, i, term)
+				}
+				if len(child.children) > 0 {
+					next = append(next, state{node: child, begin: current.begin})
+				}
+			}
+		}
+		active, next = next, active
+	}
+}
+
+func isPreviousAlternative(previous []*string, word *string) bool {
+	for _, prev := range previous {
+		if prev == word {
+			return true
+		}
+	}
+	return false
+}
+
+func (trie *TermTrie) Len() int {
+	return trie.terms
+}
+
+// Size returns approximate memory used by the trie
+func (trie *TermTrie) Size() int {
+	return trie.nodes*trieNodeSize + trie.terms*trieTermSize
+}
+
+// loadTermTrie builds the trie from the term index of the dictionary, the index is closed when the trie is built
+func loadTermTrie(configName string, path string, scheme []string, casePolicy CasePolicy, analyzer TermAnalyzer) (*TermTrie, error) {
+	fdlLogger := logger.NewLogger("Term trie loader").With().
+		Str("config_name", configName).
+		Str("path", path).Logger()
+
+	_, index, err := loadDictionary(configName, path, scheme, casePolicy, analyzer, FuzzyParams{})
+	if err != nil {
+		return nil, err
+	}
+
+	trie := NewTermTrie(index)
+	if closer, ok := index.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			fdlLogger.Err(err).Msg("Could not close index")
+		}
+	}
+
+	fdlLogger.Info().
+		Int("terms", trie.Len()).
+		Int("nodes", trie.nodes).
+		Msgf("Term trie was built, approximately %d MB", trie.Size()>>20)
+	return trie, nil
+}
+
+// EmptyDictionary finds nothing, it's used with the trie engine which doesn't look up terms by words
+func EmptyDictionary(words []*string) MapListIterator {
+	return func() (*RareWordTerm, bool) {
+		return nil, false
+	}
+}
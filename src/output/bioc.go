@@ -0,0 +1,391 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	biocSource        = "FDL"
+	biocKey           = "fdl.key"
+	biocDateLayout    = "20060102"
+	biocAnnotator     = "fdl"
+	biocMentionRole   = "mention"
+	biocXMLHeader     = xml.Header + `<!DOCTYPE collection SYSTEM "BioC.dtd">` + "\n"
+	biocInfonType     = "type"
+	biocInfonAnnotate = "annotator"
+)
+
+// BioCInfons are the key-value pairs of BioC, in XML they are <infon key="...">value</infon> elements
+type BioCInfons map[string]string
+
+func (infons BioCInfons) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	keys := make([]string, 0, len(infons))
+	for key := range infons {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		element := xml.StartElement{Name: start.Name, Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: key}}}
+		if err := e.EncodeElement(infons[key], element); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnmarshalXML is called for every <infon> element
+func (infons *BioCInfons) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var value string
+	if err := d.DecodeElement(&value, &start); err != nil {
+		return err
+	}
+	if *infons == nil {
+		*infons = make(BioCInfons)
+	}
+	for _, attr := range start.Attr {
+		if attr.Name.Local == "key" {
+			(*infons)[attr.Value] = value
+		}
+	}
+	return nil
+}
+
+type BioCLocation struct {
+	Offset int `xml:"offset,attr" json:"offset"`
+	Length int `xml:"length,attr" json:"length"`
+}
+
+type BioCAnnotation struct {
+	ID        string         `xml:"id,attr" json:"id"`
+	Infons    BioCInfons     `xml:"infon" json:"infons"`
+	Locations []BioCLocation `xml:"location" json:"locations"`
+	Text      string         `xml:"text" json:"text"`
+}
+
+type BioCNode struct {
+	RefID string `xml:"refid,attr" json:"refid"`
+	Role  string `xml:"role,attr" json:"role"`
+}
+
+type BioCRelation struct {
+	ID     string     `xml:"id,attr" json:"id"`
+	Infons BioCInfons `xml:"infon" json:"infons"`
+	Nodes  []BioCNode `xml:"node" json:"nodes"`
+}
+
+type BioCPassage struct {
+	Infons      BioCInfons       `xml:"infon" json:"infons"`
+	Offset      int              `xml:"offset" json:"offset"`
+	Text        string           `xml:"text,omitempty" json:"text"`
+	Annotations []BioCAnnotation `xml:"annotation" json:"annotations"`
+	Relations   []BioCRelation   `xml:"relation" json:"relations"`
+}
+
+type BioCDocument struct {
+	ID        string         `xml:"id" json:"id"`
+	Infons    BioCInfons     `xml:"infon" json:"infons"`
+	Passages  []BioCPassage  `xml:"passage" json:"passages"`
+	Relations []BioCRelation `xml:"relation" json:"relations"`
+}
+
+type BioCCollection struct {
+	XMLName   xml.Name       `xml:"collection" json:"-"`
+	Source    string         `xml:"source" json:"source"`
+	Date      string         `xml:"date" json:"date"`
+	Key       string         `xml:"key" json:"key"`
+	Infons    BioCInfons     `xml:"infon" json:"infons"`
+	Documents []BioCDocument `xml:"document" json:"documents"`
+}
+
+// ParseBioC reads the BioC collection in XML or JSON
+func ParseBioC(data []byte) (BioCCollection, error) {
+	var collection BioCCollection
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return collection, errors.New("BioC collection is empty")
+	}
+	var err error
+	if trimmed[0] == '<' {
+		err = xml.Unmarshal(trimmed, &collection)
+	} else {
+		err = json.Unmarshal(trimmed, &collection)
+	}
+	return collection, err
+}
+
+// IsBioCXML checks whether the BioC collection is XML
+func IsBioCXML(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	return len(trimmed) > 0 && trimmed[0] == '<'
+}
+
+// MarshalBioC writes the collection in XML or JSON
+func MarshalBioC(collection BioCCollection, isXML bool) ([]byte, error) {
+	if !isXML {
+		return json.Marshal(collection)
+	}
+	buf, err := xml.Marshal(collection)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(biocXMLHeader), buf...), nil
+}
+
+// GetText returns the text of the document with every passage at its offset, the gaps are filled with new lines
+func (doc BioCDocument) GetText() string {
+	var builder strings.Builder
+	length := 0
+	for _, passage := range doc.Passages {
+		for ; length < passage.Offset; length++ {
+			builder.WriteRune('\n')
+		}
+		if passage.Offset < length {
+			// overlapping passages are not expected, the passage text is skipped
+			continue
+		}
+		builder.WriteString(passage.Text)
+		length += utf8.RuneCountInString(passage.Text)
+	}
+	return builder.String()
+}
+
+// getSpanAttributeOffsets returns the offsets of the attribute which is set as [text, begin, end]
+func getSpanAttributeOffsets(value interface{}) (string, int32, int32, bool) {
+	span, ok := value.([]interface{})
+	if !ok || len(span) != 3 {
+		return "", 0, 0, false
+	}
+	// the text is a string or a string type of the annotator, like the frequency quantity
+	text, isText := "", false
+	if textValue := reflect.ValueOf(span[0]); textValue.Kind() == reflect.String {
+		text, isText = textValue.String(), true
+	}
+	begin, isBegin := span[1].(int32)
+	end, isEnd := span[2].(int32)
+	return text, begin, end, isText && isBegin && isEnd
+}
+
+// getInfonValue converts the attribute value to the infon, non string values are written as JSON
+func getInfonValue(value interface{}) (string, bool) {
+	switch typed := value.(type) {
+	case nil:
+		return "", false
+	case string:
+		return typed, true
+	case fmt.Stringer:
+		return typed.String(), true
+	}
+	if stringValue := reflect.ValueOf(value); stringValue.Kind() == reflect.String {
+		return stringValue.String(), true
+	}
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value), true
+	}
+	return string(buf), true
+}
+
+// createBioCDocument converts the annotations of the document to the BioC document with one passage per section,
+// or one passage for the whole text if the annotations have no sections. Span attributes of the annotations
+// (drug and lab attributes) become annotations linked to the mention by relations.
+func createBioCDocument(doc Document) BioCDocument {
+	base := doc.GetBaseResponse()
+	result := BioCDocument{ID: base.DocId, Infons: BioCInfons{}}
+	if len(result.ID) == 0 {
+		result.ID = doc.Tid
+	}
+
+	runes := []rune(doc.Text)
+	sections := doc.GetSections()
+
+	type passageKey struct{ begin, end int32 }
+	passageIndices := make(map[passageKey]int)
+	getPassage := func(section Section) *BioCPassage {
+		key := passageKey{0, int32(len(runes))}
+		if len(section.SectionOffset) == 2 && section.SectionOffset[0] >= 0 &&
+			section.SectionOffset[0] <= section.SectionOffset[1] && int(section.SectionOffset[1]) <= len(runes) {
+			key = passageKey{section.SectionOffset[0], section.SectionOffset[1]}
+		}
+		idx, ok := passageIndices[key]
+		if !ok {
+			idx = len(result.Passages)
+			passageIndices[key] = idx
+			result.Passages = append(result.Passages, BioCPassage{
+				Infons: BioCInfons{biocInfonType: "section"},
+				Offset: int(key.begin),
+				Text:   string(runes[key.begin:key.end]),
+			})
+		}
+		return &result.Passages[idx]
+	}
+
+	annotationID, relationID := 0, 0
+	for _, section := range sections {
+		passage := getPassage(section)
+		begin, end := GetSpan(section.ContentSection)
+
+		annotationID++
+		mention := BioCAnnotation{
+			ID: "A" + strconv.Itoa(annotationID),
+			Infons: BioCInfons{
+				biocInfonType:     section.Aspect,
+				biocInfonAnnotate: biocAnnotator,
+				"configuration":   section.ConfigName,
+			},
+			Locations: []BioCLocation{{Offset: int(begin), Length: int(end - begin)}},
+			Text:      GetText(section.ContentSection),
+		}
+
+		if len(section.Name) > 0 {
+			mention.Infons["name"] = section.Name
+		}
+
+		var cuis, codes []string
+		for _, concept := range section.UmlsConcepts {
+			cuis = append(cuis, concept.Cui)
+			for _, sabConcept := range concept.SabConcepts {
+				for _, vocabConcept := range sabConcept.VocabConcepts {
+					codes = append(codes, sabConcept.CodingScheme+":"+vocabConcept.Code)
+				}
+			}
+		}
+		if len(cuis) > 0 {
+			mention.Infons["identifier"] = strings.Join(cuis, ";")
+		}
+		if len(codes) > 0 {
+			mention.Infons["codes"] = strings.Join(codes, ";")
+		}
+
+		names := make([]string, 0, len(section.Attributes))
+		for name := range section.Attributes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var attributeAnnotations []BioCAnnotation
+		for _, name := range names {
+			value := section.Attributes[name]
+			if text, attrBegin, attrEnd, ok := getSpanAttributeOffsets(value); ok {
+				annotationID++
+				relationID++
+				attribute := BioCAnnotation{
+					ID:        "A" + strconv.Itoa(annotationID),
+					Infons:    BioCInfons{biocInfonType: name, biocInfonAnnotate: biocAnnotator},
+					Locations: []BioCLocation{{Offset: int(attrBegin), Length: int(attrEnd - attrBegin)}},
+					Text:      text,
+				}
+				attributeAnnotations = append(attributeAnnotations, attribute)
+				passage.Relations = append(passage.Relations, BioCRelation{
+					ID:     "R" + strconv.Itoa(relationID),
+					Infons: BioCInfons{biocInfonType: name},
+					Nodes:  []BioCNode{{RefID: mention.ID, Role: biocMentionRole}, {RefID: attribute.ID, Role: name}},
+				})
+				continue
+			}
+			if infon, ok := getInfonValue(value); ok {
+				mention.Infons[name] = infon
+			}
+		}
+
+		passage.Annotations = append(passage.Annotations, mention)
+		passage.Annotations = append(passage.Annotations, attributeAnnotations...)
+	}
+
+	if len(result.Passages) == 0 {
+		result.Passages = append(result.Passages, BioCPassage{Infons: BioCInfons{biocInfonType: "document"}, Text: doc.Text})
+	}
+	sort.SliceStable(result.Passages, func(i, j int) bool {
+		return result.Passages[i].Offset < result.Passages[j].Offset
+	})
+	return result
+}
+
+func createBioCCollection(doc Document) BioCCollection {
+	return BioCCollection{
+		Source:    biocSource,
+		Date:      time.Now().Format(biocDateLayout),
+		Key:       biocKey,
+		Infons:    BioCInfons{},
+		Documents: []BioCDocument{createBioCDocument(doc)},
+	}
+}
+
+func renderBioCJSON(doc Document) ([]byte, error) {
+	return MarshalBioC(createBioCCollection(doc), false)
+}
+
+func renderBioCXML(doc Document) ([]byte, error) {
+	return MarshalBioC(createBioCCollection(doc), true)
+}
+
+// MergeBioCDocument adds the annotations and relations of the predicted document to the passages of the target
+// document which contain them, so the input annotations are kept next to the predicted ones. Predicted ids
+// get the "fdl" prefix.
+func MergeBioCDocument(target *BioCDocument, predicted BioCDocument) {
+	findPassage := func(offset int) *BioCPassage {
+		for i := range target.Passages {
+			passage := &target.Passages[i]
+			if offset >= passage.Offset && offset < passage.Offset+utf8.RuneCountInString(passage.Text) {
+				return passage
+			}
+		}
+		return nil
+	}
+
+	annotationPassages := make(map[string]*BioCPassage)
+	for _, passage := range predicted.Passages {
+		for _, annotation := range passage.Annotations {
+			annotation.ID = biocAnnotator + annotation.ID
+			if len(annotation.Locations) == 0 {
+				continue
+			}
+			targetPassage := findPassage(annotation.Locations[0].Offset)
+			if targetPassage == nil {
+				continue
+			}
+			targetPassage.Annotations = append(targetPassage.Annotations, annotation)
+			annotationPassages[annotation.ID] = targetPassage
+		}
+	}
+
+	for _, passage := range predicted.Passages {
+		for _, relation := range passage.Relations {
+			relation.ID = biocAnnotator + relation.ID
+			nodes := make([]BioCNode, len(relation.Nodes))
+			var targetPassage *BioCPassage
+			isComplete, isSamePassage := true, true
+			for i, node := range relation.Nodes {
+				nodes[i] = BioCNode{RefID: biocAnnotator + node.RefID, Role: node.Role}
+				nodePassage, ok := annotationPassages[nodes[i].RefID]
+				if !ok {
+					isComplete = false
+					break
+				}
+				if targetPassage == nil {
+					targetPassage = nodePassage
+				}
+				isSamePassage = isSamePassage && targetPassage == nodePassage
+			}
+			if !isComplete {
+				continue
+			}
+			relation.Nodes = nodes
+			// the relation of the nodes in different passages goes to the document
+			if targetPassage != nil && isSamePassage {
+				targetPassage.Relations = append(targetPassage.Relations, relation)
+			} else {
+				target.Relations = append(target.Relations, relation)
+			}
+		}
+	}
+}
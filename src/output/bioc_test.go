@@ -0,0 +1,98 @@
+package output
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRenderBioC(t *testing.T) {
+	doc := createTestDocument()
+	for _, name := range []string{FormatBioCJSON, FormatBioCXML} {
+		format, err := GetFormat(name)
+		require.NoError(t, err)
+		buf, err := format.Render(doc)
+		require.NoError(t, err)
+		require.Equal(t, name == FormatBioCXML, IsBioCXML(buf))
+
+		collection, err := ParseBioC(buf)
+		require.NoError(t, err, name)
+		require.Len(t, collection.Documents, 1)
+		document := collection.Documents[0]
+		require.Equal(t, "doc1", document.ID)
+		require.Len(t, document.Passages, 1)
+
+		passage := document.Passages[0]
+		require.Equal(t, doc.Text, passage.Text)
+		require.Equal(t, doc.Text, document.GetText())
+		// 4 mentions, 2 drug and 2 lab span attributes
+		require.Len(t, passage.Annotations, 8)
+		require.Len(t, passage.Relations, 4)
+
+		asthma := passage.Annotations[0]
+		require.Equal(t, BioCInfons{
+			"type":          "prob",
+			"annotator":     "fdl",
+			"configuration": "clinical",
+			"identifier":    "C195967001",
+			"codes":         "SNOMEDCT_US:195967001",
+			"polarity":      "negative",
+		}, asthma.Infons)
+		require.Equal(t, []BioCLocation{{Offset: 3, Length: 6}}, asthma.Locations)
+
+		glucose := passage.Annotations[4]
+		require.Equal(t, "Glucose", glucose.Text)
+		relation := passage.Relations[2]
+		require.Equal(t, "labValue", relation.Infons["type"])
+		require.Equal(t, []BioCNode{{RefID: glucose.ID, Role: "mention"}, {RefID: passage.Annotations[5].ID, Role: "labValue"}}, relation.Nodes)
+		require.Equal(t, "105", passage.Annotations[5].Text)
+	}
+}
+
+func TestMergeBioCDocument(t *testing.T) {
+	input, err := ParseBioC([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<collection><source>gold</source><date>20240101</date><key>gold.key</key>
+<document><id>d1</id>
+<passage><infon key="type">title</infon><offset>0</offset><text>Asthma</text>
+<annotation id="1"><infon key="type">prob</infon><location offset="0" length="6"/><text>Asthma</text></annotation>
+</passage>
+<passage><infon key="type">abstract</infon><offset>7</offset><text>Glucose 105</text></passage>
+</document></collection>`))
+	require.NoError(t, err)
+	document := &input.Documents[0]
+	require.Equal(t, "Asthma\nGlucose 105", document.GetText())
+	require.Equal(t, "prob", document.Passages[0].Annotations[0].Infons["type"])
+
+	predicted := BioCDocument{Passages: []BioCPassage{{
+		Annotations: []BioCAnnotation{
+			{ID: "A1", Locations: []BioCLocation{{Offset: 0, Length: 6}}},
+			{ID: "A2", Locations: []BioCLocation{{Offset: 7, Length: 7}}},
+			{ID: "A3", Locations: []BioCLocation{{Offset: 15, Length: 3}}},
+		},
+		Relations: []BioCRelation{
+			{ID: "R1", Nodes: []BioCNode{{RefID: "A2", Role: "mention"}, {RefID: "A3", Role: "labValue"}}},
+			{ID: "R2", Nodes: []BioCNode{{RefID: "A1", Role: "mention"}, {RefID: "A3", Role: "labValue"}}},
+		},
+	}}}
+	MergeBioCDocument(document, predicted)
+
+	require.Equal(t, []string{"1", "fdlA1"}, getAnnotationIDs(document.Passages[0]))
+	require.Equal(t, []string{"fdlA2", "fdlA3"}, getAnnotationIDs(document.Passages[1]))
+	require.Equal(t, "fdlR1", document.Passages[1].Relations[0].ID)
+	require.Equal(t, "fdlA3", document.Passages[1].Relations[0].Nodes[1].RefID)
+	// nodes in different passages
+	require.Equal(t, "fdlR2", document.Relations[0].ID)
+
+	buf, err := MarshalBioC(input, true)
+	require.NoError(t, err)
+	again, err := ParseBioC(buf)
+	require.NoError(t, err)
+	require.Equal(t, input.Documents, again.Documents)
+}
+
+func getAnnotationIDs(passage BioCPassage) []string {
+	var result []string
+	for _, annotation := range passage.Annotations {
+		result = append(result, annotation.ID)
+	}
+	return result
+}
@@ -0,0 +1,150 @@
+package output
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	bratNormalizationRef = "Reference"
+	bratUMLSDatabase     = "UMLS"
+	bratNotes            = "AnnotatorNotes"
+)
+
+// bratBuilder writes the standoff entries and numbers them by entry kind
+type bratBuilder struct {
+	runes []rune
+	lines []string
+	ids   map[byte]int
+}
+
+func (builder *bratBuilder) nextID(kind byte) string {
+	builder.ids[kind]++
+	return string(kind) + strconv.Itoa(builder.ids[kind])
+}
+
+func (builder *bratBuilder) add(format string, args ...interface{}) {
+	builder.lines = append(builder.lines, fmt.Sprintf(format, args...))
+}
+
+// addTextBound adds the T entry of the span and returns its id, spans crossing line breaks are split
+// into fragments because brat doesn't allow text bound annotations over new lines
+func (builder *bratBuilder) addTextBound(typeName string, begin int32, end int32) (string, bool) {
+	if begin < 0 || end <= begin || int(end) > len(builder.runes) {
+		return "", false
+	}
+
+	var fragments, texts []string
+	fragmentBegin := int32(-1)
+	for pos := begin; pos <= end; pos++ {
+		isBreak := pos == end || builder.runes[pos] == '\n' || builder.runes[pos] == '\r'
+		if !isBreak && fragmentBegin < 0 {
+			fragmentBegin = pos
+		}
+		if isBreak && fragmentBegin >= 0 {
+			fragments = append(fragments, fmt.Sprintf("%d %d", fragmentBegin, pos))
+			texts = append(texts, string(builder.runes[fragmentBegin:pos]))
+			fragmentBegin = -1
+		}
+	}
+	if len(fragments) == 0 {
+		return "", false
+	}
+
+	id := builder.nextID('T')
+	builder.add("%s\t%s %s\t%s", id, typeName, strings.Join(fragments, ";"), strings.Join(texts, " "))
+	return id, true
+}
+
+// getBratName replaces the characters which are not allowed in brat type and attribute names
+func getBratName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// getBratAttributeValue converts the scalar attribute to the brat attribute value, booleans are binary
+// attributes written without a value, lists and maps are not representable and are skipped
+func getBratAttributeValue(value interface{}) (string, bool) {
+	switch typed := value.(type) {
+	case nil:
+		return "", false
+	case bool:
+		return "", typed
+	case string:
+		if len(typed) == 0 {
+			return "", false
+		}
+		return getBratName(typed), true
+	case fmt.Stringer:
+		return getBratName(typed.String()), true
+	}
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct, reflect.Ptr:
+		return "", false
+	}
+	return getBratName(fmt.Sprint(value)), true
+}
+
+// renderBrat writes the brat standoff .ann file of the document text. Mentions are T entries typed by the
+// annotation name, span attributes (drug strength and frequency, lab value and unit) become T entries linked to
+// the mention by R relations typed by the attribute name, scalar attributes are A entries and CUIs are N entries.
+func renderBrat(doc Document) ([]byte, error) {
+	builder := bratBuilder{runes: []rune(doc.Text), ids: make(map[byte]int)}
+
+	for _, section := range doc.GetSections() {
+		typeName := section.Name
+		if len(typeName) == 0 {
+			typeName = section.Aspect
+		}
+		begin, end := GetSpan(section.ContentSection)
+		mentionID, ok := builder.addTextBound(getBratName(typeName), begin, end)
+		if !ok {
+			continue
+		}
+
+		names := make([]string, 0, len(section.Attributes))
+		for name := range section.Attributes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			value := section.Attributes[name]
+			attrName := getBratName(name)
+			if _, attrBegin, attrEnd, ok := getSpanAttributeOffsets(value); ok {
+				if attributeID, ok := builder.addTextBound(attrName, attrBegin, attrEnd); ok {
+					builder.add("%s\t%s Arg1:%s Arg2:%s", builder.nextID('R'), attrName, mentionID, attributeID)
+				}
+				continue
+			}
+			attrValue, ok := getBratAttributeValue(value)
+			if !ok {
+				continue
+			}
+			if len(attrValue) == 0 {
+				builder.add("%s\t%s %s", builder.nextID('A'), attrName, mentionID)
+			} else {
+				builder.add("%s\t%s %s %s", builder.nextID('A'), attrName, mentionID, attrValue)
+			}
+		}
+
+		for _, concept := range section.UmlsConcepts {
+			builder.add("%s\t%s %s %s:%s\t%s", builder.nextID('N'), bratNormalizationRef, mentionID, bratUMLSDatabase,
+				concept.Cui, strings.Join(strings.Fields(concept.PreferredText), " "))
+		}
+		builder.add("%s\t%s %s\tconfiguration: %s", builder.nextID('#'), bratNotes, mentionID, section.ConfigName)
+	}
+
+	if len(builder.lines) == 0 {
+		return []byte{}, nil
+	}
+	return []byte(strings.Join(builder.lines, "\n") + "\n"), nil
+}
@@ -0,0 +1,59 @@
+package output
+
+import (
+	"text2phenotype.com/fdl/types"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestRenderBrat(t *testing.T) {
+	doc := createTestDocument()
+	clinical := doc.Results["clinical"].(types.DefaultClinicalResponse)
+	clinical.Content = clinical.Content[:3]
+	clinical.Content[0].Name = "DiseaseDisorderMention"
+	clinical.Content[1].Name = "MedicationMention"
+	doc.Results["clinical"] = clinical
+
+	format, err := GetFormat(FormatBrat)
+	require.NoError(t, err)
+	require.True(t, format.WithText)
+	buf, err := format.Render(doc)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(string(buf), "\n"), "\n")
+	require.Equal(t, []string{
+		"T1\tDiseaseDisorderMention 3 9\tasthma",
+		"A1\tpolarity T1 negative",
+		"N1\tReference T1 UMLS:C195967001\tasthma",
+		"#1\tAnnotatorNotes T1\tconfiguration: clinical",
+		"T2\tMedicationMention 11 18\tAspirin",
+		"A2\tmedDosage T2 81_mg",
+		"T3\tmedFrequencyNumber 28 29\t2",
+		"R1\tmedFrequencyNumber Arg1:T2 Arg2:T3",
+		"T4\tmedFrequencyUnit 30 35\tdaily",
+		"R2\tmedFrequencyUnit Arg1:T2 Arg2:T4",
+		"A3\tmedRoute T2 po",
+		"A4\tpolarity T2 positive",
+		"N2\tReference T2 UMLS:C1191\tAspirin",
+		"#2\tAnnotatorNotes T2\tconfiguration: clinical",
+		"T5\tlab 37 44\tGlucose",
+		"T6\tlabValue 45 48\t105",
+		"R3\tlabValue Arg1:T5 Arg2:T6",
+		"T7\tlabValueUnit 49 54\tmg/dL",
+		"R4\tlabValueUnit Arg1:T5 Arg2:T7",
+		"N3\tReference T5 UMLS:C2345-7\tGlucose",
+		"#3\tAnnotatorNotes T5\tconfiguration: clinical",
+	}, lines)
+}
+
+func TestBratTextBoundFragments(t *testing.T) {
+	builder := bratBuilder{runes: []rune("chest\npain"), ids: make(map[byte]int)}
+	id, ok := builder.addTextBound("SignSymptomMention", 0, 10)
+	require.True(t, ok)
+	require.Equal(t, "T1", id)
+	require.Equal(t, []string{"T1\tSignSymptomMention 0 5;6 10\tchest pain"}, builder.lines)
+
+	_, ok = builder.addTextBound("SignSymptomMention", 5, 20)
+	require.False(t, ok)
+}
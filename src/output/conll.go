@@ -0,0 +1,197 @@
+package output
+
+import (
+	"text2phenotype.com/fdl/types"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	conllOutside        = "O"
+	conllBegin          = "B-"
+	conllInside         = "I-"
+	conllMissing        = "_"
+	conllSemanticSuffix = ":semantic"
+	conllPolaritySuffix = ":polarity"
+)
+
+// columns of the tokens which are followed by the label columns of the layers
+var conllTokenColumns = []string{"token", "begin", "end", "pos", "lemma"}
+
+// conllLayer is the configuration result whose annotations become the label columns
+type conllLayer struct {
+	name     string
+	sections []types.ContentSection
+}
+
+// getConllLayers returns the layers of the default clinical and unified results in the order of names
+func (doc Document) getConllLayers() []conllLayer {
+	var result []conllLayer
+	for _, name := range doc.getResultNames() {
+		switch response := doc.Results[name].(type) {
+		case types.DefaultClinicalResponse:
+			result = append(result, conllLayer{name: name, sections: response.Content})
+		case types.UnifiedResponse:
+			sections := make([]types.ContentSection, len(response.Content))
+			for i, section := range response.Content {
+				sections[i] = section.ContentSection
+			}
+			result = append(result, conllLayer{name: name, sections: sections})
+		}
+	}
+	return result
+}
+
+// getLabeledSections returns the annotations which don't overlap each other ordered by offsets, BIO labels can't
+// express overlaps so the first annotation wins and the longest one wins among the annotations with the same begin
+func (layer conllLayer) getLabeledSections() []types.ContentSection {
+	sections := append([]types.ContentSection{}, layer.sections...)
+	sort.SliceStable(sections, func(i, j int) bool {
+		beginI, endI := GetSpan(sections[i])
+		beginJ, endJ := GetSpan(sections[j])
+		if beginI != beginJ {
+			return beginI < beginJ
+		}
+		return endI > endJ
+	})
+
+	var result []types.ContentSection
+	var lastEnd int32
+	for _, section := range sections {
+		begin, end := GetSpan(section)
+		if end <= begin || (len(result) > 0 && begin < lastEnd) {
+			continue
+		}
+		result = append(result, section)
+		lastEnd = end
+	}
+	return result
+}
+
+// conllLabeler assigns the labels of the layer to the tokens in the document order
+type conllLabeler struct {
+	sections []types.ContentSection
+	idx      int
+	// index of the annotation of the previous token, -1 if it's outside
+	lastIdx int
+}
+
+// getLabels returns the BIO label with the annotation name, the semantic group and the polarity of the token
+func (labeler *conllLabeler) getLabels(token *types.Token) []string {
+	for labeler.idx < len(labeler.sections) {
+		_, end := GetSpan(labeler.sections[labeler.idx])
+		if end > token.Begin {
+			break
+		}
+		labeler.idx++
+	}
+	if labeler.idx == len(labeler.sections) {
+		return []string{conllOutside, conllOutside, conllOutside}
+	}
+
+	section := labeler.sections[labeler.idx]
+	begin, _ := GetSpan(section)
+	if token.End <= begin {
+		labeler.lastIdx = -1
+		return []string{conllOutside, conllOutside, conllOutside}
+	}
+
+	prefix := conllInside
+	if labeler.lastIdx != labeler.idx {
+		prefix = conllBegin
+	}
+	labeler.lastIdx = labeler.idx
+
+	semantic, polarity := conllOutside, conllOutside
+	if len(section.Aspect) > 0 {
+		semantic = prefix + section.Aspect
+	}
+	if value := getStringAttribute(section.Attributes, attrPolarity); len(value) > 0 {
+		polarity = prefix + value
+	}
+	return []string{prefix + section.Name, semantic, polarity}
+}
+
+// getConllColumn replaces the whitespace which separates the columns
+func getConllColumn(value string) string {
+	if len(value) == 0 {
+		return conllMissing
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return '_'
+		}
+		return r
+	}, value)
+}
+
+// writeConll writes the tokens of the sentences one per line with the label columns of the layers, sentences are
+// separated by empty lines and the document starts with the comments of the document id and the column names
+func writeConll(doc Document, layers []conllLayer) []byte {
+	var builder strings.Builder
+	runes := []rune(doc.Text)
+
+	docID := doc.GetBaseResponse().DocId
+	if len(docID) == 0 {
+		docID = doc.Tid
+	}
+	columns := append([]string{}, conllTokenColumns...)
+	labelers := make([]*conllLabeler, len(layers))
+	for i, layer := range layers {
+		columns = append(columns, layer.name, layer.name+conllSemanticSuffix, layer.name+conllPolaritySuffix)
+		labelers[i] = &conllLabeler{sections: layer.getLabeledSections(), lastIdx: -1}
+	}
+	builder.WriteString("# doc_id = " + docID + "\n")
+	builder.WriteString("# columns = " + strings.Join(columns, " ") + "\n")
+
+	for _, sent := range doc.Sentences {
+		isEmpty := true
+		for _, token := range sent.Tokens {
+			if token.IsNewline || token.Begin < 0 || token.End <= token.Begin || int(token.End) > len(runes) {
+				continue
+			}
+			isEmpty = false
+
+			line := []string{
+				getConllColumn(string(runes[token.Begin:token.End])),
+				strconv.Itoa(int(token.Begin)),
+				strconv.Itoa(int(token.End)),
+				conllMissing,
+				conllMissing,
+			}
+			if token.Tag != nil {
+				line[3] = getConllColumn(*token.Tag)
+			}
+			if token.Lemma != nil {
+				line[4] = getConllColumn(*token.Lemma)
+			}
+			for _, labeler := range labelers {
+				line = append(line, labeler.getLabels(token)...)
+			}
+			builder.WriteString(strings.Join(line, "\t"))
+			builder.WriteByte('\n')
+		}
+		if !isEmpty {
+			builder.WriteByte('\n')
+		}
+	}
+	return []byte(builder.String())
+}
+
+// renderConll writes the tokens with the label layers of all configurations
+func renderConll(doc Document) ([]byte, error) {
+	return writeConll(doc, doc.getConllLayers()), nil
+}
+
+// renderConllConfigs writes the tokens with the labels of every configuration separately, the result is the JSON
+// object of the CoNLL texts by configuration name
+func renderConllConfigs(doc Document) ([]byte, error) {
+	result := make(map[string]string)
+	for _, layer := range doc.getConllLayers() {
+		result[layer.name] = string(writeConll(doc, []conllLayer{layer}))
+	}
+	return json.Marshal(result)
+}
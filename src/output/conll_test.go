@@ -0,0 +1,99 @@
+package output
+
+import (
+	"text2phenotype.com/fdl/types"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func createTestConllDocument() Document {
+	text := "No chest pain.\nTakes aspirin."
+	tokens := []struct {
+		begin, end int32
+		tag        string
+		isNewline  bool
+	}{
+		{0, 2, "DT", false}, {3, 8, "NN", false}, {9, 13, "NN", false}, {13, 14, ".", false},
+		{14, 15, "", true}, {15, 20, "VBZ", false}, {21, 28, "NN", false}, {28, 29, ".", false},
+	}
+	sentences := []types.Sentence{{Span: types.Span{Begin: 0, End: 14}}, {Span: types.Span{Begin: 15, End: 29}}}
+	runes := []rune(text)
+	for i, tok := range tokens {
+		lemma, tag := strings.ToLower(string(runes[tok.begin:tok.end])), tok.tag
+		token := &types.Token{Span: types.Span{Begin: tok.begin, End: tok.end}, Lemma: &lemma, IsNewline: tok.isNewline}
+		if len(tag) > 0 {
+			token.Tag = &tag
+		}
+		sent := &sentences[0]
+		if i >= 4 {
+			sent = &sentences[1]
+		}
+		sent.Tokens = append(sent.Tokens, token)
+	}
+
+	section := func(text string, begin int32, aspect string, name string, polarity string) types.ContentSection {
+		return types.ContentSection{
+			Text:       []interface{}{text, begin, begin + int32(len(text))},
+			Aspect:     aspect,
+			Name:       name,
+			Attributes: map[string]interface{}{attrPolarity: polarity},
+		}
+	}
+	return Document{
+		Tid:  "doc1",
+		Text: text,
+		Results: map[string]interface{}{
+			"clinical": types.DefaultClinicalResponse{
+				BaseResponse: types.BaseResponse{DocId: "doc1"},
+				Content: []types.ContentSection{
+					section("chest pain", 3, "sign", "SignSymptomMention", "negative"),
+					section("chest", 3, "anat", "AnatomicalSiteMention", "negative"),
+					section("aspirin", 21, "drug", "MedicationMention", "positive"),
+				},
+			},
+			"drugs": types.DefaultClinicalResponse{
+				Content: []types.ContentSection{section("aspirin", 21, "drug", "MedicationMention", "positive")},
+			},
+		},
+		Sentences: sentences,
+	}
+}
+
+func TestRenderConll(t *testing.T) {
+	format, err := GetFormat(FormatConll)
+	require.NoError(t, err)
+	require.True(t, format.WithSentences)
+	buf, err := format.Render(createTestConllDocument())
+	require.NoError(t, err)
+
+	require.Equal(t, strings.Join([]string{
+		"# doc_id = doc1",
+		"# columns = token begin end pos lemma clinical clinical:semantic clinical:polarity drugs drugs:semantic drugs:polarity",
+		"No\t0\t2\tDT\tno\tO\tO\tO\tO\tO\tO",
+		"chest\t3\t8\tNN\tchest\tB-SignSymptomMention\tB-sign\tB-negative\tO\tO\tO",
+		"pain\t9\t13\tNN\tpain\tI-SignSymptomMention\tI-sign\tI-negative\tO\tO\tO",
+		".\t13\t14\t.\t.\tO\tO\tO\tO\tO\tO",
+		"",
+		"Takes\t15\t20\tVBZ\ttakes\tO\tO\tO\tO\tO\tO",
+		"aspirin\t21\t28\tNN\taspirin\tB-MedicationMention\tB-drug\tB-positive\tB-MedicationMention\tB-drug\tB-positive",
+		".\t28\t29\t.\t.\tO\tO\tO\tO\tO\tO",
+		"",
+		"",
+	}, "\n"), string(buf))
+}
+
+func TestRenderConllConfigs(t *testing.T) {
+	format, err := GetFormat(FormatConllConfigs)
+	require.NoError(t, err)
+	buf, err := format.Render(createTestConllDocument())
+	require.NoError(t, err)
+
+	parts := make(map[string]string)
+	require.NoError(t, json.Unmarshal(buf, &parts))
+	require.Len(t, parts, 2)
+	require.Contains(t, parts["drugs"], "# columns = token begin end pos lemma drugs drugs:semantic drugs:polarity\n")
+	require.Contains(t, parts["drugs"], "aspirin\t21\t28\tNN\taspirin\tB-MedicationMention\tB-drug\tB-positive\n")
+	require.NotContains(t, parts["drugs"], "clinical")
+}
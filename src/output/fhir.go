@@ -0,0 +1,364 @@
+package output
+
+import (
+	"text2phenotype.com/fdl/smoking"
+	"text2phenotype.com/fdl/types"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// attributes of the annotations set by the pipeline annotators
+const (
+	attrPolarity           = "polarity"
+	attrMedDosage          = "medDosage"
+	attrMedRoute           = "medRoute"
+	attrMedFrequencyNumber = "medFrequencyNumber"
+	attrMedFrequencyUnit   = "medFrequencyUnit"
+	attrMedStatusChange    = "medStatusChange"
+	attrMedForm            = "medForm"
+	attrMedDuration        = "medDuration"
+	attrMedStrengthNum     = "medStrengthNum"
+	attrMedStrengthUnit    = "medStrengthUnit"
+	attrLabValue           = "labValue"
+	attrLabValueUnit       = "labValueUnit"
+
+	polarityPositive = "positive"
+	polarityNegative = "negative"
+	medStatusStop    = "stop"
+)
+
+const (
+	fhirTextSpanExtension   = "http://text2phenotype.com/fhir/StructureDefinition/text-span"
+	fhirUMLSSystem          = "http://www.nlm.nih.gov/research/umls"
+	fhirConditionVerStatus  = "http://terminology.hl7.org/CodeSystem/condition-ver-status"
+	fhirConditionCategory   = "http://terminology.hl7.org/CodeSystem/condition-category"
+	fhirObservationCategory = "http://terminology.hl7.org/CodeSystem/observation-category"
+	fhirLOINCSystem         = "http://loinc.org"
+	fhirSNOMEDSystem        = "http://snomed.info/sct"
+	fhirUCUMSystem          = "http://unitsofmeasure.org"
+	fhirSmokingProfile      = "http://hl7.org/fhir/us/core/StructureDefinition/us-core-smokingstatus"
+	fhirSmokingStatusCode   = "72166-2"
+)
+
+// fhirSystems maps UMLS source abbreviations to FHIR code system URLs, other sources get the UMLS based URL
+var fhirSystems = map[string]string{
+	"SNOMEDCT_US": fhirSNOMEDSystem,
+	"ICD10CM":     "http://hl7.org/fhir/sid/icd-10-cm",
+	"ICD9CM":      "http://hl7.org/fhir/sid/icd-9-cm",
+	"RXNORM":      "http://www.nlm.nih.gov/research/umls/rxnorm",
+	"LNC":         fhirLOINCSystem,
+	"CPT":         "http://www.ama-assn.org/go/cpt",
+	"HCPCS":       "urn:oid:2.16.840.1.113883.6.285",
+	"MSH":         "urn:oid:2.16.840.1.113883.6.177",
+	"NDC":         "http://hl7.org/fhir/sid/ndc",
+}
+
+// fhirSmokingStatuses maps the smoking classes to the SNOMED codes of the US Core smoking status value set
+var fhirSmokingStatuses = map[string]fhirCoding{
+	smoking.ClassCurrSmoker: {System: fhirSNOMEDSystem, Code: "77176002", Display: "Smoker"},
+	smoking.ClassSmoker:     {System: fhirSNOMEDSystem, Code: "77176002", Display: "Smoker"},
+	smoking.ClassPastSmoker: {System: fhirSNOMEDSystem, Code: "8517006", Display: "Ex-smoker"},
+	smoking.ClassNonSmoker:  {System: fhirSNOMEDSystem, Code: "266919005", Display: "Never smoked tobacco"},
+	smoking.ClassUnknown:    {System: fhirSNOMEDSystem, Code: "266927001", Display: "Tobacco smoking consumption unknown"},
+}
+
+type fhirCoding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type fhirCodeableConcept struct {
+	Coding []fhirCoding `json:"coding,omitempty"`
+	Text   string       `json:"text,omitempty"`
+}
+
+type fhirReference struct {
+	Reference string `json:"reference"`
+}
+
+type fhirExtension struct {
+	URL          string          `json:"url"`
+	ValueString  *string         `json:"valueString,omitempty"`
+	ValueInteger *int32          `json:"valueInteger,omitempty"`
+	Extension    []fhirExtension `json:"extension,omitempty"`
+}
+
+type fhirQuantity struct {
+	Value  float64 `json:"value"`
+	Unit   string  `json:"unit,omitempty"`
+	System string  `json:"system,omitempty"`
+	Code   string  `json:"code,omitempty"`
+}
+
+type fhirMeta struct {
+	Profile []string `json:"profile"`
+}
+
+type fhirTimingRepeat struct {
+	Frequency *int `json:"frequency,omitempty"`
+}
+
+type fhirTiming struct {
+	Repeat *fhirTimingRepeat    `json:"repeat,omitempty"`
+	Code   *fhirCodeableConcept `json:"code,omitempty"`
+}
+
+type fhirDosage struct {
+	Text   string               `json:"text,omitempty"`
+	Timing *fhirTiming          `json:"timing,omitempty"`
+	Route  *fhirCodeableConcept `json:"route,omitempty"`
+}
+
+// fhirResource has the fields of all produced resource types, unused fields are omitted
+type fhirResource struct {
+	ResourceType string          `json:"resourceType"`
+	ID           string          `json:"id"`
+	Meta         *fhirMeta       `json:"meta,omitempty"`
+	Extension    []fhirExtension `json:"extension,omitempty"`
+
+	// Patient
+	Gender    string `json:"gender,omitempty"`
+	BirthDate string `json:"birthDate,omitempty"`
+
+	// Condition, MedicationStatement, Observation
+	Status             string                `json:"status,omitempty"`
+	VerificationStatus *fhirCodeableConcept  `json:"verificationStatus,omitempty"`
+	Category           []fhirCodeableConcept `json:"category,omitempty"`
+	Code               *fhirCodeableConcept  `json:"code,omitempty"`
+	Medication         *fhirCodeableConcept  `json:"medicationCodeableConcept,omitempty"`
+	Subject            *fhirReference        `json:"subject,omitempty"`
+	Dosage             []fhirDosage          `json:"dosage,omitempty"`
+	ValueQuantity      *fhirQuantity         `json:"valueQuantity,omitempty"`
+	ValueString        string                `json:"valueString,omitempty"`
+	ValueCodeable      *fhirCodeableConcept  `json:"valueCodeableConcept,omitempty"`
+}
+
+type fhirEntry struct {
+	FullURL  string        `json:"fullUrl"`
+	Resource *fhirResource `json:"resource"`
+}
+
+type fhirBundle struct {
+	ResourceType string      `json:"resourceType"`
+	ID           string      `json:"id"`
+	Type         string      `json:"type"`
+	Entry        []fhirEntry `json:"entry"`
+}
+
+// getFHIRID returns the name based UUID of the resource, so the same document gets the same ids
+func getFHIRID(parts ...string) string {
+	hash := sha1.Sum([]byte(strings.Join(parts, "\x00")))
+	hash[6] = (hash[6] & 0x0f) | 0x50
+	hash[8] = (hash[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", hash[0:4], hash[4:6], hash[6:8], hash[8:10], hash[10:16])
+}
+
+func getTextSpanExtension(configName string, text string, begin int32, end int32) fhirExtension {
+	return fhirExtension{
+		URL: fhirTextSpanExtension,
+		Extension: []fhirExtension{
+			{URL: "text", ValueString: &text},
+			{URL: "begin", ValueInteger: &begin},
+			{URL: "end", ValueInteger: &end},
+			{URL: "configuration", ValueString: &configName},
+		},
+	}
+}
+
+// getFHIRCodeableConcept builds the coding from the CUIs and the codes of their sources
+func getFHIRCodeableConcept(section types.ContentSection) *fhirCodeableConcept {
+	result := &fhirCodeableConcept{Text: GetText(section)}
+	isKnown := make(map[fhirCoding]bool)
+	add := func(coding fhirCoding) {
+		key := fhirCoding{System: coding.System, Code: coding.Code}
+		if !isKnown[key] {
+			isKnown[key] = true
+			result.Coding = append(result.Coding, coding)
+		}
+	}
+	for _, concept := range section.UmlsConcepts {
+		add(fhirCoding{System: fhirUMLSSystem, Code: concept.Cui, Display: concept.PreferredText})
+		for _, sabConcept := range concept.SabConcepts {
+			system, ok := fhirSystems[strings.ToUpper(sabConcept.CodingScheme)]
+			if !ok {
+				system = fhirUMLSSystem + "/" + strings.ToLower(sabConcept.CodingScheme)
+			}
+			for _, vocabConcept := range sabConcept.VocabConcepts {
+				add(fhirCoding{System: system, Code: vocabConcept.Code})
+			}
+		}
+	}
+	return result
+}
+
+func getConditionVerificationStatus(polarity string) *fhirCodeableConcept {
+	code := "unconfirmed"
+	switch polarity {
+	case polarityPositive:
+		code = "confirmed"
+	case polarityNegative:
+		code = "refuted"
+	}
+	return &fhirCodeableConcept{Coding: []fhirCoding{{System: fhirConditionVerStatus, Code: code}}}
+}
+
+func getMedicationDosage(attributes map[string]interface{}) []fhirDosage {
+	dosage := fhirDosage{}
+	var texts []string
+	if value := getSpanAttribute(attributes, attrMedDosage); len(value) > 0 {
+		texts = append(texts, value)
+	}
+
+	frequencyNumber := getSpanAttribute(attributes, attrMedFrequencyNumber)
+	frequencyUnit := getSpanAttribute(attributes, attrMedFrequencyUnit)
+	if len(frequencyNumber) > 0 || len(frequencyUnit) > 0 {
+		frequencyText := strings.TrimSpace(frequencyNumber + " " + frequencyUnit)
+		texts = append(texts, frequencyText)
+		dosage.Timing = &fhirTiming{Code: &fhirCodeableConcept{Text: frequencyText}}
+		if frequency, err := strconv.Atoi(frequencyNumber); err == nil {
+			dosage.Timing.Repeat = &fhirTimingRepeat{Frequency: &frequency}
+		}
+	}
+
+	if route := getStringAttribute(attributes, attrMedRoute); len(route) > 0 {
+		dosage.Route = &fhirCodeableConcept{Text: route}
+		texts = append(texts, route)
+	}
+
+	if len(texts) == 0 {
+		return nil
+	}
+	dosage.Text = strings.Join(texts, " ")
+	return []fhirDosage{dosage}
+}
+
+func getLabValue(resource *fhirResource, attributes map[string]interface{}) {
+	value := getSpanAttribute(attributes, attrLabValue)
+	if len(value) == 0 {
+		return
+	}
+	unit := getSpanAttribute(attributes, attrLabValueUnit)
+	number, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", ""), 64)
+	if err != nil {
+		resource.ValueString = strings.TrimSpace(value + " " + unit)
+		return
+	}
+	resource.ValueQuantity = &fhirQuantity{Value: number, Unit: unit}
+	if len(unit) > 0 {
+		resource.ValueQuantity.System = fhirUCUMSystem
+		resource.ValueQuantity.Code = unit
+	}
+}
+
+// createFHIRResource converts the disorders and findings to Condition, the drugs to MedicationStatement and
+// the lab mentions to Observation, other annotations are skipped
+func createFHIRResource(section Section, subject *fhirReference) *fhirResource {
+	resource := &fhirResource{Subject: subject}
+	switch section.Aspect {
+	case types.SemanticDisorder.Name(), types.SemanticFinding.Name():
+		resource.ResourceType = "Condition"
+		resource.Code = getFHIRCodeableConcept(section.ContentSection)
+		resource.VerificationStatus = getConditionVerificationStatus(getStringAttribute(section.Attributes, attrPolarity))
+		resource.Category = []fhirCodeableConcept{{Coding: []fhirCoding{{System: fhirConditionCategory, Code: "problem-list-item"}}}}
+	case types.SemanticDrug.Name():
+		resource.ResourceType = "MedicationStatement"
+		resource.Status = "active"
+		if getStringAttribute(section.Attributes, attrMedStatusChange) == medStatusStop {
+			resource.Status = "stopped"
+		}
+		if getStringAttribute(section.Attributes, attrPolarity) == polarityNegative {
+			resource.Status = "not-taken"
+		}
+		resource.Medication = getFHIRCodeableConcept(section.ContentSection)
+		resource.Dosage = getMedicationDosage(section.Attributes)
+	case types.SemanticLab.Name():
+		resource.ResourceType = "Observation"
+		resource.Status = "final"
+		resource.Category = []fhirCodeableConcept{{Coding: []fhirCoding{{System: fhirObservationCategory, Code: "laboratory"}}}}
+		resource.Code = getFHIRCodeableConcept(section.ContentSection)
+		getLabValue(resource, section.Attributes)
+	default:
+		return nil
+	}
+
+	begin, end := GetSpan(section.ContentSection)
+	resource.Extension = []fhirExtension{getTextSpanExtension(section.ConfigName, GetText(section.ContentSection), begin, end)}
+	return resource
+}
+
+func createFHIRSmokingStatus(configName string, response types.SmokingStatusResponse, subject *fhirReference) *fhirResource {
+	value, ok := fhirSmokingStatuses[response.SmokingStatus]
+	if !ok {
+		value = fhirSmokingStatuses[smoking.ClassUnknown]
+	}
+	resource := &fhirResource{
+		ResourceType:  "Observation",
+		Meta:          &fhirMeta{Profile: []string{fhirSmokingProfile}},
+		Status:        "final",
+		Category:      []fhirCodeableConcept{{Coding: []fhirCoding{{System: fhirObservationCategory, Code: "social-history"}}}},
+		Code:          &fhirCodeableConcept{Coding: []fhirCoding{{System: fhirLOINCSystem, Code: fhirSmokingStatusCode, Display: "Tobacco smoking status"}}},
+		Subject:       subject,
+		ValueCodeable: &fhirCodeableConcept{Coding: []fhirCoding{value}, Text: response.SmokingStatus},
+	}
+	for _, sentence := range response.Sentences {
+		if sentence.Status == smoking.ClassUnknown || len(sentence.Text) < 3 {
+			continue
+		}
+		text, _ := sentence.Text[0].(string)
+		begin, _ := sentence.Text[1].(int32)
+		end, _ := sentence.Text[2].(int32)
+		resource.Extension = append(resource.Extension, getTextSpanExtension(configName, text, begin, end))
+	}
+	return resource
+}
+
+// getFHIRGender returns the administrative gender code, the unknown values are omitted
+func getFHIRGender(gender string) string {
+	switch strings.ToLower(strings.TrimSpace(gender)) {
+	case "m", "male":
+		return "male"
+	case "f", "female":
+		return "female"
+	case "o", "other":
+		return "other"
+	}
+	return ""
+}
+
+// renderFHIR produces the FHIR R4 collection Bundle with the Patient of the document and the resources
+// of its annotations
+func renderFHIR(doc Document) ([]byte, error) {
+	base := doc.GetBaseResponse()
+	docID := base.DocId
+	if len(docID) == 0 {
+		docID = doc.Tid
+	}
+
+	bundle := fhirBundle{ResourceType: "Bundle", ID: getFHIRID(docID, "bundle"), Type: "collection"}
+	add := func(resource *fhirResource, parts ...string) {
+		resource.ID = getFHIRID(append([]string{docID, resource.ResourceType}, parts...)...)
+		bundle.Entry = append(bundle.Entry, fhirEntry{FullURL: "urn:uuid:" + resource.ID, Resource: resource})
+	}
+
+	patient := &fhirResource{ResourceType: "Patient", Gender: getFHIRGender(base.Gender), BirthDate: base.Dob}
+	add(patient)
+	subject := &fhirReference{Reference: "urn:uuid:" + patient.ID}
+
+	for i, section := range doc.GetSections() {
+		if resource := createFHIRResource(section, subject); resource != nil {
+			add(resource, section.ConfigName, strconv.Itoa(i))
+		}
+	}
+
+	smokingStatuses := doc.GetSmokingStatuses()
+	for _, name := range doc.getResultNames() {
+		if response, ok := smokingStatuses[name]; ok {
+			add(createFHIRSmokingStatus(name, response, subject), name)
+		}
+	}
+	return json.Marshal(bundle)
+}
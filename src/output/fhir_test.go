@@ -0,0 +1,112 @@
+package output
+
+import (
+	"text2phenotype.com/fdl/smoking"
+	"text2phenotype.com/fdl/types"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func makeSection(text string, begin int32, aspect string, attributes map[string]interface{}, scheme string, code string) types.ContentSection {
+	return types.ContentSection{
+		Text:       []interface{}{text, begin, begin + int32(len(text))},
+		Attributes: attributes,
+		Aspect:     aspect,
+		UmlsConcepts: []types.UmlsConcept{{
+			Cui:           "C" + code,
+			PreferredText: text,
+			SabConcepts: []types.SabConcept{{
+				CodingScheme:  scheme,
+				VocabConcepts: []types.VocabConcept{{Tty: []string{"PT"}, Code: code}},
+			}},
+		}},
+	}
+}
+
+func createTestDocument() Document {
+	text := "No asthma. Aspirin 81 mg po 2 daily. Glucose 105 mg/dL. Former smoker."
+	return Document{
+		Tid:  "doc1",
+		Text: text,
+		Results: map[string]interface{}{
+			"clinical": types.DefaultClinicalResponse{
+				BaseResponse: types.BaseResponse{DocId: "doc1", Gender: "F"},
+				Content: []types.ContentSection{
+					makeSection("asthma", 3, "prob", map[string]interface{}{attrPolarity: "negative"}, "SNOMEDCT_US", "195967001"),
+					makeSection("Aspirin", 11, "drug", map[string]interface{}{
+						attrPolarity:           "positive",
+						attrMedDosage:          "81 mg",
+						attrMedRoute:           "po",
+						attrMedFrequencyNumber: []interface{}{"2", int32(28), int32(29)},
+						attrMedFrequencyUnit:   []interface{}{"daily", int32(30), int32(35)},
+					}, "RXNORM", "1191"),
+					makeSection("Glucose", 37, "lab", map[string]interface{}{
+						attrLabValue:     []interface{}{"105", int32(45), int32(48)},
+						attrLabValueUnit: []interface{}{"mg/dL", int32(49), int32(54)},
+					}, "LNC", "2345-7"),
+					makeSection("knee", 60, "anat", map[string]interface{}{}, "SNOMEDCT_US", "72696002"),
+				},
+			},
+			"smoking": types.SmokingStatusResponse{
+				SmokingStatus: smoking.ClassPastSmoker,
+				Sentences: []types.SmokingStatusSection{
+					{Status: smoking.ClassPastSmoker, Text: []interface{}{"Former smoker.", int32(56), int32(70)}},
+				},
+			},
+		},
+	}
+}
+
+func TestRenderFHIR(t *testing.T) {
+	format, err := GetFormat("FHIR")
+	require.NoError(t, err)
+	buf, err := format.Render(createTestDocument())
+	require.NoError(t, err)
+
+	var bundle fhirBundle
+	require.NoError(t, json.Unmarshal(buf, &bundle))
+	require.Equal(t, "Bundle", bundle.ResourceType)
+	require.Len(t, bundle.Entry, 5)
+
+	patient := bundle.Entry[0].Resource
+	require.Equal(t, "Patient", patient.ResourceType)
+	require.Equal(t, "female", patient.Gender)
+	subject := "urn:uuid:" + patient.ID
+	require.Equal(t, subject, bundle.Entry[0].FullURL)
+
+	condition := bundle.Entry[1].Resource
+	require.Equal(t, "Condition", condition.ResourceType)
+	require.Equal(t, subject, condition.Subject.Reference)
+	require.Equal(t, "refuted", condition.VerificationStatus.Coding[0].Code)
+	require.Equal(t, []fhirCoding{
+		{System: fhirUMLSSystem, Code: "C195967001", Display: "asthma"},
+		{System: fhirSNOMEDSystem, Code: "195967001"},
+	}, condition.Code.Coding)
+	require.Equal(t, int32(3), *condition.Extension[0].Extension[1].ValueInteger)
+
+	medication := bundle.Entry[2].Resource
+	require.Equal(t, "MedicationStatement", medication.ResourceType)
+	require.Equal(t, "active", medication.Status)
+	require.Equal(t, "81 mg 2 daily po", medication.Dosage[0].Text)
+	require.Equal(t, 2, *medication.Dosage[0].Timing.Repeat.Frequency)
+	require.Equal(t, "po", medication.Dosage[0].Route.Text)
+
+	observation := bundle.Entry[3].Resource
+	require.Equal(t, "Observation", observation.ResourceType)
+	require.Equal(t, &fhirQuantity{Value: 105, Unit: "mg/dL", System: fhirUCUMSystem, Code: "mg/dL"}, observation.ValueQuantity)
+
+	smokingStatus := bundle.Entry[4].Resource
+	require.Equal(t, []string{fhirSmokingProfile}, smokingStatus.Meta.Profile)
+	require.Equal(t, fhirSmokingStatusCode, smokingStatus.Code.Coding[0].Code)
+	require.Equal(t, "8517006", smokingStatus.ValueCodeable.Coding[0].Code)
+	require.Len(t, smokingStatus.Extension, 1)
+
+	// ids are stable
+	again, err := format.Render(createTestDocument())
+	require.NoError(t, err)
+	require.Equal(t, string(buf), string(again))
+
+	_, err = GetFormat("hl7v2")
+	require.Error(t, err)
+}
@@ -0,0 +1,212 @@
+package output
+
+import (
+	"text2phenotype.com/fdl/types"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	FormatJSON     = "json"
+	FormatFHIR     = "fhir"
+	FormatBioCJSON = "bioc_json"
+	FormatBioCXML  = "bioc_xml"
+	FormatBrat     = "brat"
+	FormatXMI      = "xmi"
+	FormatCSV      = "csv"
+	FormatTSV      = "tsv"
+	FormatJSONL    = "jsonl"
+	// CoNLL with the label columns of all configurations
+	FormatConll = "conll"
+	// CoNLL texts of every configuration in a JSON object by configuration name
+	FormatConllConfigs = "conll_configs"
+	FormatHTML         = "html"
+)
+
+// UnifiedResultName is the result key of the annotations merged across the configurations
+const UnifiedResultName = "unified"
+
+// Document is the text of the request with the results of all configurations keyed by configuration name:
+// types.DefaultClinicalResponse, types.SmokingStatusResponse or types.UnifiedResponse
+type Document struct {
+	Tid     string
+	Text    string
+	Results map[string]interface{}
+	// sentences with the tagged and lemmatized tokens, set only for the formats WithSentences
+	Sentences []types.Sentence
+}
+
+// Renderer serializes the document to the output format
+type Renderer func(doc Document) ([]byte, error)
+
+type Format struct {
+	Name string
+	// extension of the results file, with the dot
+	Extension   string
+	ContentType string
+	Render      Renderer
+	// the results refer to the text by offsets and the batch export writes the text next to them, like the .txt
+	// file of the brat .ann file
+	WithText bool
+	// the renderer writes the sentences and tokens of the document
+	WithSentences bool
+	// the results of several documents can be appended to one file
+	IsConcatenable bool
+	// the output is a JSON object of texts by configuration name which the batch export writes to
+	// <name>.<configuration><SplitExtension> files
+	SplitExtension string
+}
+
+var formats = map[string]Format{
+	FormatJSON:     {Name: FormatJSON, Extension: ".json", ContentType: "application/json", Render: renderJSON},
+	FormatFHIR:     {Name: FormatFHIR, Extension: ".fhir.json", ContentType: "application/fhir+json", Render: renderFHIR},
+	FormatBioCJSON: {Name: FormatBioCJSON, Extension: ".bioc.json", ContentType: "application/json", Render: renderBioCJSON},
+	FormatBioCXML:  {Name: FormatBioCXML, Extension: ".bioc.xml", ContentType: "application/xml", Render: renderBioCXML},
+	FormatBrat:     {Name: FormatBrat, Extension: ".ann", ContentType: "text/plain; charset=utf-8", Render: renderBrat, WithText: true},
+	FormatXMI:      {Name: FormatXMI, Extension: ".xmi", ContentType: "application/xml", Render: renderXMI, WithSentences: true},
+	FormatCSV:      {Name: FormatCSV, Extension: ".csv", ContentType: "text/csv; charset=utf-8", Render: renderCSV},
+	FormatTSV:      {Name: FormatTSV, Extension: ".tsv", ContentType: "text/tab-separated-values; charset=utf-8", Render: renderTSV},
+	FormatJSONL:    {Name: FormatJSONL, Extension: ".jsonl", ContentType: "application/x-ndjson", Render: renderJSONLines, IsConcatenable: true},
+	FormatConll: {Name: FormatConll, Extension: ".conll", ContentType: "text/plain; charset=utf-8", Render: renderConll,
+		WithSentences: true},
+	FormatConllConfigs: {Name: FormatConllConfigs, Extension: ".conll.json", ContentType: "application/json",
+		Render: renderConllConfigs, WithSentences: true, SplitExtension: ".conll"},
+	FormatHTML: {Name: FormatHTML, Extension: ".html", ContentType: "text/html; charset=utf-8", Render: renderHTML},
+}
+
+// GetFormat returns the format by name, the JSON format is returned for the empty name
+func GetFormat(name string) (Format, error) {
+	if len(name) == 0 {
+		name = FormatJSON
+	}
+	format, ok := formats[strings.ToLower(name)]
+	if !ok {
+		return Format{}, fmt.Errorf("unknown output format %q (allowed: %s)", name, strings.Join(GetFormatNames(), ", "))
+	}
+	return format, nil
+}
+
+func GetFormatNames() []string {
+	var result []string
+	for name := range formats {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func renderJSON(doc Document) ([]byte, error) {
+	return json.Marshal(doc.Results)
+}
+
+// Section is the annotation of the configuration
+type Section struct {
+	ConfigName string
+	types.ContentSection
+}
+
+// GetSections returns the annotations of the unified result if it's present and the annotations
+// of all default clinical configurations otherwise, ordered by configuration name and span
+func (doc Document) GetSections() []Section {
+	var result []Section
+	if unified, ok := doc.Results[UnifiedResultName].(types.UnifiedResponse); ok {
+		for _, section := range unified.Content {
+			result = append(result, Section{ConfigName: UnifiedResultName, ContentSection: section.ContentSection})
+		}
+		return result
+	}
+
+	for _, name := range doc.getResultNames() {
+		if response, ok := doc.Results[name].(types.DefaultClinicalResponse); ok {
+			for _, section := range response.Content {
+				result = append(result, Section{ConfigName: name, ContentSection: section})
+			}
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		beginI, endI := GetSpan(result[i].ContentSection)
+		beginJ, endJ := GetSpan(result[j].ContentSection)
+		if beginI != beginJ {
+			return beginI < beginJ
+		}
+		return endI < endJ
+	})
+	return result
+}
+
+// GetSmokingStatuses returns the smoking status results by configuration name
+func (doc Document) GetSmokingStatuses() map[string]types.SmokingStatusResponse {
+	result := make(map[string]types.SmokingStatusResponse)
+	for name, data := range doc.Results {
+		if response, ok := data.(types.SmokingStatusResponse); ok {
+			result[name] = response
+		}
+	}
+	return result
+}
+
+// GetBaseResponse returns the document fields of the first result
+func (doc Document) GetBaseResponse() types.BaseResponse {
+	for _, name := range doc.getResultNames() {
+		switch response := doc.Results[name].(type) {
+		case types.DefaultClinicalResponse:
+			return response.BaseResponse
+		case types.UnifiedResponse:
+			return response.BaseResponse
+		case types.SmokingStatusResponse:
+			return response.BaseResponse
+		}
+	}
+	return types.BaseResponse{DocId: doc.Tid}
+}
+
+func (doc Document) getResultNames() []string {
+	var result []string
+	for name := range doc.Results {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// GetSpan returns the offsets of the annotation text
+func GetSpan(section types.ContentSection) (int32, int32) {
+	if len(section.Text) < 3 {
+		return 0, 0
+	}
+	begin, _ := section.Text[1].(int32)
+	end, _ := section.Text[2].(int32)
+	return begin, end
+}
+
+// GetText returns the annotation text
+func GetText(section types.ContentSection) string {
+	if len(section.Text) == 0 {
+		return ""
+	}
+	text, _ := section.Text[0].(string)
+	return text
+}
+
+// getSpanAttribute returns the text of the span attribute which is set as [text, begin, end]
+func getSpanAttribute(attributes map[string]interface{}, name string) string {
+	switch value := attributes[name].(type) {
+	case string:
+		return value
+	case []interface{}:
+		if len(value) > 0 {
+			return fmt.Sprint(value[0])
+		}
+	}
+	return ""
+}
+
+// getStringAttribute returns the attribute which is set as a string
+func getStringAttribute(attributes map[string]interface{}, name string) string {
+	if value, ok := attributes[name]; ok && value != nil {
+		return fmt.Sprint(value)
+	}
+	return ""
+}
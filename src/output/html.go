@@ -0,0 +1,288 @@
+package output
+
+import (
+	"bytes"
+	"html/template"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// htmlAnnotation is the annotation data of the page script, it's shown on hover and filtered by the toggles
+type htmlAnnotation struct {
+	ID         int               `json:"id"`
+	Config     string            `json:"config"`
+	Begin      int32             `json:"begin"`
+	End        int32             `json:"end"`
+	Text       string            `json:"text"`
+	Semantic   string            `json:"semantic"`
+	Name       string            `json:"name"`
+	IsNegated  bool              `json:"negated"`
+	Concepts   []htmlConcept     `json:"concepts"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+type htmlConcept struct {
+	Cui           string   `json:"cui"`
+	PreferredText string   `json:"preferredText"`
+	Codes         []string `json:"codes"`
+}
+
+// htmlFragment is the text between two annotation boundaries with the annotations which cover it
+type htmlFragment struct {
+	Text        string
+	Annotations string
+	Class       string
+}
+
+type htmlPage struct {
+	DocID       string
+	Fragments   []htmlFragment
+	Annotations []htmlAnnotation
+	Configs     []string
+	// attribute name=value pairs of the scalar attributes
+	AttributeValues []string
+	Semantics       []string
+	SmokingStatuses map[string]string
+}
+
+// getHTMLClass returns the highlight class of the fragment: the semantic group of the shortest annotation,
+// negated if any of the annotations is negated
+func getHTMLClass(annotations []htmlAnnotation, ids []int) string {
+	if len(ids) == 0 {
+		return ""
+	}
+	best := annotations[ids[0]]
+	isNegated := false
+	for _, id := range ids {
+		ann := annotations[id]
+		if ann.End-ann.Begin < best.End-best.Begin {
+			best = ann
+		}
+		isNegated = isNegated || ann.IsNegated
+	}
+	class := "ann sem-" + best.Semantic
+	if isNegated {
+		class += " negated"
+	}
+	return class
+}
+
+func createHTMLAnnotation(id int, section Section) htmlAnnotation {
+	begin, end := GetSpan(section.ContentSection)
+	ann := htmlAnnotation{
+		ID:         id,
+		Config:     section.ConfigName,
+		Begin:      begin,
+		End:        end,
+		Text:       GetText(section.ContentSection),
+		Semantic:   getBratName(section.Aspect),
+		Name:       section.Name,
+		IsNegated:  getStringAttribute(section.Attributes, attrPolarity) == polarityNegative,
+		Attributes: make(map[string]string),
+	}
+	for _, concept := range section.UmlsConcepts {
+		htmlConcept := htmlConcept{Cui: concept.Cui, PreferredText: concept.PreferredText, Codes: []string{}}
+		for _, sabConcept := range concept.SabConcepts {
+			for _, vocabConcept := range sabConcept.VocabConcepts {
+				htmlConcept.Codes = append(htmlConcept.Codes, sabConcept.CodingScheme+":"+vocabConcept.Code)
+			}
+		}
+		ann.Concepts = append(ann.Concepts, htmlConcept)
+	}
+	for name, value := range section.Attributes {
+		if text := getTableValue(value); text != nil {
+			ann.Attributes[name] = text.(string)
+		}
+	}
+	return ann
+}
+
+// createHTMLPage splits the text at the annotation boundaries into the fragments
+func createHTMLPage(doc Document) htmlPage {
+	page := htmlPage{DocID: doc.GetBaseResponse().DocId, SmokingStatuses: make(map[string]string)}
+	if len(page.DocID) == 0 {
+		page.DocID = doc.Tid
+	}
+	runes := []rune(doc.Text)
+	textLength := int32(len(runes))
+
+	configs := make(map[string]bool)
+	semantics := make(map[string]bool)
+	attributeValues := make(map[string]bool)
+	boundaries := map[int32]bool{0: true, textLength: true}
+	for _, section := range doc.GetSections() {
+		begin, end := GetSpan(section.ContentSection)
+		if begin < 0 || end <= begin || end > textLength {
+			continue
+		}
+		ann := createHTMLAnnotation(len(page.Annotations), section)
+		page.Annotations = append(page.Annotations, ann)
+		boundaries[begin], boundaries[end] = true, true
+		configs[ann.Config] = true
+		semantics[ann.Semantic] = true
+		for name, value := range ann.Attributes {
+			if !strings.HasPrefix(value, "{") && !strings.HasPrefix(value, "[") {
+				attributeValues[name+"="+value] = true
+			}
+		}
+	}
+	for name, response := range doc.GetSmokingStatuses() {
+		page.SmokingStatuses[name] = response.SmokingStatus
+	}
+
+	toSortedList := func(values map[string]bool) []string {
+		result := make([]string, 0, len(values))
+		for value := range values {
+			result = append(result, value)
+		}
+		sort.Strings(result)
+		return result
+	}
+	page.Configs = toSortedList(configs)
+	page.Semantics = toSortedList(semantics)
+	page.AttributeValues = toSortedList(attributeValues)
+
+	offsets := make([]int32, 0, len(boundaries))
+	for offset := range boundaries {
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	for i := 0; i+1 < len(offsets); i++ {
+		begin, end := offsets[i], offsets[i+1]
+		var ids []int
+		var idTexts []string
+		for _, ann := range page.Annotations {
+			if ann.Begin <= begin && end <= ann.End {
+				ids = append(ids, ann.ID)
+				idTexts = append(idTexts, strconv.Itoa(ann.ID))
+			}
+		}
+		page.Fragments = append(page.Fragments, htmlFragment{
+			Text:        string(runes[begin:end]),
+			Annotations: strings.Join(idTexts, " "),
+			Class:       getHTMLClass(page.Annotations, ids),
+		})
+	}
+	return page
+}
+
+var htmlTemplate = template.Must(template.New("document").Parse(htmlPageTemplate))
+
+// renderHTML writes the standalone page of the document: annotations are highlighted by semantic group, negated
+// ones are struck through, hovering shows the CUIs, codes and attributes and the toggles filter the annotations
+// by configuration and attribute value
+func renderHTML(doc Document) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := htmlTemplate.Execute(&buf, createHTMLPage(doc)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+const htmlPageTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.DocID}}</title>
+<style>
+body { font-family: sans-serif; margin: 0; display: flex; }
+#filters { width: 240px; padding: 12px; border-right: 1px solid #ddd; font-size: 13px; flex-shrink: 0; }
+#filters h3 { font-size: 14px; margin: 12px 0 4px; }
+#filters label { display: block; }
+#text { padding: 12px 24px; white-space: pre-wrap; font-family: monospace; font-size: 14px; line-height: 1.6; }
+.ann { border-radius: 3px; cursor: pointer; background: #e0e0e0; }
+.negated { text-decoration: line-through; }
+.sem-drug { background: #c8e6c9; }
+.sem-prob { background: #ffcdd2; }
+.sem-symp { background: #ffe0b2; }
+.sem-proc { background: #bbdefb; }
+.sem-anat { background: #e1bee7; }
+.sem-device { background: #d7ccc8; }
+.sem-lab { background: #b2ebf2; }
+.sem-pheno { background: #f0f4c3; }
+.sem-activity { background: #c5cae9; }
+#tooltip { position: absolute; display: none; background: #fff; border: 1px solid #999; padding: 8px;
+  font-size: 12px; max-width: 420px; box-shadow: 2px 2px 6px rgba(0,0,0,.2); white-space: normal; }
+#tooltip .item { margin-bottom: 6px; }
+</style>
+</head>
+<body>
+<div id="filters">
+<strong>{{.DocID}}</strong>
+{{range $name, $status := .SmokingStatuses}}<div>{{$name}}: {{$status}}</div>{{end}}
+<h3>Configurations</h3>
+{{range .Configs}}<label><input type="checkbox" class="filter-config" value="{{.}}" checked> {{.}}</label>{{end}}
+<h3>Semantic groups</h3>
+{{range .Semantics}}<label><input type="checkbox" class="filter-semantic" value="{{.}}" checked> <span class="ann sem-{{.}}">{{.}}</span></label>{{end}}
+<h3>Attributes</h3>
+{{range .AttributeValues}}<label><input type="checkbox" class="filter-attribute" value="{{.}}" checked> {{.}}</label>{{end}}
+</div>
+<div id="text">{{range .Fragments}}{{if .Annotations}}<span class="{{.Class}}" data-anns="{{.Annotations}}">{{.Text}}</span>{{else}}{{.Text}}{{end}}{{end}}</div>
+<div id="tooltip"></div>
+<script type="application/json" id="annotations">{{.Annotations}}</script>
+<script>
+(function () {
+  var annotations = JSON.parse(document.getElementById("annotations").textContent) || [];
+  var tooltip = document.getElementById("tooltip");
+
+  function checkedValues(cls) {
+    var result = {};
+    document.querySelectorAll("." + cls).forEach(function (input) { result[input.value] = input.checked; });
+    return result;
+  }
+
+  function visibleAnnotations(span) {
+    var configs = checkedValues("filter-config"), semantics = checkedValues("filter-semantic"),
+      attributes = checkedValues("filter-attribute");
+    return span.dataset.anns.split(" ").map(Number).map(function (id) { return annotations[id]; }).filter(function (ann) {
+      if (!configs[ann.config] || !semantics[ann.semantic]) { return false; }
+      for (var name in ann.attributes) {
+        if (attributes[name + "=" + ann.attributes[name]] === false) { return false; }
+      }
+      return true;
+    });
+  }
+
+  function update() {
+    document.querySelectorAll("#text span[data-anns]").forEach(function (span) {
+      var visible = visibleAnnotations(span);
+      if (visible.length === 0) { span.className = ""; return; }
+      var best = visible.reduce(function (a, b) { return b.end - b.begin < a.end - a.begin ? b : a; });
+      span.className = "ann sem-" + best.semantic + (visible.some(function (ann) { return ann.negated; }) ? " negated" : "");
+    });
+  }
+
+  function escape(value) {
+    var div = document.createElement("div");
+    div.textContent = value;
+    return div.innerHTML;
+  }
+
+  document.querySelectorAll("#filters input").forEach(function (input) { input.addEventListener("change", update); });
+  document.querySelectorAll("#text span[data-anns]").forEach(function (span) {
+    span.addEventListener("mouseenter", function (event) {
+      var visible = visibleAnnotations(span);
+      if (visible.length === 0) { return; }
+      tooltip.innerHTML = visible.map(function (ann) {
+        var html = "<b>" + escape(ann.text) + "</b> " + escape(ann.name) + " (" + escape(ann.config) + ")";
+        (ann.concepts || []).forEach(function (concept) {
+          html += "<br>" + escape(concept.cui) + " " + escape(concept.preferredText) + " " + escape(concept.codes.join(", "));
+        });
+        Object.keys(ann.attributes).sort().forEach(function (name) {
+          html += "<br><i>" + escape(name) + "</i>: " + escape(ann.attributes[name]);
+        });
+        return "<div class=\"item\">" + html + "</div>";
+      }).join("");
+      tooltip.style.left = (event.pageX + 10) + "px";
+      tooltip.style.top = (event.pageY + 10) + "px";
+      tooltip.style.display = "block";
+    });
+    span.addEventListener("mouseleave", function () { tooltip.style.display = "none"; });
+  });
+})();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,57 @@
+package output
+
+import (
+	"text2phenotype.com/fdl/types"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestCreateHTMLPage(t *testing.T) {
+	doc := Document{
+		Tid:  "doc1",
+		Text: "No chest pain.",
+		Results: map[string]interface{}{
+			"clinical": types.DefaultClinicalResponse{
+				Content: []types.ContentSection{
+					makeSection("chest pain", 3, "symp", map[string]interface{}{attrPolarity: "negative"}, "SNOMEDCT_US", "29857009"),
+					makeSection("chest", 3, "anat", map[string]interface{}{attrPolarity: "negative"}, "SNOMEDCT_US", "51185008"),
+				},
+			},
+		},
+	}
+	page := createHTMLPage(doc)
+
+	require.Equal(t, []string{"clinical"}, page.Configs)
+	require.Equal(t, []string{"anat", "symp"}, page.Semantics)
+	require.Equal(t, []string{"polarity=negative"}, page.AttributeValues)
+	require.Equal(t, []htmlFragment{
+		{Text: "No "},
+		{Text: "chest", Annotations: "0 1", Class: "ann sem-anat negated"},
+		{Text: " pain", Annotations: "1", Class: "ann sem-symp negated"},
+		{Text: "."},
+	}, page.Fragments)
+	require.Equal(t, []string{"SNOMEDCT_US:29857009"}, page.Annotations[1].Concepts[0].Codes)
+}
+
+func TestRenderHTML(t *testing.T) {
+	doc := createTestDocument()
+	doc.Text = strings.Replace(doc.Text, "Former smoker.", "<b>x</b></script>", 1)
+	clinical := doc.Results["clinical"].(types.DefaultClinicalResponse)
+	clinical.Content[3].Text[0] = "</script>"
+
+	format, err := GetFormat(FormatHTML)
+	require.NoError(t, err)
+	buf, err := format.Render(doc)
+	require.NoError(t, err)
+
+	page := string(buf)
+	require.True(t, strings.HasPrefix(page, "<!DOCTYPE html>"))
+	require.Contains(t, page, `<span class="ann sem-prob negated" data-anns="0">asthma</span>`)
+	require.Contains(t, page, `value="clinical" checked`)
+	require.Contains(t, page, "&lt;b&gt;x")
+	require.Contains(t, page, "&lt;/script&gt;</div>")
+	require.Contains(t, page, `"text":"\u003c/script\u003e"`)
+	require.Contains(t, page, `"cui":"C195967001"`)
+	require.Equal(t, 2, strings.Count(page, "</script>"))
+}
@@ -0,0 +1,197 @@
+package output
+
+import (
+	"text2phenotype.com/fdl/types"
+	"encoding/json"
+	"fmt"
+)
+
+// jsonV2Format is the JSON format of the response v2
+var jsonV2Format = Format{Name: FormatJSON, Extension: ".json", ContentType: "application/json", Render: renderJSONV2}
+
+// WithVersion returns the format of the response version, the empty version is version 1. Version 2 is the typed
+// JSON response, other formats have their own schemas and support only version 1.
+func WithVersion(format Format, version string) (Format, error) {
+	switch version {
+	case "", types.ResponseVersion1:
+		return format, nil
+	case types.ResponseVersion2:
+		if format.Name != FormatJSON {
+			return format, fmt.Errorf("response version %s is supported by the %s format only", version, FormatJSON)
+		}
+		return jsonV2Format, nil
+	}
+	return format, fmt.Errorf("unknown response version %q (allowed: %s, %s)", version, types.ResponseVersion1, types.ResponseVersion2)
+}
+
+func renderJSONV2(doc Document) ([]byte, error) {
+	return json.Marshal(CreateResponseV2(doc))
+}
+
+// getSpanV2 returns the span attribute which is set as [text, begin, end], nil for empty attributes
+func getSpanV2(value interface{}) *types.SpanV2 {
+	text, begin, end, ok := getSpanAttributeOffsets(value)
+	if !ok {
+		return nil
+	}
+	return &types.SpanV2{Text: text, Begin: begin, End: end}
+}
+
+// createAttributesV2 moves the known attributes to the typed fields, nil and empty attributes are dropped
+func createAttributesV2(attributes map[string]interface{}) types.AttributesV2 {
+	var result types.AttributesV2
+	var drug types.DrugAttributesV2
+	var lab types.LabAttributesV2
+	isDrug, isLab := false, false
+
+	setString := func(target *string, isSet *bool, name string) {
+		if value, ok := getInfonValue(attributes[name]); ok && len(value) > 0 {
+			*target, *isSet = value, true
+		}
+	}
+	setSpan := func(target **types.SpanV2, isSet *bool, name string) {
+		if span := getSpanV2(attributes[name]); span != nil {
+			*target, *isSet = span, true
+		}
+	}
+
+	for name, value := range attributes {
+		switch name {
+		case attrPolarity:
+			if polarity, ok := getInfonValue(value); ok && len(polarity) > 0 {
+				result.Assertion = &types.AssertionV2{Polarity: polarity}
+			}
+		case attrMedDosage:
+			setString(&drug.Dosage, &isDrug, name)
+		case attrMedForm:
+			setString(&drug.Form, &isDrug, name)
+		case attrMedRoute:
+			setString(&drug.Route, &isDrug, name)
+		case attrMedDuration:
+			setString(&drug.Duration, &isDrug, name)
+		case attrMedStatusChange:
+			setString(&drug.StatusChange, &isDrug, name)
+		case attrMedStrengthNum:
+			setSpan(&drug.StrengthNumber, &isDrug, name)
+		case attrMedStrengthUnit:
+			setSpan(&drug.StrengthUnit, &isDrug, name)
+		case attrMedFrequencyNumber:
+			setSpan(&drug.FrequencyNumber, &isDrug, name)
+		case attrMedFrequencyUnit:
+			setSpan(&drug.FrequencyUnit, &isDrug, name)
+		case attrLabValue:
+			setSpan(&lab.Value, &isLab, name)
+		case attrLabValueUnit:
+			setSpan(&lab.Unit, &isLab, name)
+		default:
+			if value == nil {
+				continue
+			}
+			if result.Other == nil {
+				result.Other = make(map[string]interface{})
+			}
+			result.Other[name] = value
+		}
+	}
+	if isDrug {
+		result.Drug = &drug
+	}
+	if isLab {
+		result.Lab = &lab
+	}
+	return result
+}
+
+func createConceptsV2(concepts []types.UmlsConcept) []types.ConceptV2 {
+	result := make([]types.ConceptV2, len(concepts))
+	for i, concept := range concepts {
+		result[i] = types.ConceptV2{
+			Cui:           concept.Cui,
+			PreferredText: concept.PreferredText,
+			Tuis:          append([]string{}, concept.Tui...),
+			Codes:         []types.CodeV2{},
+			Rank:          concept.Rank,
+			Score:         concept.Score,
+			Sources:       concept.Sources,
+		}
+		for _, sabConcept := range concept.SabConcepts {
+			for _, vocabConcept := range sabConcept.VocabConcepts {
+				result[i].Codes = append(result[i].Codes, types.CodeV2{
+					CodingScheme: sabConcept.CodingScheme,
+					Code:         vocabConcept.Code,
+					Ttys:         append([]string{}, vocabConcept.Tty...),
+				})
+			}
+		}
+	}
+	return result
+}
+
+func createAnnotationV2(section types.ContentSection) types.AnnotationV2 {
+	begin, end := GetSpan(section)
+	result := types.AnnotationV2{
+		Id:         section.Id,
+		Span:       types.SpanV2{Text: GetText(section), Begin: begin, End: end},
+		Semantic:   section.Aspect,
+		Name:       section.Name,
+		Attributes: createAttributesV2(section.Attributes),
+		Concepts:   createConceptsV2(section.UmlsConcepts),
+	}
+	if len(section.Sentence) == 2 {
+		result.Sentence = &types.OffsetsV2{Begin: section.Sentence[0], End: section.Sentence[1]}
+	}
+	if len(section.SectionOffset) == 2 {
+		result.Section = &types.SectionV2{Oid: section.SectionOid, Begin: section.SectionOffset[0], End: section.SectionOffset[1]}
+	}
+	return result
+}
+
+func createSmokingStatusV2(response types.SmokingStatusResponse) *types.SmokingStatusV2 {
+	result := &types.SmokingStatusV2{Status: response.SmokingStatus, Sentences: []types.SmokingSentenceV2{}}
+	for _, sentence := range response.Sentences {
+		text, begin, end, _ := getSpanAttributeOffsets(sentence.Text)
+		result.Sentences = append(result.Sentences, types.SmokingSentenceV2{
+			Status: sentence.Status,
+			Span:   types.SpanV2{Text: text, Begin: begin, End: end},
+		})
+	}
+	return result
+}
+
+// CreateResponseV2 converts the configuration results of the document to the typed response
+func CreateResponseV2(doc Document) types.ResponseV2 {
+	base := doc.GetBaseResponse()
+	response := types.ResponseV2{
+		Version: types.ResponseVersion2,
+		DocId:   base.DocId,
+		Dob:     base.Dob,
+		Gender:  base.Gender,
+		Age:     base.Age,
+		Results: make(map[string]types.ConfigResultV2),
+	}
+
+	for name, data := range doc.Results {
+		switch result := data.(type) {
+		case types.DefaultClinicalResponse:
+			annotations := make([]types.AnnotationV2, len(result.Content))
+			for i, section := range result.Content {
+				annotations[i] = createAnnotationV2(section)
+			}
+			response.Results[name] = types.ConfigResultV2{Type: types.ResultTypeDefaultClinical, Annotations: annotations}
+		case types.UnifiedResponse:
+			annotations := make([]types.AnnotationV2, len(result.Content))
+			for i, section := range result.Content {
+				annotations[i] = createAnnotationV2(section.ContentSection)
+				annotations[i].Sources = section.Sources
+				annotations[i].Conflicts = section.Conflicts
+			}
+			response.Results[name] = types.ConfigResultV2{Type: types.ResultTypeUnified, Annotations: annotations}
+		case types.SmokingStatusResponse:
+			response.Results[name] = types.ConfigResultV2{
+				Type:          types.ResultTypeSmokingStatus,
+				SmokingStatus: createSmokingStatusV2(result),
+			}
+		}
+	}
+	return response
+}
@@ -0,0 +1,85 @@
+package output
+
+import (
+	"text2phenotype.com/fdl/types"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestCreateResponseV2(t *testing.T) {
+	doc := createTestDocument()
+	clinical := doc.Results["clinical"].(types.DefaultClinicalResponse)
+	clinical.Content[1].Sentence = []int32{11, 36}
+	clinical.Content[1].Attributes[attrMedStrengthNum] = []interface{}{}
+	clinical.Content[1].Attributes["abbreviation"] = map[string]interface{}{"text": "ASA"}
+	doc.Results["clinical"] = clinical
+
+	format, err := WithVersion(Format{Name: FormatJSON}, types.ResponseVersion2)
+	require.NoError(t, err)
+	buf, err := format.Render(doc)
+	require.NoError(t, err)
+
+	var response types.ResponseV2
+	require.NoError(t, json.Unmarshal(buf, &response))
+	require.Equal(t, types.ResponseVersion2, response.Version)
+	require.Equal(t, "F", response.Gender)
+
+	result := response.Results["clinical"]
+	require.Equal(t, types.ResultTypeDefaultClinical, result.Type)
+	require.Len(t, result.Annotations, 4)
+
+	asthma := result.Annotations[0]
+	require.Equal(t, types.SpanV2{Text: "asthma", Begin: 3, End: 9}, asthma.Span)
+	require.Equal(t, &types.AssertionV2{Polarity: "negative"}, asthma.Attributes.Assertion)
+	require.Nil(t, asthma.Attributes.Drug)
+	require.Equal(t, []types.CodeV2{{CodingScheme: "SNOMEDCT_US", Code: "195967001", Ttys: []string{"PT"}}}, asthma.Concepts[0].Codes)
+
+	aspirin := result.Annotations[1]
+	require.Equal(t, &types.OffsetsV2{Begin: 11, End: 36}, aspirin.Sentence)
+	require.Equal(t, &types.DrugAttributesV2{
+		Dosage:          "81 mg",
+		Route:           "po",
+		FrequencyNumber: &types.SpanV2{Text: "2", Begin: 28, End: 29},
+		FrequencyUnit:   &types.SpanV2{Text: "daily", Begin: 30, End: 35},
+	}, aspirin.Attributes.Drug)
+	require.Equal(t, map[string]interface{}{"abbreviation": map[string]interface{}{"text": "ASA"}}, aspirin.Attributes.Other)
+
+	glucose := result.Annotations[2]
+	require.Equal(t, &types.LabAttributesV2{
+		Value: &types.SpanV2{Text: "105", Begin: 45, End: 48},
+		Unit:  &types.SpanV2{Text: "mg/dL", Begin: 49, End: 54},
+	}, glucose.Attributes.Lab)
+
+	smoking := response.Results["smoking"]
+	require.Equal(t, types.ResultTypeSmokingStatus, smoking.Type)
+	require.Equal(t, "PAST_SMOKER", smoking.SmokingStatus.Status)
+	require.Equal(t, types.SpanV2{Text: "Former smoker.", Begin: 56, End: 70}, smoking.SmokingStatus.Sentences[0].Span)
+}
+
+func TestWithVersion(t *testing.T) {
+	format, err := WithVersion(formats[FormatFHIR], "")
+	require.NoError(t, err)
+	require.Equal(t, FormatFHIR, format.Name)
+
+	_, err = WithVersion(formats[FormatFHIR], types.ResponseVersion2)
+	require.Error(t, err)
+	_, err = WithVersion(formats[FormatJSON], "3")
+	require.Error(t, err)
+}
+
+// TestResponseV2Schema checks that the published schema is up to date with the response types
+func TestResponseV2Schema(t *testing.T) {
+	schema, err := ResponseV2Schema()
+	require.NoError(t, err)
+	published, err := os.ReadFile("../../resources/schema/response_v2.schema.json")
+	require.NoError(t, err)
+	require.Equal(t, string(published), string(schema)+"\n", "regenerate the schema with \"fdl schema v2\"")
+
+	var parsed map[string]interface{}
+	require.NoError(t, json.Unmarshal(schema, &parsed))
+	defs := parsed["$defs"].(map[string]interface{})
+	require.Contains(t, defs, "DrugAttributesV2")
+	require.Contains(t, defs, "SpanV2")
+}
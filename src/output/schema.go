@@ -0,0 +1,108 @@
+package output
+
+import (
+	"text2phenotype.com/fdl/types"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const (
+	jsonSchemaDraft    = "https://json-schema.org/draft/2020-12/schema"
+	jsonSchemaDefsPath = "#/$defs/"
+)
+
+// jsonSchema is the subset of JSON Schema which describes the response structs
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Defs                 map[string]*jsonSchema `json:"$defs,omitempty"`
+}
+
+// jsonSchemaBuilder creates the schemas of the types, structs are definitions referenced by their type name
+type jsonSchemaBuilder struct {
+	defs map[string]*jsonSchema
+}
+
+func (builder *jsonSchemaBuilder) create(t reflect.Type) *jsonSchema {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return builder.create(t.Elem())
+	case reflect.String:
+		return &jsonSchema{Type: "string"}
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &jsonSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &jsonSchema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &jsonSchema{Type: "array", Items: builder.create(t.Elem())}
+	case reflect.Map:
+		return &jsonSchema{Type: "object", AdditionalProperties: builder.create(t.Elem())}
+	case reflect.Interface:
+		// any JSON value
+		return &jsonSchema{}
+	case reflect.Struct:
+		if _, ok := builder.defs[t.Name()]; !ok {
+			builder.defs[t.Name()] = nil
+			builder.defs[t.Name()] = builder.createStruct(t)
+		}
+		return &jsonSchema{Ref: jsonSchemaDefsPath + t.Name()}
+	}
+	panic(fmt.Sprintf("JSON schema of %s is not supported", t))
+}
+
+// createStruct describes the JSON fields of the struct, fields without omitempty are required
+func (builder *jsonSchemaBuilder) createStruct(t reflect.Type) *jsonSchema {
+	result := &jsonSchema{Type: "object", Properties: make(map[string]*jsonSchema), AdditionalProperties: false}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name
+		}
+		result.Properties[name] = builder.create(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			result.Required = append(result.Required, name)
+		}
+	}
+	return result
+}
+
+// CreateJSONSchema creates the JSON Schema of the JSON encoding of the value type
+func CreateJSONSchema(value interface{}, title string) ([]byte, error) {
+	builder := jsonSchemaBuilder{defs: make(map[string]*jsonSchema)}
+	root := builder.create(reflect.TypeOf(value))
+	if len(root.Ref) > 0 {
+		name := strings.TrimPrefix(root.Ref, jsonSchemaDefsPath)
+		root = builder.defs[name]
+		delete(builder.defs, name)
+	}
+	schema := *root
+	schema.Schema = jsonSchemaDraft
+	schema.Title = title
+	if len(builder.defs) > 0 {
+		schema.Defs = builder.defs
+	}
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// ResponseV2Schema returns the JSON Schema of the response v2
+func ResponseV2Schema() ([]byte, error) {
+	return CreateJSONSchema(types.ResponseV2{}, "FDL response v2")
+}
@@ -0,0 +1,192 @@
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// columns of the flat annotation rows, followed by the attribute columns
+var tableColumns = []string{
+	"doc_id", "config", "begin", "end", "text", "sentence_begin", "sentence_end", "semantic", "name", "polarity",
+	"cui", "preferred_text", "tui", "coding_scheme", "code", "tty",
+}
+
+// attributes which always have a column so the files of a corpus share the header, other attributes of the document
+// are added after them in the order of names
+var tableAttributes = []string{
+	attrMedDosage, attrMedForm, attrMedRoute, attrMedDuration, attrMedStatusChange, attrMedStrengthNum, attrMedStrengthUnit,
+	attrMedFrequencyNumber, attrMedFrequencyUnit, attrLabValue, attrLabValueUnit,
+}
+
+// tableListSeparator joins the TUIs and TTYs in one column
+const tableListSeparator = ";"
+
+// getTableAttributes returns the attribute columns of the document
+func getTableAttributes(sections []Section) []string {
+	result := append([]string{}, tableAttributes...)
+	isKnown := map[string]bool{attrPolarity: true}
+	for _, name := range tableAttributes {
+		isKnown[name] = true
+	}
+	var other []string
+	for _, section := range sections {
+		for name := range section.Attributes {
+			if !isKnown[name] {
+				isKnown[name] = true
+				other = append(other, name)
+			}
+		}
+	}
+	sort.Strings(other)
+	return append(result, other...)
+}
+
+// getTableValue returns the column value of the attribute: the text of span attributes, strings as they are
+// and other values as JSON, missing and empty attributes are nil
+func getTableValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case nil:
+		return nil
+	case string:
+		if len(typed) == 0 {
+			return nil
+		}
+		return typed
+	case []interface{}:
+		if len(typed) == 0 {
+			return nil
+		}
+		if text, _, _, ok := getSpanAttributeOffsets(typed); ok {
+			return text
+		}
+	}
+	if infon, ok := getInfonValue(value); ok {
+		return infon
+	}
+	return nil
+}
+
+// getTableRows flattens the annotations into one row per annotation, concept and code. Annotations without concepts
+// and concepts without codes have one row with the empty concept or code columns.
+func getTableRows(doc Document) ([]string, [][]interface{}) {
+	sections := doc.GetSections()
+	attributes := getTableAttributes(sections)
+	columns := append(append([]string{}, tableColumns...), attributes...)
+
+	docID := doc.GetBaseResponse().DocId
+	if len(docID) == 0 {
+		docID = doc.Tid
+	}
+
+	var rows [][]interface{}
+	for _, section := range sections {
+		begin, end := GetSpan(section.ContentSection)
+		var sentenceBegin, sentenceEnd interface{}
+		if len(section.Sentence) == 2 {
+			sentenceBegin, sentenceEnd = section.Sentence[0], section.Sentence[1]
+		}
+		annotation := []interface{}{
+			docID, section.ConfigName, begin, end, GetText(section.ContentSection), sentenceBegin, sentenceEnd,
+			section.Aspect, section.Name, getTableValue(section.Attributes[attrPolarity]),
+		}
+		attributeValues := make([]interface{}, len(attributes))
+		for i, name := range attributes {
+			attributeValues[i] = getTableValue(section.Attributes[name])
+		}
+
+		addRow := func(concept []interface{}) {
+			row := make([]interface{}, 0, len(columns))
+			row = append(row, annotation...)
+			row = append(row, concept...)
+			rows = append(rows, append(row, attributeValues...))
+		}
+
+		if len(section.UmlsConcepts) == 0 {
+			addRow(make([]interface{}, 6))
+		}
+		for _, concept := range section.UmlsConcepts {
+			var tui interface{}
+			if len(concept.Tui) > 0 {
+				tui = strings.Join(concept.Tui, tableListSeparator)
+			}
+			isAdded := false
+			for _, sabConcept := range concept.SabConcepts {
+				for _, vocabConcept := range sabConcept.VocabConcepts {
+					var tty interface{}
+					if len(vocabConcept.Tty) > 0 {
+						tty = strings.Join(vocabConcept.Tty, tableListSeparator)
+					}
+					addRow([]interface{}{concept.Cui, concept.PreferredText, tui, sabConcept.CodingScheme, vocabConcept.Code, tty})
+					isAdded = true
+				}
+			}
+			if !isAdded {
+				addRow([]interface{}{concept.Cui, concept.PreferredText, tui, nil, nil, nil})
+			}
+		}
+	}
+	return columns, rows
+}
+
+func renderDelimited(doc Document, comma rune) ([]byte, error) {
+	columns, rows := getTableRows(doc)
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Comma = comma
+	if err := writer.Write(columns); err != nil {
+		return nil, err
+	}
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		for i, value := range row {
+			record[i] = ""
+			if value != nil {
+				record[i] = fmt.Sprint(value)
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+func renderCSV(doc Document) ([]byte, error) {
+	return renderDelimited(doc, ',')
+}
+
+func renderTSV(doc Document) ([]byte, error) {
+	return renderDelimited(doc, '\t')
+}
+
+// renderJSONLines writes one JSON object per row with the columns in the header order
+func renderJSONLines(doc Document) ([]byte, error) {
+	columns, rows := getTableRows(doc)
+	var buf bytes.Buffer
+	for _, row := range rows {
+		buf.WriteByte('{')
+		for i, value := range row {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, err := json.Marshal(columns[i])
+			if err != nil {
+				return nil, err
+			}
+			data, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(key)
+			buf.WriteByte(':')
+			buf.Write(data)
+		}
+		buf.WriteString("}\n")
+	}
+	return buf.Bytes(), nil
+}
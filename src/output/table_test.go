@@ -0,0 +1,87 @@
+package output
+
+import (
+	"bytes"
+	"text2phenotype.com/fdl/types"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func createTestTableDocument() Document {
+	doc := createTestDocument()
+	clinical := doc.Results["clinical"].(types.DefaultClinicalResponse)
+	clinical.Content = clinical.Content[:2]
+	clinical.Content[1].Sentence = []int32{11, 36}
+	clinical.Content[1].UmlsConcepts[0].SabConcepts = append(clinical.Content[1].UmlsConcepts[0].SabConcepts, types.SabConcept{
+		CodingScheme:  "MSH",
+		VocabConcepts: []types.VocabConcept{{Tty: []string{"MH", "PM"}, Code: "D001241"}},
+	})
+	clinical.Content[1].Attributes["abbreviation"] = map[string]interface{}{"text": "ASA"}
+	doc.Results["clinical"] = clinical
+	return doc
+}
+
+func TestRenderCSV(t *testing.T) {
+	format, err := GetFormat(FormatTSV)
+	require.NoError(t, err)
+	buf, err := format.Render(createTestTableDocument())
+	require.NoError(t, err)
+
+	reader := csv.NewReader(bytes.NewReader(buf))
+	reader.Comma = '\t'
+	records, err := reader.ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+
+	header := records[0]
+	require.Equal(t, tableColumns, header[:len(tableColumns)])
+	require.Equal(t, "abbreviation", header[len(header)-1])
+	column := func(record []string, name string) string {
+		for i, columnName := range header {
+			if columnName == name {
+				return record[i]
+			}
+		}
+		t.Fatalf("no column %q", name)
+		return ""
+	}
+
+	require.Equal(t, "asthma", column(records[1], "text"))
+	require.Equal(t, "negative", column(records[1], "polarity"))
+	require.Equal(t, "", column(records[1], "sentence_begin"))
+
+	for _, record := range records[2:] {
+		require.Equal(t, "Aspirin", column(record, "text"))
+		require.Equal(t, "11", column(record, "sentence_begin"))
+		require.Equal(t, "2", column(record, attrMedFrequencyNumber))
+		require.Equal(t, "po", column(record, attrMedRoute))
+		require.Equal(t, "", column(record, "medStrengthNum"))
+		require.Equal(t, `{"text":"ASA"}`, column(record, "abbreviation"))
+	}
+	require.Equal(t, "RXNORM", column(records[2], "coding_scheme"))
+	require.Equal(t, "MSH", column(records[3], "coding_scheme"))
+	require.Equal(t, "MH;PM", column(records[3], "tty"))
+}
+
+func TestRenderJSONLines(t *testing.T) {
+	format, err := GetFormat(FormatJSONL)
+	require.NoError(t, err)
+	require.True(t, format.IsConcatenable)
+	buf, err := format.Render(createTestTableDocument())
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(string(buf), "\n"), "\n")
+	require.Len(t, lines, 3)
+	require.True(t, strings.HasPrefix(lines[0], `{"doc_id":"doc1","config":"clinical","begin":3,"end":9,`))
+
+	var row map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[2]), &row))
+	require.Equal(t, "C1191", row["cui"])
+	require.Equal(t, "D001241", row["code"])
+	require.Equal(t, float64(36), row["sentence_end"])
+	require.Nil(t, row["medStrengthUnit"])
+	require.Equal(t, "daily", row[attrMedFrequencyUnit])
+}
@@ -0,0 +1,346 @@
+package output
+
+import (
+	"bytes"
+	"text2phenotype.com/fdl/types"
+	"encoding/xml"
+	"strconv"
+	"strings"
+)
+
+// XMI namespaces of the UIMA CAS and the Apache cTAKES type system
+const (
+	xmiNamespace        = "http://www.omg.org/XMI"
+	xmiCASNamespace     = "http:///uima/cas.ecore"
+	xmiTCASNamespace    = "http:///uima/tcas.ecore"
+	xmiCTakesNamespace  = "http:///org/apache/ctakes/typesystem/type/"
+	xmiDefaultSofaID    = "_InitialView"
+	xmiSegmentID        = "SIMPLE_SEGMENT"
+	xmiUnknownLanguage  = "x-unspecified"
+	xmiDictionaryLookup = "1"
+	xmiPolarityNegated  = "-1"
+	xmiPolarityAffirmed = "1"
+)
+
+// prefixes of the cTAKES type system packages
+var xmiPackages = []string{"textspan", "syntax", "textsem", "refsem", "structured"}
+
+type xmiMentionType struct {
+	name string
+	// cTAKES CONST.NE_TYPE_ID_* of the mention
+	typeID string
+}
+
+// xmiMentionTypes maps the annotation names to the cTAKES IdentifiedAnnotation subclasses, other annotations are
+// EntityMention
+var xmiMentionTypes = map[string]xmiMentionType{
+	"MedicationMention":      {"MedicationMention", "1"},
+	"DiseaseDisorderMention": {"DiseaseDisorderMention", "2"},
+	"SignSymptomMention":     {"SignSymptomMention", "3"},
+	"ProcedureMention":       {"ProcedureMention", "5"},
+	"AnatomicalSiteMention":  {"AnatomicalSiteMention", "6"},
+	"LabMention":             {"LabMention", "9"},
+}
+
+var xmiEntityMention = xmiMentionType{"EntityMention", "0"}
+
+// xmiValueModifier is the cTAKES modifier of a value attribute, its normalized form has the value feature
+type xmiValueModifier struct {
+	attribute string
+	feature   string
+	modifier  string
+	reference string
+}
+
+// value attributes of the medication mentions, the pipeline keeps no offsets for them so the modifiers cover the
+// medication mention
+var xmiMedicationValueModifiers = []xmiValueModifier{
+	{attrMedDosage, "medicationDosage", "MedicationDosageModifier", "MedicationDosage"},
+	{attrMedForm, "medicationForm", "MedicationFormModifier", "MedicationForm"},
+	{attrMedRoute, "medicationRoute", "MedicationRouteModifier", "MedicationRoute"},
+	{attrMedDuration, "medicationDuration", "MedicationDurationModifier", "MedicationDuration"},
+	{attrMedStatusChange, "medicationStatusChange", "MedicationStatusChangeModifier", "MedicationStatusChange"},
+}
+
+// xmiQuantityModifier is the cTAKES modifier of the number and unit span attributes
+type xmiQuantityModifier struct {
+	number    string
+	unit      string
+	feature   string
+	modifier  string
+	reference string
+}
+
+var xmiQuantityModifiers = map[string][]xmiQuantityModifier{
+	"MedicationMention": {
+		{attrMedStrengthNum, attrMedStrengthUnit, "medicationStrength", "MedicationStrengthModifier", "MedicationStrength"},
+		{attrMedFrequencyNumber, attrMedFrequencyUnit, "medicationFrequency", "MedicationFrequencyModifier", "MedicationFrequency"},
+	},
+	"LabMention": {
+		{attrLabValue, attrLabValueUnit, "labValue", "LabValueModifier", "LabValue"},
+	},
+}
+
+type xmiElement struct {
+	name  xml.Name
+	attrs []xml.Attr
+}
+
+// xmiWriter collects the feature structures of the CAS, the annotations are added to the index of the view
+type xmiWriter struct {
+	elements []xmiElement
+	members  []string
+	nextID   int
+}
+
+func xmiAttr(name string, value string) xml.Attr {
+	return xml.Attr{Name: xml.Name{Local: name}, Value: value}
+}
+
+func xmiInt(value int32) string {
+	return strconv.Itoa(int(value))
+}
+
+// add adds the feature structure of the type in the package and returns its xmi:id
+func (writer *xmiWriter) add(pkg string, typeName string, isIndexed bool, attrs ...xml.Attr) string {
+	id := strconv.Itoa(writer.nextID)
+	writer.nextID++
+	element := xmiElement{
+		name:  xml.Name{Local: pkg + ":" + typeName},
+		attrs: append([]xml.Attr{{Name: xml.Name{Local: "xmi:id"}, Value: id}}, attrs...),
+	}
+	writer.elements = append(writer.elements, element)
+	if isIndexed {
+		writer.members = append(writer.members, id)
+	}
+	return id
+}
+
+// addAnnotation adds the annotation of the default view with the offsets
+func (writer *xmiWriter) addAnnotation(pkg string, typeName string, begin int32, end int32, attrs ...xml.Attr) string {
+	attrs = append([]xml.Attr{xmiAttr("sofa", "1"), xmiAttr("begin", xmiInt(begin)), xmiAttr("end", xmiInt(end))}, attrs...)
+	return writer.add(pkg, typeName, true, attrs...)
+}
+
+// getXMITokenType returns the cTAKES BaseToken subclass of the token
+func getXMITokenType(token *types.Token) string {
+	switch {
+	case token.IsNewline:
+		return "NewlineToken"
+	case token.IsPunct:
+		return "PunctuationToken"
+	case token.IsNumber:
+		return "NumToken"
+	case token.IsSymbol:
+		return "SymbolToken"
+	}
+	return "WordToken"
+}
+
+func (writer *xmiWriter) addSentences(sentences []types.Sentence) {
+	tokenNumber := 0
+	for i, sent := range sentences {
+		writer.addAnnotation("textspan", "Sentence", sent.Begin, sent.End,
+			xmiAttr("sentenceNumber", strconv.Itoa(i)), xmiAttr("segmentId", xmiSegmentID))
+
+		for _, token := range sent.Tokens {
+			tokenType := getXMITokenType(token)
+			attrs := []xml.Attr{xmiAttr("tokenNumber", strconv.Itoa(tokenNumber))}
+			tokenNumber++
+			if token.Text != nil {
+				attrs = append(attrs, xmiAttr("normalizedForm", *token.Text))
+			}
+			if token.Tag != nil {
+				attrs = append(attrs, xmiAttr("partOfSpeech", *token.Tag))
+			}
+			if tokenType == "WordToken" && token.Lemma != nil {
+				attrs = append(attrs, xmiAttr("canonicalForm", *token.Lemma))
+			}
+			writer.addAnnotation("syntax", tokenType, token.Begin, token.End, attrs...)
+		}
+	}
+}
+
+// addConcepts adds one UmlsConcept per code of the concepts, concepts without codes get one UmlsConcept with the CUI
+func (writer *xmiWriter) addConcepts(concepts []types.UmlsConcept) []string {
+	var result []string
+	for _, concept := range concepts {
+		attrs := []xml.Attr{xmiAttr("cui", concept.Cui)}
+		if len(concept.Tui) > 0 {
+			attrs = append(attrs, xmiAttr("tui", concept.Tui[0]))
+		}
+		if len(concept.PreferredText) > 0 {
+			attrs = append(attrs, xmiAttr("preferredText", concept.PreferredText))
+		}
+		if concept.Score != nil {
+			attrs = append(attrs, xmiAttr("score", strconv.FormatFloat(*concept.Score, 'g', -1, 64)))
+		}
+		if concept.Rank == 1 {
+			attrs = append(attrs, xmiAttr("disambiguated", "true"))
+		}
+
+		isAdded := false
+		for _, sabConcept := range concept.SabConcepts {
+			for _, vocabConcept := range sabConcept.VocabConcepts {
+				codeAttrs := append([]xml.Attr{
+					xmiAttr("codingScheme", sabConcept.CodingScheme),
+					xmiAttr("code", vocabConcept.Code),
+				}, attrs...)
+				result = append(result, writer.add("refsem", "UmlsConcept", false, codeAttrs...))
+				isAdded = true
+			}
+		}
+		if !isAdded {
+			result = append(result, writer.add("refsem", "UmlsConcept", false, attrs...))
+		}
+	}
+	return result
+}
+
+// addModifiers adds the modifier annotations of the mention attributes and returns the mention features
+// which reference them
+func (writer *xmiWriter) addModifiers(mentionType string, section Section, begin int32, end int32) []xml.Attr {
+	var result []xml.Attr
+	for _, modifier := range xmiQuantityModifiers[mentionType] {
+		number, numberBegin, numberEnd, hasNumber := getSpanAttributeOffsets(section.Attributes[modifier.number])
+		unit, unitBegin, unitEnd, hasUnit := getSpanAttributeOffsets(section.Attributes[modifier.unit])
+		if !hasNumber && !hasUnit {
+			continue
+		}
+
+		var attrs []xml.Attr
+		modifierBegin, modifierEnd := int32(-1), int32(-1)
+		if hasNumber {
+			attrs = append(attrs, xmiAttr("number", number))
+			modifierBegin, modifierEnd = numberBegin, numberEnd
+		}
+		if hasUnit {
+			attrs = append(attrs, xmiAttr("unit", unit))
+			if modifierBegin < 0 || unitBegin < modifierBegin {
+				modifierBegin = unitBegin
+			}
+			if unitEnd > modifierEnd {
+				modifierEnd = unitEnd
+			}
+		}
+		normalizedID := writer.add("refsem", modifier.reference, false, attrs...)
+		modifierID := writer.addAnnotation("textsem", modifier.modifier, modifierBegin, modifierEnd,
+			xmiAttr("normalizedForm", normalizedID))
+		result = append(result, xmiAttr(modifier.feature, modifierID))
+	}
+
+	if mentionType != "MedicationMention" {
+		return result
+	}
+	for _, modifier := range xmiMedicationValueModifiers {
+		value := getStringAttribute(section.Attributes, modifier.attribute)
+		if len(value) == 0 {
+			continue
+		}
+		normalizedID := writer.add("refsem", modifier.reference, false, xmiAttr("value", value))
+		modifierID := writer.addAnnotation("textsem", modifier.modifier, begin, end,
+			xmiAttr("normalizedForm", normalizedID))
+		result = append(result, xmiAttr(modifier.feature, modifierID))
+	}
+	return result
+}
+
+func (writer *xmiWriter) addMention(section Section) {
+	mentionType, ok := xmiMentionTypes[section.Name]
+	if !ok {
+		mentionType = xmiEntityMention
+	}
+	begin, end := GetSpan(section.ContentSection)
+
+	polarity := xmiPolarityAffirmed
+	if getStringAttribute(section.Attributes, attrPolarity) == polarityNegative {
+		polarity = xmiPolarityNegated
+	}
+	attrs := []xml.Attr{
+		xmiAttr("typeID", mentionType.typeID),
+		xmiAttr("segmentID", xmiSegmentID),
+		xmiAttr("discoveryTechnique", xmiDictionaryLookup),
+		xmiAttr("polarity", polarity),
+	}
+	if conceptIDs := writer.addConcepts(section.UmlsConcepts); len(conceptIDs) > 0 {
+		attrs = append(attrs, xmiAttr("ontologyConceptArr", strings.Join(conceptIDs, " ")))
+	}
+	attrs = append(attrs, writer.addModifiers(mentionType.name, section, begin, end)...)
+	writer.addAnnotation("textsem", mentionType.name, begin, end, attrs...)
+}
+
+func (writer *xmiWriter) marshal(text string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+
+	root := xml.StartElement{
+		Name: xml.Name{Local: "xmi:XMI"},
+		Attr: []xml.Attr{
+			xmiAttr("xmlns:xmi", xmiNamespace),
+			xmiAttr("xmlns:cas", xmiCASNamespace),
+			xmiAttr("xmlns:tcas", xmiTCASNamespace),
+		},
+	}
+	for _, pkg := range xmiPackages {
+		root.Attr = append(root.Attr, xmiAttr("xmlns:"+pkg, xmiCTakesNamespace+pkg+".ecore"))
+	}
+	root.Attr = append(root.Attr, xmiAttr("xmi:version", "2.0"))
+
+	elements := []xmiElement{
+		{name: xml.Name{Local: "cas:NULL"}, attrs: []xml.Attr{xmiAttr("xmi:id", "0")}},
+		{name: xml.Name{Local: "cas:Sofa"}, attrs: []xml.Attr{
+			xmiAttr("xmi:id", "1"),
+			xmiAttr("sofaNum", "1"),
+			xmiAttr("sofaID", xmiDefaultSofaID),
+			xmiAttr("mimeType", "text"),
+			xmiAttr("sofaString", text),
+		}},
+	}
+	elements = append(elements, writer.elements...)
+	elements = append(elements, xmiElement{name: xml.Name{Local: "cas:View"}, attrs: []xml.Attr{
+		xmiAttr("sofa", "1"),
+		xmiAttr("members", strings.Join(writer.members, " ")),
+	}})
+
+	if err := encoder.EncodeToken(root); err != nil {
+		return nil, err
+	}
+	for _, element := range elements {
+		if err := encoder.EncodeToken(xml.StartElement{Name: element.name, Attr: element.attrs}); err != nil {
+			return nil, err
+		}
+		if err := encoder.EncodeToken(xml.EndElement{Name: element.name}); err != nil {
+			return nil, err
+		}
+	}
+	if err := encoder.EncodeToken(root.End()); err != nil {
+		return nil, err
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderXMI writes the UIMA CAS XMI of the document with the Apache cTAKES type system: the document id,
+// a segment over the whole text, sentences, tokens with POS and lemma, and IdentifiedAnnotation subclasses with
+// UmlsConcept arrays, polarity and the medication and lab modifiers
+func renderXMI(doc Document) ([]byte, error) {
+	writer := xmiWriter{nextID: 2}
+	textLength := int32(len([]rune(doc.Text)))
+
+	writer.addAnnotation("tcas", "DocumentAnnotation", 0, textLength, xmiAttr("language", xmiUnknownLanguage))
+	docID := doc.GetBaseResponse().DocId
+	if len(docID) == 0 {
+		docID = doc.Tid
+	}
+	writer.add("structured", "DocumentID", true, xmiAttr("documentID", docID))
+	writer.addAnnotation("textspan", "Segment", 0, textLength, xmiAttr("id", xmiSegmentID))
+
+	writer.addSentences(doc.Sentences)
+	for _, section := range doc.GetSections() {
+		writer.addMention(section)
+	}
+	return writer.marshal(doc.Text)
+}
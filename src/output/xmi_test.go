@@ -0,0 +1,141 @@
+package output
+
+import (
+	"bytes"
+	"text2phenotype.com/fdl/types"
+	"encoding/xml"
+	"github.com/stretchr/testify/require"
+	"io"
+	"strings"
+	"testing"
+)
+
+type testXMIElement struct {
+	space string
+	name  string
+	attrs map[string]string
+}
+
+func parseTestXMI(t *testing.T, buf []byte) []testXMIElement {
+	var result []testXMIElement
+	decoder := xml.NewDecoder(bytes.NewReader(buf))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return result
+		}
+		require.NoError(t, err)
+		if start, ok := token.(xml.StartElement); ok {
+			element := testXMIElement{space: start.Name.Space, name: start.Name.Local, attrs: make(map[string]string)}
+			for _, attr := range start.Attr {
+				element.attrs[attr.Name.Local] = attr.Value
+			}
+			result = append(result, element)
+		}
+	}
+}
+
+func findTestXMIElements(elements []testXMIElement, name string) []testXMIElement {
+	var result []testXMIElement
+	for _, element := range elements {
+		if element.name == name {
+			result = append(result, element)
+		}
+	}
+	return result
+}
+
+func TestRenderXMI(t *testing.T) {
+	doc := createTestDocument()
+	clinical := doc.Results["clinical"].(types.DefaultClinicalResponse)
+	clinical.Content[0].Name = "DiseaseDisorderMention"
+	clinical.Content[1].Name = "MedicationMention"
+	clinical.Content[1].Attributes["medStrengthNum"] = []interface{}{"81", int32(19), int32(21)}
+	clinical.Content[1].Attributes["medStrengthUnit"] = []interface{}{"mg", int32(22), int32(24)}
+	clinical.Content[2].Name = "LabMention"
+	doc.Results["clinical"] = clinical
+
+	text, tag, lemma := "no", "DT", "no"
+	asthma, nn := "asthma", "NN"
+	period, punct := ".", "."
+	sent := types.Sentence{Span: types.Span{Begin: 0, End: 10}}
+	sent.Tokens = []*types.Token{
+		{Span: types.Span{Begin: 0, End: 2, Text: &text}, Tag: &tag, Lemma: &lemma, IsWord: true},
+		{Span: types.Span{Begin: 3, End: 9, Text: &asthma}, Tag: &nn, Lemma: &asthma, IsWord: true},
+		{Span: types.Span{Begin: 9, End: 10, Text: &period}, Tag: &punct, IsPunct: true},
+	}
+	doc.Sentences = []types.Sentence{sent}
+
+	format, err := GetFormat(FormatXMI)
+	require.NoError(t, err)
+	require.True(t, format.WithSentences)
+	buf, err := format.Render(doc)
+	require.NoError(t, err)
+	elements := parseTestXMI(t, buf)
+
+	require.Equal(t, "XMI", elements[0].name)
+	sofa := findTestXMIElements(elements, "Sofa")
+	require.Len(t, sofa, 1)
+	require.Equal(t, doc.Text, sofa[0].attrs["sofaString"])
+
+	sentences := findTestXMIElements(elements, "Sentence")
+	require.Len(t, sentences, 1)
+	require.Equal(t, xmiCTakesNamespace+"textspan.ecore", sentences[0].space)
+
+	words := findTestXMIElements(elements, "WordToken")
+	require.Len(t, words, 2)
+	require.Equal(t, "NN", words[1].attrs["partOfSpeech"])
+	require.Equal(t, "asthma", words[1].attrs["canonicalForm"])
+	require.Len(t, findTestXMIElements(elements, "PunctuationToken"), 1)
+
+	disorders := findTestXMIElements(elements, "DiseaseDisorderMention")
+	require.Len(t, disorders, 1)
+	require.Equal(t, xmiPolarityNegated, disorders[0].attrs["polarity"])
+	require.Equal(t, "3", disorders[0].attrs["begin"])
+
+	concepts := make(map[string]testXMIElement)
+	for _, concept := range findTestXMIElements(elements, "UmlsConcept") {
+		concepts[concept.attrs["id"]] = concept
+	}
+	conceptIDs := strings.Fields(disorders[0].attrs["ontologyConceptArr"])
+	require.Len(t, conceptIDs, 1)
+	require.Equal(t, "C195967001", concepts[conceptIDs[0]].attrs["cui"])
+	require.Equal(t, "SNOMEDCT_US", concepts[conceptIDs[0]].attrs["codingScheme"])
+
+	ids := make(map[string]testXMIElement)
+	for _, element := range elements {
+		ids[element.attrs["id"]] = element
+	}
+	medications := findTestXMIElements(elements, "MedicationMention")
+	require.Len(t, medications, 1)
+	require.Equal(t, xmiPolarityAffirmed, medications[0].attrs["polarity"])
+
+	strength := ids[medications[0].attrs["medicationStrength"]]
+	require.Equal(t, "MedicationStrengthModifier", strength.name)
+	require.Equal(t, "19", strength.attrs["begin"])
+	require.Equal(t, "24", strength.attrs["end"])
+	normalized := ids[strength.attrs["normalizedForm"]]
+	require.Equal(t, "MedicationStrength", normalized.name)
+	require.Equal(t, "81", normalized.attrs["number"])
+	require.Equal(t, "mg", normalized.attrs["unit"])
+
+	frequency := ids[ids[medications[0].attrs["medicationFrequency"]].attrs["normalizedForm"]]
+	require.Equal(t, "2", frequency.attrs["number"])
+	require.Equal(t, "daily", frequency.attrs["unit"])
+	route := ids[ids[medications[0].attrs["medicationRoute"]].attrs["normalizedForm"]]
+	require.Equal(t, "po", route.attrs["value"])
+
+	labs := findTestXMIElements(elements, "LabMention")
+	require.Len(t, labs, 1)
+	labValue := ids[ids[labs[0].attrs["labValue"]].attrs["normalizedForm"]]
+	require.Equal(t, "105", labValue.attrs["number"])
+	require.Equal(t, "mg/dL", labValue.attrs["unit"])
+
+	require.Len(t, findTestXMIElements(elements, "EntityMention"), 1)
+
+	view := findTestXMIElements(elements, "View")
+	require.Len(t, view, 1)
+	members := strings.Fields(view[0].attrs["members"])
+	require.Contains(t, members, disorders[0].attrs["id"])
+	require.NotContains(t, members, conceptIDs[0])
+}
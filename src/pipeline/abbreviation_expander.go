@@ -0,0 +1,35 @@
+package pipeline
+
+import (
+	"text2phenotype.com/fdl/abbreviation"
+	"text2phenotype.com/fdl/types"
+)
+
+// NewAbbreviationExpander attaches the expansions to the abbreviation tokens, the document is collected first
+// because the abbreviations defined in one sentence are expanded in the others
+func NewAbbreviationExpander(listPath string) (func(in <-chan types.Sentence) <-chan types.Sentence, error) {
+	list, err := abbreviation.LoadList(listPath)
+	if err != nil {
+		return nil, err
+	}
+	expand := abbreviation.NewExpander(list)
+
+	return func(in <-chan types.Sentence) <-chan types.Sentence {
+		out := make(chan types.Sentence)
+
+		go func() {
+			defer close(out)
+			sentences := make([]types.Sentence, 0)
+			for sent := range in {
+				sentences = append(sentences, sent)
+			}
+
+			expand(sentences)
+
+			for _, sent := range sentences {
+				out <- sent
+			}
+		}()
+		return out
+	}, nil
+}
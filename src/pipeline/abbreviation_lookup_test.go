@@ -0,0 +1,50 @@
+package pipeline
+
+import (
+	"text2phenotype.com/fdl/lookup"
+	"text2phenotype.com/fdl/types"
+	"text2phenotype.com/fdl/utils"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestAbbreviationLookup(t *testing.T) {
+	store := utils.GlobalStringStore()
+	shortness, of, breath := store.GetPointer("shortness"), store.GetPointer("of"), store.GetPointer("breath")
+	rwMap := lookup.RareWordTermMap{
+		shortness: {{Tokens: []*string{shortness, of, breath}, CUI: store.GetPointer("c0013404"), TextLength: 19}},
+	}
+	dictionary := func(words []*string) lookup.MapListIterator {
+		return lookup.CreateMapListIterator(rwMap, words)
+	}
+
+	sent := makeLookupSentence("patient c/o SOB at night")
+	sent.Tokens[2].Expansion = &types.Expansion{
+		Abbreviation: "SOB",
+		Text:         "shortness of breath",
+		Tokens:       []*string{shortness, of, breath},
+		Length:       1,
+		Source:       types.ExpansionSourceList,
+	}
+
+	params := GetDefaultDictionaryLookupParams()
+	spans, _, _, _ := searchSpansInWindow(sent, dictionary, nil, params)
+	require.Empty(t, spans)
+
+	params.ExpandAbbreviations = true
+	spans, cuis, matches, _ := searchSpansInWindow(sent, dictionary, nil, params)
+	require.Len(t, spans, 1)
+	require.Equal(t, "SOB", *spans[0].Text)
+	require.Equal(t, "c0013404", *cuis[0][0])
+
+	ann := types.Annotation{Attributes: make(map[string]interface{})}
+	matches[spans[0].GetHashCode()].setAttributes(&ann)
+	require.Equal(t, MatchTypeAbbreviation, ann.Attributes[MatchTypeParamName])
+	require.Equal(t, "shortness of breath", ann.Attributes[AbbreviationParamName].(map[string]interface{})["expansion"])
+
+	// the trie engine finds the expansion as well
+	trie := lookup.NewTermTrie(rwMap)
+	spans, _, _, _ = searchSpansInWindow(sent, lookup.EmptyDictionary, trie.Match, params)
+	require.Len(t, spans, 1)
+	require.Equal(t, "SOB", *spans[0].Text)
+}
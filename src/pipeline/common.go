@@ -1,3 +1,5 @@
 package pipeline
 
+// Pipeline returns the channel of the rendered response, the channel is closed without the response if the request
+// is not correct
 type Pipeline func(request Request) <-chan string
@@ -5,9 +5,9 @@ import (
 	"text2phenotype.com/fdl/logger"
 	"text2phenotype.com/fdl/negation"
 	"text2phenotype.com/fdl/nlp"
+	"text2phenotype.com/fdl/output"
 	"text2phenotype.com/fdl/pos"
 	"text2phenotype.com/fdl/types"
-	"encoding/json"
 	"path"
 )
 
@@ -23,11 +23,13 @@ type LabValuesParams struct {
 }
 
 type DefaultClinicalParams struct {
-	DictionaryFolder string                `json:"dictionary_folder"`
-	ResourceFolder   string                `json:"resource_folder"`
-	Configurations   []types.Configuration `json:"configurations"`
-	LabValuesParams  LabValuesParams       `json:"lab_values_params"`
-	DrugParams       DrugNerParams         `json:"drug_params"`
+	DictionaryFolder  string                `json:"dictionary_folder"`
+	ResourceFolder    string                `json:"resource_folder"`
+	Configurations    []types.Configuration `json:"configurations"`
+	LabValuesParams   LabValuesParams       `json:"lab_values_params"`
+	DrugParams        DrugNerParams         `json:"drug_params"`
+	AbbreviationsFile string                `json:"abbreviations_file"`
+	Unified           UnifiedParams         `json:"unified"`
 }
 
 func GetDefaultClinicalParams(filePath string, dictPath string, cfgs []types.Configuration) DefaultClinicalParams {
@@ -42,6 +44,7 @@ func GetDefaultClinicalParams(filePath string, dictPath string, cfgs []types.Con
 			LabUnitsFile:     path.Join(resourcesPath, "lab_values", "units.txt"),
 			StringValues:     []string{"normal"},
 		},
+		AbbreviationsFile: path.Join(resourcesPath, "abbreviations", "clinical.bsv"),
 	}
 }
 
@@ -51,7 +54,14 @@ func DefaultClinical(params DefaultClinicalParams) (Pipeline, error) {
 	fdlLogger.Info().
 		Interface("params", params).
 		Msg("Starting default clinical pipeline (see parameters in 'params' field)")
-	lookupCfg, err := CreateLookupConfigs(params.DictionaryFolder, params.Configurations)
+	if err := params.Unified.Validate(params.Configurations); err != nil {
+		errLogger.Err(err).
+			Interface("unified", params.Unified).
+			Msg("Unified result parameters are not correct")
+		return nil, err
+	}
+
+	lookupCfg, err := CreateLookupConfigs(params.DictionaryFolder, params.ResourceFolder, params.Configurations)
 	if err != nil {
 		errLogger.Err(err).
 			Interface("configurations", params.Configurations).
@@ -95,7 +105,23 @@ func DefaultClinical(params DefaultClinicalParams) (Pipeline, error) {
 		return nil, err
 	}
 
+	var abbreviationExpander func(in <-chan types.Sentence) <-chan types.Sentence
+	for _, cfg := range params.Configurations {
+		if !cfg.Params.FDL.ExpandAbbreviations {
+			continue
+		}
+		abbreviationExpander, err = NewAbbreviationExpander(params.AbbreviationsFile)
+		if err != nil {
+			errLogger.Err(err).
+				Str("abbreviations_file", params.AbbreviationsFile).
+				Msg("Failed to create abbreviation expander")
+			return nil, err
+		}
+		break
+	}
+
 	lookup := NewDictionaryLookup()
+	disambiguator := NewDisambiguator()
 	splitter := NewSentenceChannelSplitter(len(params.Configurations))
 
 	labAttributesAnnotator, err := NewLabAttributesAnnotator(params.LabValuesParams)
@@ -169,6 +195,8 @@ func DefaultClinical(params DefaultClinicalParams) (Pipeline, error) {
 
 	default_response := NewDefaultClinicalResult()
 
+	sentenceCollector := NewSentenceCollector()
+
 	return func(request Request) <-chan string {
 		responseChan := make(chan string)
 		pplnLog := fdlLogger.With().Str("tid", request.Tid).Logger()
@@ -176,12 +204,27 @@ func DefaultClinical(params DefaultClinicalParams) (Pipeline, error) {
 		errLogger = pplnLog.With().Caller().Logger()
 
 		go func() {
+			format, err := request.GetFormat()
+			if err != nil {
+				errLogger.Err(err).Str("tid", request.Tid).Msg("Output format of the request is not correct")
+				close(responseChan)
+				return
+			}
+
 			var in = make(chan string)
 
 			sd := sentenceDetector(in)
 			tok := tokenizer(sd)
 			tag := tagger(tok)
 			lem := lemmatizer(tag)
+			if abbreviationExpander != nil {
+				lem = abbreviationExpander(lem)
+			}
+
+			var sentences <-chan []types.Sentence
+			if format.WithSentences {
+				lem, sentences = sentenceCollector(lem)
+			}
 
 			split := splitter(lem)
 
@@ -192,7 +235,12 @@ func DefaultClinical(params DefaultClinicalParams) (Pipeline, error) {
 				switch cfg.Pipeline {
 				case types.DefaultClinicalPipeline:
 					{
-						lCfg := lookupCfg[cfg.Name]
+						lCfg, err := lookupCfg[cfg.Name].WithRequestParams(request.GetParams(cfg.Name))
+						if err != nil {
+							errLogger.Err(err).
+								Str("config_name", cfg.Name).
+								Msg("Request parameters are not correct, configuration defaults are used")
+						}
 
 						annotations := lookup(split[i], lCfg, request.Tid)
 
@@ -206,6 +254,9 @@ func DefaultClinical(params DefaultClinicalParams) (Pipeline, error) {
 						if cfg.CheckFeature(types.PolarityAttributes) {
 							annotations = polarityDetector(annotations)
 						}
+						if lCfg.Disambiguation.Enabled {
+							annotations = disambiguator(annotations, lCfg.Disambiguation)
+						}
 
 						defRes := default_response(annotations, lCfg, request)
 						connect(defRes, resultChannel)
@@ -224,6 +275,7 @@ func DefaultClinical(params DefaultClinicalParams) (Pipeline, error) {
 			in <- request.Text
 			close(in)
 			response := make(map[string]interface{})
+			clinicalResponses := make(map[string]types.DefaultClinicalResponse)
 
 			for i := 0; i < len(params.Configurations); i++ {
 				res := <-resultChannel
@@ -231,11 +283,25 @@ func DefaultClinical(params DefaultClinicalParams) (Pipeline, error) {
 					Str("config_name", res.ConfigName).
 					Msg("Finished pipeline for configuration")
 				response[res.ConfigName] = res.Data
+				if clinicalResponse, ok := res.Data.(types.DefaultClinicalResponse); ok {
+					clinicalResponses[res.ConfigName] = clinicalResponse
+				}
 			}
 
-			buf, err := json.Marshal(response)
+			if params.Unified.Enabled {
+				response[UnifiedResultName] = BuildUnifiedResponse(clinicalResponses, params.Unified)
+			}
+
+			doc := output.Document{Tid: request.Tid, Text: request.Text, Results: response}
+			if sentences != nil {
+				doc.Sentences = <-sentences
+			}
+			buf, err := format.Render(doc)
 			if err != nil {
-				errLogger.Err(err).Str("tid", request.Tid).Msg("Failed to marshall response")
+				errLogger.Err(err).
+					Str("tid", request.Tid).
+					Str("format", format.Name).
+					Msg("Failed to marshall response")
 			}
 			pplnLog.Info().Msg("Finished default clinical pipeline")
 			txt := string(buf)
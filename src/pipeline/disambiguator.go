@@ -0,0 +1,29 @@
+package pipeline
+
+import (
+	"text2phenotype.com/fdl/lookup"
+	"text2phenotype.com/fdl/types"
+)
+
+// NewDisambiguator ranks the concepts of the annotations, the document is collected first because the concepts
+// found elsewhere in the document are used as the evidence
+func NewDisambiguator() func(in <-chan []types.Annotation, params lookup.DisambiguationParams) <-chan []types.Annotation {
+	return func(in <-chan []types.Annotation, params lookup.DisambiguationParams) <-chan []types.Annotation {
+		out := make(chan []types.Annotation)
+
+		go func() {
+			defer close(out)
+			allAnnotations := make([]types.Annotation, 0)
+
+			for annotations := range in {
+				allAnnotations = append(allAnnotations, annotations...)
+			}
+
+			lookup.RankConcepts(allAnnotations, params)
+
+			out <- allAnnotations
+		}()
+
+		return out
+	}
+}
@@ -1,27 +1,52 @@
 package pipeline
 
 import (
+	"text2phenotype.com/fdl/lemmatizer"
 	"text2phenotype.com/fdl/logger"
 	. "text2phenotype.com/fdl/lookup"
+	"text2phenotype.com/fdl/pos"
 	"text2phenotype.com/fdl/types"
 	"errors"
+	"fmt"
 	"github.com/rs/zerolog"
 	"path"
 	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
+)
+
+const (
+	MatchTypeParamName    = "matchType"
+	EditDistanceParamName = "editDistance"
+	CoveredSpansParamName = "coveredSpans"
+	SourceParamName       = "source"
+	UserCUIsParamName     = "userCuis"
+	AbbreviationParamName = "abbreviation"
+
+	MatchTypeOverlap      = "overlap"
+	MatchTypeAbbreviation = "abbreviation"
+
+	// default interval of the user dictionary file checks, in seconds
+	defaultUserDictionaryReload = 30
 )
 
 type DictionaryLookupParams struct {
 	MinimumLookupSpan uint32
 	ExclusionTags     []string
+	MatchMode         string
+	MaxSkippedTokens  int
+	// looks up the expansions of the abbreviations found by the abbreviation expander
+	ExpandAbbreviations bool
 }
 
 func GetDefaultDictionaryLookupParams() DictionaryLookupParams {
 	return DictionaryLookupParams{
 		MinimumLookupSpan: 1,
 		ExclusionTags:     []string{"VB"},
+		MatchMode:         types.MatchModeContiguous,
+		MaxSkippedTokens:  defaultMaxSkippedTokens,
 	}
 }
 
@@ -30,18 +55,65 @@ type LookupConfig struct {
 	Dict    Dictionary
 	Factory ConceptFactory
 	Cons    Consumer
+	Filter  TermFilter
 	Params  DictionaryLookupParams
+	// finds the dictionary terms by the trie engine, Dict keeps only the user dictionary terms then
+	Matcher        TermMatcher
+	Disambiguation DisambiguationParams
+	Overlap        OverlapStrategy
+
+	releases []func()
+}
+
+// WithRequestParams returns the configuration with the overlap resolution of the request
+func (cfg LookupConfig) WithRequestParams(params types.RequestParams) (LookupConfig, error) {
+	if len(params.OverlapResolution) == 0 {
+		return cfg, nil
+	}
+	strategy, err := ParseOverlapStrategy(params.OverlapResolution)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Overlap = strategy
+	cfg.Cons = CreateConsumer(strategy)
+	return cfg, nil
+}
+
+// Release releases the shared dictionary and concept factory of the configuration
+func (cfg LookupConfig) Release() {
+	for _, release := range cfg.releases {
+		release()
+	}
 }
 
-func CreateLookupConfigs(dictDir string, configs []types.Configuration) (map[string]LookupConfig, error) {
+// ReleaseLookupConfigs releases the shared resources of all configurations
+func ReleaseLookupConfigs(configs map[string]LookupConfig) {
+	for _, cfg := range configs {
+		cfg.Release()
+	}
+}
+
+// CreateLookupConfigs loads dictionaries and concept factories of the configurations, the lemmatizer resources
+// in resourceDir are loaded only if some configuration tokenizes its terms by the PTB tokenizer
+func CreateLookupConfigs(dictDir string, resourceDir string, configs []types.Configuration) (map[string]LookupConfig, error) {
 
 	fdlLogger := logger.NewLogger("CreateLookupConfigs")
 	fdlLogger.Info().Msg("Loading configurations")
 
+	analyzers, err := createTermAnalyzers(resourceDir, configs)
+	if err != nil {
+		fdlLogger.Err(err).Msg("Could not create term tokenizers")
+		return nil, err
+	}
+
 	var wg sync.WaitGroup
+	var mu sync.Mutex
 
+	registry := GlobalRegistry()
 	dictMap := make(map[string]Dictionary)
+	matcherMap := make(map[string]TermMatcher)
 	factoryMap := make(map[string]ConceptFactory)
+	releases := make(map[string][]func())
 
 	for _, cfg := range configs {
 		configLogger := fdlLogger.With().Str("config_name", cfg.Name).Logger()
@@ -52,7 +124,7 @@ func CreateLookupConfigs(dictDir string, configs []types.Configuration) (map[str
 		wg.Add(1)
 		// load dictionary
 		errLogger := configLogger.With().Caller().Logger()
-		go func(configName string, dictParams types.FDLConfig, errLogger zerolog.Logger) {
+		go func(configName string, dictParams types.FDLConfig, analyzer TermAnalyzer, errLogger zerolog.Logger) {
 			defer wg.Done()
 
 			dictPath := dictParams.TermDictionary
@@ -74,15 +146,45 @@ func CreateLookupConfigs(dictDir string, configs []types.Configuration) (map[str
 
 			dictScheme := strings.Split(dictSchemeParam, "|")
 
-			dict, e := CreateDictionary(configName, absDictPath, dictScheme)
+			casePolicy, e := NewCasePolicy(dictParams)
+			if e != nil {
+				errLogger.Err(e).Msg("Dictionary case sensitivity is not correct")
+				return
+			}
+
+			fuzzyParams, e := NewFuzzyParams(dictParams)
+			if e != nil {
+				errLogger.Err(e).Msg("Dictionary fuzzy lookup parameters are not correct")
+				return
+			}
+
+			if dictParams.LookupEngine == types.LookupEngineTrie {
+				matcher, release, e := registry.AcquireTermMatcher(configName, absDictPath, dictScheme, casePolicy, analyzer)
+				if e != nil {
+					errLogger.Err(e).Msg("Could not load term trie")
+					return
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				dictMap[configName] = EmptyDictionary
+				matcherMap[configName] = matcher
+				releases[configName] = append(releases[configName], release)
+				return
+			}
+
+			dict, release, e := registry.AcquireDictionary(configName, absDictPath, dictScheme, casePolicy, analyzer, fuzzyParams)
 			if e != nil {
 				errLogger.Err(e).Msg("Could not load dictionary")
 				return
 			}
 
+			mu.Lock()
+			defer mu.Unlock()
 			dictMap[configName] = dict
+			releases[configName] = append(releases[configName], release)
 
-		}(cfg.Name, cfg.Params.FDL, errLogger)
+		}(cfg.Name, cfg.Params.FDL, analyzers[cfg.Name], errLogger)
 
 		wg.Add(1)
 		// load concept factory
@@ -110,12 +212,16 @@ func CreateLookupConfigs(dictDir string, configs []types.Configuration) (map[str
 
 			ignoredParams := factParams.ConceptIgnoredParams
 
-			fact, e := CreateConceptFactory(configName, absFactPath, factScheme, ignoredParams)
+			fact, release, e := registry.AcquireConceptFactory(configName, absFactPath, factScheme, ignoredParams)
 			if e != nil {
 				errLogger.Err(e).Msg("Could not create concept factory")
 				return
 			}
-			factoryMap[factPath] = fact
+
+			mu.Lock()
+			defer mu.Unlock()
+			factoryMap[configName] = fact
+			releases[configName] = append(releases[configName], release)
 
 		}(cfg.Name, cfg.Params.FDL, errLogger)
 	}
@@ -124,35 +230,223 @@ func CreateLookupConfigs(dictDir string, configs []types.Configuration) (map[str
 
 	result := make(map[string]LookupConfig)
 	for _, cfg := range configs {
-
-		dict, ok := dictMap[cfg.Name]
-		if !ok {
-			continue
-		}
-		factory, ok := factoryMap[cfg.Params.FDL.ConceptDictionary]
-		if !ok {
-			continue
-		}
-		if cfg.Pipeline == types.DefaultClinicalPipeline {
-			lookupCfg := LookupConfig{
-				Name:    cfg.Name,
-				Dict:    dict,
-				Factory: factory,
-				Cons:    CreateConsumer(cfg.Params.FDL.PrecisionMode),
-				Params:  GetDefaultDictionaryLookupParams(),
+		if _, isLoaded := result[cfg.Name]; !isLoaded {
+			lookupCfg, ok := createLookupConfig(dictDir, cfg, analyzers[cfg.Name], dictMap, matcherMap, factoryMap, &fdlLogger)
+			if !ok {
+				for _, release := range releases[cfg.Name] {
+					release()
+				}
+				continue
 			}
-
-			lookupCfg.Params.ExclusionTags = cfg.Params.FDL.ExclusionTags
+			lookupCfg.releases = append(lookupCfg.releases, releases[cfg.Name]...)
 			result[cfg.Name] = lookupCfg
 		}
 	}
 	if len(result) == 0 {
 		return nil, errors.New("failed to load at least one correct config")
 	}
+
+	stats := registry.Stats()
+	fdlLogger.Info().
+		Int("shared_entries", stats.Entries).
+		Int("shared_references", stats.References).
+		Int64("saved_bytes", stats.SavedBytes).
+		Msgf("Dictionaries and concept factories are shared, approximately %d MB saved", stats.SavedBytes>>20)
+
 	fdlLogger.Info().Msgf("Loaded %d lookup configurations", len(result))
 	return result, nil
 }
 
+func createLookupConfig(
+	dictDir string,
+	cfg types.Configuration,
+	analyzer TermAnalyzer,
+	dictMap map[string]Dictionary,
+	matcherMap map[string]TermMatcher,
+	factoryMap map[string]ConceptFactory,
+	fdlLogger *zerolog.Logger,
+) (LookupConfig, bool) {
+	dict, ok := dictMap[cfg.Name]
+	if !ok {
+		return LookupConfig{}, false
+	}
+	factory, ok := factoryMap[cfg.Name]
+	if !ok {
+		return LookupConfig{}, false
+	}
+	if cfg.Pipeline != types.DefaultClinicalPipeline {
+		return LookupConfig{}, false
+	}
+
+	overlap, err := GetOverlapStrategy(cfg.Params.FDL)
+	if err != nil {
+		fdlLogger.Err(err).
+			Str("config_name", cfg.Name).
+			Str("overlap_resolution", cfg.Params.FDL.OverlapResolution).
+			Msg("Overlap resolution is not correct")
+		return LookupConfig{}, false
+	}
+
+	lookupCfg := LookupConfig{
+		Name:    cfg.Name,
+		Dict:    dict,
+		Factory: factory,
+		Cons:    CreateConsumer(overlap),
+		Params:  GetDefaultDictionaryLookupParams(),
+		Overlap: overlap,
+	}
+
+	lookupCfg.Params.ExclusionTags = cfg.Params.FDL.ExclusionTags
+	if len(cfg.Params.FDL.MatchMode) > 0 {
+		lookupCfg.Params.MatchMode = cfg.Params.FDL.MatchMode
+	}
+	if lookupCfg.Params.MatchMode != types.MatchModeContiguous && lookupCfg.Params.MatchMode != types.MatchModeOverlap {
+		fdlLogger.Error().
+			Str("config_name", cfg.Name).
+			Str("match_mode", lookupCfg.Params.MatchMode).
+			Msg("Match mode is not correct")
+		return LookupConfig{}, false
+	}
+	if lookupCfg.Params.MaxSkippedTokens, err = getMaxSkippedTokens(cfg.Params.FDL); err != nil {
+		fdlLogger.Err(err).Str("config_name", cfg.Name).Msg("Max skipped tokens is not correct")
+		return LookupConfig{}, false
+	}
+	lookupCfg.Params.ExpandAbbreviations = cfg.Params.FDL.ExpandAbbreviations
+
+	switch cfg.Params.FDL.LookupEngine {
+	case "", types.LookupEngineRareWord:
+	case types.LookupEngineTrie:
+		// the trie finds only contiguous exact matches
+		if lookupCfg.Params.MatchMode != types.MatchModeContiguous || cfg.Params.FDL.FuzzyMaxDistance > 0 {
+			fdlLogger.Error().
+				Str("config_name", cfg.Name).
+				Str("match_mode", lookupCfg.Params.MatchMode).
+				Int("fuzzy_max_distance", cfg.Params.FDL.FuzzyMaxDistance).
+				Msg("Trie lookup engine supports only contiguous match mode without fuzzy lookup")
+			return LookupConfig{}, false
+		}
+		lookupCfg.Matcher = matcherMap[cfg.Name]
+	default:
+		fdlLogger.Error().
+			Str("config_name", cfg.Name).
+			Str("lookup_engine", cfg.Params.FDL.LookupEngine).
+			Msg("Lookup engine is not correct")
+		return LookupConfig{}, false
+	}
+
+	disambiguation, err := NewDisambiguationParams(cfg.Params.FDL)
+	if err != nil {
+		fdlLogger.Err(err).
+			Str("config_name", cfg.Name).
+			Msg("Disambiguation parameters are not correct")
+		return LookupConfig{}, false
+	}
+	lookupCfg.Disambiguation = disambiguation
+
+	filter, err := createTermFilter(dictDir, cfg)
+	if err != nil {
+		fdlLogger.Err(err).
+			Str("config_name", cfg.Name).
+			Str("blocklist", cfg.Params.FDL.Blocklist).
+			Str("allowlist", cfg.Params.FDL.Allowlist).
+			Msg("Could not create term filter")
+		return LookupConfig{}, false
+	}
+	lookupCfg.Filter = filter
+
+	// configurations without the user dictionary file aren't managed by the admin API, in-memory updates
+	// would be lost on restart
+	if len(cfg.Params.FDL.UserDictionary) == 0 {
+		return lookupCfg, true
+	}
+
+	overlay, err := createOverlay(dictDir, cfg, analyzer)
+	if err != nil {
+		fdlLogger.Err(err).
+			Str("config_name", cfg.Name).
+			Str("user_dictionary", cfg.Params.FDL.UserDictionary).
+			Msg("Could not load user dictionary")
+		return LookupConfig{}, false
+	}
+	lookupCfg.Dict = overlay.Dictionary(dict)
+	lookupCfg.Factory = overlay.ConceptFactory(factory)
+	RegisterOverlay(overlay)
+
+	reloadInterval := cfg.Params.FDL.UserDictionaryReload
+	if reloadInterval <= 0 {
+		reloadInterval = defaultUserDictionaryReload
+	}
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	go overlay.Watch(time.Duration(reloadInterval)*time.Second, stop)
+	lookupCfg.releases = append(lookupCfg.releases, func() {
+		stopOnce.Do(func() {
+			close(stop)
+		})
+	})
+
+	return lookupCfg, true
+}
+
+// createOverlay creates the user dictionary of the configuration from the user_dictionary file, the file is
+// created by the first admin API update if it doesn't exist
+func createOverlay(dictDir string, cfg types.Configuration, analyzer TermAnalyzer) (*Overlay, error) {
+	casePolicy, err := NewCasePolicy(cfg.Params.FDL)
+	if err != nil {
+		return nil, err
+	}
+	return NewOverlay(cfg.Name, path.Join(dictDir, cfg.Params.FDL.UserDictionary), casePolicy, analyzer)
+}
+
+// createTermAnalyzers creates term tokenizers of the configurations, the POS tagger and the lemmatizer are shared
+// by all of them
+func createTermAnalyzers(resourceDir string, configs []types.Configuration) (map[string]TermAnalyzer, error) {
+	var tag TermTagger
+	var lemmatize lemmatizer.MorphologicalAnalyzer
+	result := make(map[string]TermAnalyzer)
+	for _, cfg := range configs {
+		if cfg.Pipeline != types.DefaultClinicalPipeline {
+			continue
+		}
+
+		mode := cfg.Params.FDL.TermTokenizer
+		if mode == types.TermTokenizerPTB && lemmatize == nil {
+			posModel, err := pos.LoadModelFromFile(path.Join(resourceDir, "pos", "pos.model.json"))
+			if err != nil {
+				return nil, err
+			}
+			tag = pos.NewTagger(posModel)
+			if lemmatize, err = lemmatizer.LoadMorphologicalAnalyzer(path.Join(resourceDir, "lemmatizer")); err != nil {
+				return nil, err
+			}
+		}
+
+		analyzer, err := NewTermAnalyzer(mode, tag, lemmatize)
+		if err != nil {
+			return nil, fmt.Errorf("configuration %s: %w", cfg.Name, err)
+		}
+		result[cfg.Name] = analyzer
+	}
+	return result, nil
+}
+
+func createTermFilter(dictDir string, cfg types.Configuration) (TermFilter, error) {
+	blocklist := cfg.Params.FDL.Blocklist
+	allowlist := cfg.Params.FDL.Allowlist
+	if len(blocklist) == 0 && len(allowlist) == 0 {
+		return nil, nil
+	}
+
+	if len(blocklist) > 0 {
+		blocklist = path.Join(dictDir, blocklist)
+	}
+	if len(allowlist) > 0 {
+		allowlist = path.Join(dictDir, allowlist)
+	}
+
+	return CreateTermFilter(cfg.Name, blocklist, allowlist)
+}
+
 func NewDictionaryLookup() func(in <-chan types.Sentence, cfg LookupConfig, tid string) <-chan []types.Annotation {
 	return func(in <-chan types.Sentence, cfg LookupConfig, tid string) <-chan []types.Annotation {
 		fdlLogger := logger.NewLogger("DictionaryLookup").With().
@@ -163,6 +457,7 @@ func NewDictionaryLookup() func(in <-chan types.Sentence, cfg LookupConfig, tid
 		dictionary := cfg.Dict
 		factory := cfg.Factory
 		consumer := cfg.Cons
+		filter := cfg.Filter
 
 		go func() {
 			defer close(out)
@@ -176,7 +471,10 @@ func NewDictionaryLookup() func(in <-chan types.Sentence, cfg LookupConfig, tid
 				go func(sent types.Sentence) {
 					defer wg.Done()
 
-					spans, cuis := searchSpansInWindow(sent, dictionary, cfg.Params)
+					spans, cuis, inexactSpans, userHits := searchSpansInWindow(sent, dictionary, cfg.Matcher, cfg.Params)
+					if filter != nil {
+						spans, cuis = filter(sent, spans, cuis)
+					}
 
 					var allCuis []*string
 					cuisCache := make(map[*string]bool)
@@ -199,6 +497,13 @@ func NewDictionaryLookup() func(in <-chan types.Sentence, cfg LookupConfig, tid
 					annotations := consumer(spans, cuis, conceptMap)
 					for i := 0; i < len(annotations); i++ {
 						annotations[i].Sentence = &sent
+						spanHash := annotations[i].Span.GetHashCode()
+						if match, isInexact := inexactSpans[spanHash]; isInexact {
+							match.setAttributes(&annotations[i])
+						}
+						if userCuis, isUserHit := userHits[spanHash]; isUserHit {
+							setUserDictionaryAttributes(&annotations[i], userCuis)
+						}
 					}
 					//for _, ann := range annotations {
 					//	ann.Sentence = &sent
@@ -223,10 +528,99 @@ func NewDictionaryLookup() func(in <-chan types.Sentence, cfg LookupConfig, tid
 	}
 }
 
-func searchSpansInWindow(sentence types.Sentence, dictionary Dictionary, params DictionaryLookupParams) ([]types.Span, [][]*string) {
+// spanMatch describes how the span was found when it is not an exact contiguous hit
+type spanMatch struct {
+	EditDistance uint8
+	CoveredSpans []types.Span
+	Expansion    *types.Expansion
+}
+
+func (match spanMatch) setAttributes(ann *types.Annotation) {
+	if match.EditDistance > 0 {
+		ann.Attributes[MatchTypeParamName] = MatchTypeFuzzy
+		ann.Attributes[EditDistanceParamName] = match.EditDistance
+	} else if match.Expansion != nil {
+		ann.Attributes[MatchTypeParamName] = MatchTypeAbbreviation
+	} else {
+		ann.Attributes[MatchTypeParamName] = MatchTypeOverlap
+	}
+
+	if match.Expansion != nil {
+		ann.Attributes[AbbreviationParamName] = map[string]interface{}{
+			"abbreviation": match.Expansion.Abbreviation,
+			"expansion":    match.Expansion.Text,
+			"source":       match.Expansion.Source,
+		}
+	}
+
+	if len(match.CoveredSpans) > 0 {
+		coveredSpans := make([]interface{}, len(match.CoveredSpans))
+		for i, span := range match.CoveredSpans {
+			coveredSpans[i] = []interface{}{*span.Text, span.Begin, span.End}
+		}
+		ann.Attributes[CoveredSpansParamName] = coveredSpans
+	}
+}
+
+// setUserDictionaryAttributes tags the annotation which concepts were found by the user dictionary terms
+func setUserDictionaryAttributes(ann *types.Annotation, userCuis map[*string]bool) {
+	var cuis []string
+	for _, concept := range ann.Concepts {
+		if userCuis[concept.CUI] {
+			cuis = append(cuis, *concept.CUI)
+		}
+	}
+	if len(cuis) == 0 {
+		return
+	}
+	sort.Strings(cuis)
+	ann.Attributes[SourceParamName] = UserDictionarySource
+	ann.Attributes[UserCUIsParamName] = cuis
+}
+
+// searchSpansInWindow returns found spans, their CUIs, the matches of the spans found only by fuzzy or overlap lookup
+// and CUIs of the spans found by the user dictionary terms. Terms are looked up by the rare words in the dictionary
+// and found by the matcher if it's set.
+func searchSpansInWindow(sentence types.Sentence, dictionary Dictionary, matcher TermMatcher, params DictionaryLookupParams) ([]types.Span, [][]*string, map[uint64]spanMatch, map[uint64]map[*string]bool) {
 
 	spansMap := make(map[uint64]types.Span)
 	cuiMap := make(map[uint64]map[*string]bool)
+	exactSpans := make(map[uint64]bool)
+	inexactSpans := make(map[uint64]spanMatch)
+	userHits := make(map[uint64]map[*string]bool)
+
+	addHit := func(newSpan types.Span, term *RareWordTerm, match spanMatch) {
+		spanHash := newSpan.GetHashCode()
+		spanCuis, hasSpan := cuiMap[spanHash]
+		if !hasSpan {
+			spansMap[spanHash] = newSpan
+			spanCuis = make(map[*string]bool)
+		}
+		spanCuis[term.CUI] = true
+		cuiMap[spanHash] = spanCuis
+
+		if term.Source == UserDictionarySource {
+			userCuis, ok := userHits[spanHash]
+			if !ok {
+				userCuis = make(map[*string]bool)
+				userHits[spanHash] = userCuis
+			}
+			userCuis[term.CUI] = true
+		}
+
+		if !term.IsFuzzy() && len(match.CoveredSpans) == 0 && match.Expansion == nil {
+			exactSpans[spanHash] = true
+			delete(inexactSpans, spanHash)
+			return
+		}
+		if exactSpans[spanHash] {
+			return
+		}
+		if known, ok := inexactSpans[spanHash]; !ok || term.EditDistance < known.EditDistance {
+			match.EditDistance = term.EditDistance
+			inexactSpans[spanHash] = match
+		}
+	}
 
 	nonNewLineIndices := getNonNewLineIndices(sentence)
 
@@ -234,6 +628,33 @@ func searchSpansInWindow(sentence types.Sentence, dictionary Dictionary, params
 
 	tokens := sentence.Tokens
 
+	if matcher != nil {
+		words := make([][]*string, len(nonNewLineIndices))
+		for idx, tokenIndex := range nonNewLineIndices {
+			words[idx] = []*string{tokens[tokenIndex].Text, tokens[tokenIndex].Lemma}
+		}
+		matcher(words, func(begin int, end int, term *RareWordTerm) {
+			if term.TextLength < params.MinimumLookupSpan {
+				return
+			}
+			// the rare word engine looks up terms only by the lookup tokens
+			if isNonLookupToken(*tokens[nonNewLineIndices[begin+int(term.RareWordIndex)]], params) {
+				return
+			}
+
+			termStartIndex := nonNewLineIndices[begin]
+			termEndIndex := nonNewLineIndices[end]
+			if !isTermMatch(term, tokens, termStartIndex, termEndIndex) {
+				return
+			}
+			if termStartIndex == termEndIndex {
+				addHit(tokens[termStartIndex].Span, term, spanMatch{})
+				return
+			}
+			addHit(createSpan(sentence, sentenceTextRunes, tokens[termStartIndex].Begin, tokens[termEndIndex].End), term, spanMatch{})
+		})
+	}
+
 	for idx, lookupIndex := range nonNewLineIndices {
 		lookupToken := tokens[lookupIndex]
 		if isNonLookupToken(*lookupToken, params) {
@@ -259,57 +680,45 @@ func searchSpansInWindow(sentence types.Sentence, dictionary Dictionary, params
 			}
 
 			if len(rareWordHit.Tokens) == 1 {
-				spanHash := lookupToken.Span.GetHashCode()
-				spanCuis, hasSpan := cuiMap[spanHash]
-				if !hasSpan {
-					spansMap[spanHash] = lookupToken.Span
-					spanCuis = make(map[*string]bool)
+				if !rareWordHit.MatchesCase(0, lookupToken) {
+					continue
 				}
-				spanCuis[rareWordHit.CUI] = true
-				cuiMap[spanHash] = spanCuis
+				addHit(lookupToken.Span, rareWordHit, spanMatch{})
 				continue
 			}
 
-			//termStartIndex := lookupIndex - int(rareWordHit.RareWordIndex)
-			//if termStartIndex < 0 || termStartIndex+rareWordHit.GetTokenCount() > len(tokens) {
-			//	continue
-			//}
-
-			lookupStartIndex := idx - int(rareWordHit.RareWordIndex)
-			if lookupStartIndex < 0 || lookupStartIndex+rareWordHit.GetTokenCount() > len(nonNewLineIndices) {
+			if termStartIndex, termEndIndex, isMatch := matchContiguousTerm(rareWordHit, tokens, nonNewLineIndices, idx); isMatch {
+				spanStart := tokens[termStartIndex].Begin
+				spanEnd := tokens[termEndIndex].End
+				addHit(createSpan(sentence, sentenceTextRunes, spanStart, spanEnd), rareWordHit, spanMatch{})
 				continue
 			}
 
-			termStartIndex := nonNewLineIndices[lookupStartIndex]
-
-			//termEndIndex := termStartIndex + rareWordHit.GetTokenCount() - 1
-			lookupEndIndex := lookupStartIndex + rareWordHit.GetTokenCount() - 1
-			if lookupEndIndex >= len(nonNewLineIndices) {
+			if params.MatchMode != types.MatchModeOverlap {
 				continue
 			}
 
-			termEndIndex := nonNewLineIndices[lookupEndIndex]
-
-			if isTermMatch(rareWordHit, tokens, termStartIndex, termEndIndex) {
-				spanStart := tokens[termStartIndex].Begin
-				spanEnd := tokens[termEndIndex].End
-				//spanText := (*sentence.Text)[spanStart-sentence.Begin : spanEnd-sentence.Begin]
-				spanText := string(sentenceTextRunes[spanStart-sentence.Begin : spanEnd-sentence.Begin])
-				newSpan := types.Span{
-					Begin: spanStart,
-					End:   spanEnd,
-					Text:  &spanText,
-				}
+			if matched, isMatch := matchOverlapTerm(rareWordHit, tokens, nonNewLineIndices, idx, params.MaxSkippedTokens); isMatch {
+				newSpan, coveredSpans := createOverlapSpans(sentence, sentenceTextRunes, tokens, nonNewLineIndices, matched)
+				addHit(newSpan, rareWordHit, spanMatch{CoveredSpans: coveredSpans})
+			}
+		}
+	}
 
-				spanHash := newSpan.GetHashCode()
-				spanCuis, hasSpan := cuiMap[spanHash]
-				if !hasSpan {
-					spansMap[spanHash] = newSpan
-					spanCuis = make(map[*string]bool)
-				}
-				spanCuis[rareWordHit.CUI] = true
-				cuiMap[spanHash] = spanCuis
+	if params.ExpandAbbreviations {
+		for idx, lookupIndex := range nonNewLineIndices {
+			expansion := tokens[lookupIndex].Expansion
+			if expansion == nil || idx+expansion.Length > len(nonNewLineIndices) {
+				continue
 			}
+			endIndex := nonNewLineIndices[idx+expansion.Length-1]
+			newSpan := createSpan(sentence, sentenceTextRunes, tokens[lookupIndex].Begin, tokens[endIndex].End)
+			lookupExpansion(expansion, dictionary, matcher, func(term *RareWordTerm) {
+				if term.TextLength < params.MinimumLookupSpan {
+					return
+				}
+				addHit(newSpan, term, spanMatch{Expansion: expansion})
+			})
 		}
 	}
 
@@ -328,7 +737,80 @@ func searchSpansInWindow(sentence types.Sentence, dictionary Dictionary, params
 
 		cuis = append(cuis, cuiToSlice)
 	}
-	return spans, cuis
+	return spans, cuis, inexactSpans, userHits
+}
+
+// lookupExpansion visits the terms which match all tokens of the abbreviation expansion
+func lookupExpansion(expansion *types.Expansion, dictionary Dictionary, matcher TermMatcher, visit func(term *RareWordTerm)) {
+	expansionTokens := make([]*types.Token, len(expansion.Tokens))
+	for i, token := range expansion.Tokens {
+		expansionTokens[i] = &types.Token{Span: types.Span{Text: token}}
+	}
+
+	if matcher != nil {
+		words := make([][]*string, len(expansion.Tokens))
+		for i, token := range expansion.Tokens {
+			words[i] = []*string{token}
+		}
+		matcher(words, func(begin int, end int, term *RareWordTerm) {
+			if begin == 0 && end == len(words)-1 {
+				visit(term)
+			}
+		})
+	}
+
+	itr := dictionary(expansion.Tokens)
+	for {
+		term, ok := itr()
+		if !ok {
+			break
+		}
+		if isExpansionMatch(term, expansionTokens) {
+			visit(term)
+		}
+	}
+}
+
+// isExpansionMatch checks that the term has the same tokens as the expansion, the fuzzy terms are not used
+func isExpansionMatch(term *RareWordTerm, expansionTokens []*types.Token) bool {
+	if term.IsFuzzy() || term.GetTokenCount() != len(expansionTokens) {
+		return false
+	}
+	for i, token := range expansionTokens {
+		if !term.MatchesToken(i, token) {
+			return false
+		}
+	}
+	return true
+}
+
+func createSpan(sentence types.Sentence, sentenceTextRunes []rune, spanStart int32, spanEnd int32) types.Span {
+	spanText := string(sentenceTextRunes[spanStart-sentence.Begin : spanEnd-sentence.Begin])
+	return types.Span{
+		Begin: spanStart,
+		End:   spanEnd,
+		Text:  &spanText,
+	}
+}
+
+// matchContiguousTerm checks that all term tokens go one by one (except new lines) around the rare word token
+// with index idx in nonNewLineIndices. Returns indices of the first and the last term tokens.
+func matchContiguousTerm(term *RareWordTerm, tokens []*types.Token, nonNewLineIndices []int, idx int) (int, int, bool) {
+	lookupStartIndex := idx - int(term.RareWordIndex)
+	if lookupStartIndex < 0 || lookupStartIndex+term.GetTokenCount() > len(nonNewLineIndices) {
+		return 0, 0, false
+	}
+
+	termStartIndex := nonNewLineIndices[lookupStartIndex]
+
+	lookupEndIndex := lookupStartIndex + term.GetTokenCount() - 1
+	if lookupEndIndex >= len(nonNewLineIndices) {
+		return 0, 0, false
+	}
+
+	termEndIndex := nonNewLineIndices[lookupEndIndex]
+
+	return termStartIndex, termEndIndex, isTermMatch(term, tokens, termStartIndex, termEndIndex)
 }
 
 func getNonNewLineIndices(sentence types.Sentence) []int {
@@ -342,13 +824,18 @@ func getNonNewLineIndices(sentence types.Sentence) []int {
 }
 
 func isTermMatch(term *RareWordTerm, tokens []*types.Token, beginIdx int, endIdx int) bool {
-	hitTokens := term.Tokens
 	hit := 0
 	for i := beginIdx; i < endIdx+1; i++ {
 		if tokens[i].IsNewline {
 			continue
 		}
-		if hitTokens[hit] == tokens[i].Lemma || hitTokens[hit] == tokens[i].Text {
+		if term.MatchesToken(hit, tokens[i]) {
+			hit++
+			continue
+		}
+
+		// the rare word of the fuzzy hit was already matched by the dictionary, other tokens must match exactly
+		if term.IsFuzzy() && hit == int(term.RareWordIndex) {
 			hit++
 			continue
 		}
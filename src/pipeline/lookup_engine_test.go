@@ -0,0 +1,119 @@
+package pipeline
+
+import (
+	"archive/zip"
+	"text2phenotype.com/fdl/lookup"
+	"text2phenotype.com/fdl/types"
+	"text2phenotype.com/fdl/utils"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// count of the mtsamples documents processed by every benchmark iteration
+const benchmarkSampleCount = 50
+
+func getSpanTexts(spans []types.Span) []string {
+	var texts []string
+	for _, span := range spans {
+		texts = append(texts, *span.Text)
+	}
+	sort.Strings(texts)
+	return texts
+}
+
+func TestTrieLookupEngine(t *testing.T) {
+	store := utils.GlobalStringStore()
+	left, knee, pain := store.GetPointer("left"), store.GetPointer("knee"), store.GetPointer("pain")
+	rwMap := lookup.RareWordTermMap{
+		left: {{Tokens: []*string{left, knee, pain}, CUI: store.GetPointer("c0231749"), TextLength: 14}},
+		knee: {
+			{Tokens: []*string{knee}, CUI: store.GetPointer("c0022742"), TextLength: 4},
+			{Tokens: []*string{left, knee}, CUI: store.GetPointer("c0230433"), TextLength: 9, RareWordIndex: 1},
+		},
+		pain: {{Tokens: []*string{pain}, CUI: store.GetPointer("c0030193"), TextLength: 4}},
+	}
+	dictionary := func(words []*string) lookup.MapListIterator {
+		return lookup.CreateMapListIterator(rwMap, words)
+	}
+	matcher := lookup.NewTermTrie(rwMap).Match
+
+	params := GetDefaultDictionaryLookupParams()
+	for _, text := range []string{"left knee pain", "pain in the left\nknee", "left left knee , pain"} {
+		sent := makeLookupSentence(text)
+		rareWordSpans, _, _, _ := searchSpansInWindow(sent, dictionary, nil, params)
+		trieSpans, _, _, _ := searchSpansInWindow(sent, lookup.EmptyDictionary, matcher, params)
+		require.NotEmpty(t, rareWordSpans, text)
+		require.Equal(t, getSpanTexts(rareWordSpans), getSpanTexts(trieSpans), text)
+	}
+}
+
+func loadMTSamples(b *testing.B, rootPath string, count int) []Request {
+	reader, err := zip.OpenReader(path.Join(rootPath, "testdata/mtsamples-clean.zip"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer reader.Close()
+
+	var requests []Request
+	for _, sample := range reader.File {
+		if filepath.Ext(sample.Name) != ".txt" {
+			continue
+		}
+		file, err := sample.Open()
+		if err != nil {
+			b.Fatal(err)
+		}
+		buf, err := ioutil.ReadAll(file)
+		_ = file.Close()
+		if err != nil {
+			b.Fatal(err)
+		}
+		requests = append(requests, Request{Tid: filepath.Base(sample.Name), Text: string(buf)})
+		if len(requests) == count {
+			break
+		}
+	}
+	return requests
+}
+
+// BenchmarkLookupEngines compares the rare word and trie engines on the mtsamples documents, the trie engine is
+// enabled only for the configurations which it supports. It requires the dictionaries in resources/dictionaries.
+func BenchmarkLookupEngines(b *testing.B) {
+	rootPath, err := filepath.Abs("../../")
+	if err != nil {
+		b.Fatal(err)
+	}
+	cfgs, err := types.LoadConfigurations(path.Join(rootPath, "config"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	requests := loadMTSamples(b, rootPath, benchmarkSampleCount)
+
+	for _, engine := range []string{types.LookupEngineRareWord, types.LookupEngineTrie} {
+		engineCfgs := make([]types.Configuration, len(cfgs))
+		for i, cfg := range cfgs {
+			if cfg.Params.FDL.FuzzyMaxDistance == 0 && cfg.Params.FDL.MatchMode != types.MatchModeOverlap {
+				cfg.Params.FDL.LookupEngine = engine
+			}
+			engineCfgs[i] = cfg
+		}
+
+		b.Run(engine, func(b *testing.B) {
+			ppln, err := DefaultClinical(GetDefaultClinicalParams(rootPath, path.Join(rootPath, "resources", "dictionaries"), engineCfgs))
+			if err != nil {
+				b.Skip("dictionaries are not available: ", err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, req := range requests {
+					<-ppln(req)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package pipeline
+
+import (
+	"text2phenotype.com/fdl/lookup"
+	"text2phenotype.com/fdl/types"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCreateLookupConfigUserDictionary(t *testing.T) {
+	analyzer, err := lookup.NewTermAnalyzer(types.TermTokenizerRegex, nil, nil)
+	require.NoError(t, err)
+	dictionary := func(words []*string) lookup.MapListIterator {
+		return lookup.CreateMapListIterator(lookup.RareWordTermMap{}, words)
+	}
+	factory := func(cuis []*string) (map[*string]lookup.SemanticConcepts, error) {
+		return nil, nil
+	}
+	logger := zerolog.Nop()
+	create := func(cfg types.Configuration) {
+		lookupCfg, ok := createLookupConfig(
+			t.TempDir(),
+			cfg,
+			analyzer,
+			map[string]lookup.Dictionary{cfg.Name: dictionary},
+			nil,
+			map[string]lookup.ConceptFactory{cfg.Name: factory},
+			&logger,
+		)
+		require.True(t, ok)
+		t.Cleanup(lookupCfg.Release)
+	}
+
+	cfg := types.Configuration{Name: "lookup_test_no_user_dictionary", Pipeline: types.DefaultClinicalPipeline}
+	create(cfg)
+	_, err = lookup.GetOverlay(cfg.Name)
+	require.Error(t, err)
+
+	cfg.Name = "lookup_test_user_dictionary"
+	cfg.Params.FDL.UserDictionary = "user_terms.bsv"
+	create(cfg)
+	_, err = lookup.GetOverlay(cfg.Name)
+	require.NoError(t, err)
+}
@@ -0,0 +1,139 @@
+package pipeline
+
+import (
+	. "text2phenotype.com/fdl/lookup"
+	"text2phenotype.com/fdl/types"
+	"text2phenotype.com/fdl/utils"
+	"fmt"
+	"sort"
+)
+
+const defaultMaxSkippedTokens = 2
+
+// getMaxSkippedTokens returns the configured number of words between the overlap matched tokens, the default if
+// it isn't set
+func getMaxSkippedTokens(cfg types.FDLConfig) (int, error) {
+	if cfg.MaxSkippedTokens == nil {
+		return defaultMaxSkippedTokens, nil
+	}
+	if *cfg.MaxSkippedTokens < 0 {
+		return 0, fmt.Errorf("max_skipped_tokens must not be negative, got %d", *cfg.MaxSkippedTokens)
+	}
+	return *cfg.MaxSkippedTokens, nil
+}
+
+// overlap matching never crosses these tokens
+var clauseBoundaries = map[string]bool{
+	".": true, ";": true, ":": true, "!": true, "?": true,
+}
+
+func isClauseBoundary(token *types.Token) bool {
+	return token.IsPunct && clauseBoundaries[*token.Text]
+}
+
+// getClauseBounds returns the first and the last positions (in nonNewLineIndices) of the clause with position idx
+func getClauseBounds(tokens []*types.Token, nonNewLineIndices []int, idx int) (int, int) {
+	begin := idx
+	for begin > 0 && !isClauseBoundary(tokens[nonNewLineIndices[begin-1]]) {
+		begin--
+	}
+
+	end := idx
+	for end < len(nonNewLineIndices)-1 && !isClauseBoundary(tokens[nonNewLineIndices[end+1]]) {
+		end++
+	}
+
+	return begin, end
+}
+
+// matchOverlapTerm looks for the term tokens in any order around the rare word token with position idx
+// (in nonNewLineIndices) within one clause. Not more than maxSkipped words may be between the term tokens.
+// Returns sorted positions of the matched tokens.
+func matchOverlapTerm(term *RareWordTerm, tokens []*types.Token, nonNewLineIndices []int, idx int, maxSkipped int) ([]int, bool) {
+	// the dictionary matches the rare word regardless of the case, the rare word of the fuzzy hit is already matched
+	if !term.IsFuzzy() && !term.MatchesToken(int(term.RareWordIndex), tokens[nonNewLineIndices[idx]]) {
+		return nil, false
+	}
+
+	clauseBegin, clauseEnd := getClauseBounds(tokens, nonNewLineIndices, idx)
+
+	radius := term.GetTokenCount() - 1 + maxSkipped
+	windowBegin := idx - radius
+	if windowBegin < clauseBegin {
+		windowBegin = clauseBegin
+	}
+	windowEnd := idx + radius
+	if windowEnd > clauseEnd {
+		windowEnd = clauseEnd
+	}
+
+	used := map[int]bool{idx: true}
+	matched := []int{idx}
+
+	for termTokenIdx := range term.Tokens {
+		if termTokenIdx == int(term.RareWordIndex) {
+			continue
+		}
+
+		// the nearest token to the rare word wins
+		bestPosition := -1
+		for position := windowBegin; position <= windowEnd; position++ {
+			token := tokens[nonNewLineIndices[position]]
+			if used[position] || token.IsPunct || !term.MatchesToken(termTokenIdx, token) {
+				continue
+			}
+			if bestPosition < 0 || utils.AbsInt(position-idx) < utils.AbsInt(bestPosition-idx) {
+				bestPosition = position
+			}
+		}
+
+		if bestPosition < 0 {
+			return nil, false
+		}
+
+		used[bestPosition] = true
+		matched = append(matched, bestPosition)
+	}
+
+	sort.Ints(matched)
+
+	skipped := 0
+	for position := matched[0]; position <= matched[len(matched)-1]; position++ {
+		if !used[position] && !tokens[nonNewLineIndices[position]].IsPunct {
+			skipped++
+		}
+	}
+
+	if skipped > maxSkipped {
+		return nil, false
+	}
+
+	return matched, true
+}
+
+// createOverlapSpans creates the span which covers all matched tokens and the sub-spans of the adjacent matched tokens
+func createOverlapSpans(sentence types.Sentence, sentenceTextRunes []rune, tokens []*types.Token, nonNewLineIndices []int, matched []int) (types.Span, []types.Span) {
+	first := tokens[nonNewLineIndices[matched[0]]]
+	last := tokens[nonNewLineIndices[matched[len(matched)-1]]]
+	span := createSpan(sentence, sentenceTextRunes, first.Begin, last.End)
+
+	var coveredSpans []types.Span
+	runBegin := matched[0]
+	for i := 1; i <= len(matched); i++ {
+		if i < len(matched) && matched[i] == matched[i-1]+1 {
+			continue
+		}
+		runEnd := matched[i-1]
+		coveredSpans = append(coveredSpans, createSpan(
+			sentence,
+			sentenceTextRunes,
+			tokens[nonNewLineIndices[runBegin]].Begin,
+			tokens[nonNewLineIndices[runEnd]].End,
+		))
+		if i < len(matched) {
+			runBegin = matched[i]
+		}
+	}
+
+	return span, coveredSpans
+}
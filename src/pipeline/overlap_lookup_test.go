@@ -0,0 +1,119 @@
+package pipeline
+
+import (
+	"text2phenotype.com/fdl/lookup"
+	"text2phenotype.com/fdl/types"
+	"text2phenotype.com/fdl/utils"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func makeLookupSentence(text string) types.Sentence {
+	store := utils.GlobalStringStore()
+	tag := store.GetPointer("NN")
+	sent := types.Sentence{
+		Span: types.Span{Begin: 0, End: int32(len(text)), Text: &text},
+	}
+	offset := 0
+	for _, word := range strings.Fields(text) {
+		begin := strings.Index(text[offset:], word) + offset
+		end := begin + len(word)
+		offset = end
+		sent.Tokens = append(sent.Tokens, &types.Token{
+			Span:    types.Span{Begin: int32(begin), End: int32(end), Text: store.GetPointer(strings.ToLower(word))},
+			Tag:     tag,
+			IsWord:  true,
+			IsPunct: word == "," || word == ";",
+			Shape:   types.GetShape(word),
+		})
+	}
+	return sent
+}
+
+func TestOverlapLookup(t *testing.T) {
+	store := utils.GlobalStringStore()
+	left, knee, pain := store.GetPointer("left"), store.GetPointer("knee"), store.GetPointer("pain")
+	rwMap := lookup.RareWordTermMap{
+		left: {{Tokens: []*string{left, knee, pain}, CUI: store.GetPointer("c0231749"), TextLength: 14}},
+	}
+	dictionary := func(words []*string) lookup.MapListIterator {
+		return lookup.CreateMapListIterator(rwMap, words)
+	}
+
+	params := GetDefaultDictionaryLookupParams()
+
+	sent := makeLookupSentence("pain in the left knee")
+	spans, _, _, _ := searchSpansInWindow(sent, dictionary, nil, params)
+	require.Empty(t, spans)
+
+	params.MatchMode = types.MatchModeOverlap
+	spans, _, matches, _ := searchSpansInWindow(sent, dictionary, nil, params)
+	require.Len(t, spans, 1)
+	require.Equal(t, "pain in the left knee", *spans[0].Text)
+
+	covered := matches[spans[0].GetHashCode()].CoveredSpans
+	require.Len(t, covered, 2)
+	require.Equal(t, "pain", *covered[0].Text)
+	require.Equal(t, "left knee", *covered[1].Text)
+
+	params.MaxSkippedTokens = 1
+	spans, _, _, _ = searchSpansInWindow(sent, dictionary, nil, params)
+	require.Empty(t, spans)
+
+	params.MaxSkippedTokens = 2
+	spans, _, _, _ = searchSpansInWindow(makeLookupSentence("pain ; the left knee"), dictionary, nil, params)
+	require.Empty(t, spans)
+
+	// the tokens must be adjacent but may go in any order
+	params.MaxSkippedTokens = 0
+	spans, _, _, _ = searchSpansInWindow(makeLookupSentence("pain left knee"), dictionary, nil, params)
+	require.Len(t, spans, 1)
+	spans, _, _, _ = searchSpansInWindow(sent, dictionary, nil, params)
+	require.Empty(t, spans)
+}
+
+func TestOverlapLookupCase(t *testing.T) {
+	store := utils.GlobalStringStore()
+	all, leukemia := store.GetPointer("all"), store.GetPointer("leukemia")
+	rwMap := lookup.RareWordTermMap{
+		all: {{
+			Tokens:      []*string{all, leukemia},
+			CasedTokens: []string{"ALL", "leukemia"},
+			CUI:         store.GetPointer("c0023449"),
+			TextLength:  12,
+		}},
+	}
+	dictionary := func(words []*string) lookup.MapListIterator {
+		return lookup.CreateMapListIterator(rwMap, words)
+	}
+
+	params := GetDefaultDictionaryLookupParams()
+	params.MatchMode = types.MatchModeOverlap
+
+	spans, _, _, _ := searchSpansInWindow(makeLookupSentence("leukemia in all patients"), dictionary, nil, params)
+	require.Empty(t, spans)
+
+	spans, _, _, _ = searchSpansInWindow(makeLookupSentence("leukemia , ALL type"), dictionary, nil, params)
+	require.Len(t, spans, 1)
+	require.Equal(t, "leukemia , ALL", *spans[0].Text)
+}
+
+func TestGetMaxSkippedTokens(t *testing.T) {
+	value := func(v int) *int { return &v }
+
+	maxSkipped, err := getMaxSkippedTokens(types.FDLConfig{})
+	require.NoError(t, err)
+	require.Equal(t, defaultMaxSkippedTokens, maxSkipped)
+
+	maxSkipped, err = getMaxSkippedTokens(types.FDLConfig{MaxSkippedTokens: value(0)})
+	require.NoError(t, err)
+	require.Equal(t, 0, maxSkipped)
+
+	maxSkipped, err = getMaxSkippedTokens(types.FDLConfig{MaxSkippedTokens: value(5)})
+	require.NoError(t, err)
+	require.Equal(t, 5, maxSkipped)
+
+	_, err = getMaxSkippedTokens(types.FDLConfig{MaxSkippedTokens: value(-1)})
+	require.Error(t, err)
+}
@@ -83,6 +83,11 @@ func NewDefaultClinicalResult() func(in <-chan []types.Annotation, cfg LookupCon
 						PreferredText: concept.PrefText,
 						SabConcepts:   sabConcepts,
 					}
+					if len(ann.Scores) == len(ann.Concepts) {
+						score := ann.Scores[j]
+						umlsConcepts[j].Rank = j + 1
+						umlsConcepts[j].Score = &score
+					}
 				}
 
 				// make content section
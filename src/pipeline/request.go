@@ -1,6 +1,9 @@
 package pipeline
 
-import "text2phenotype.com/fdl/types"
+import (
+	"text2phenotype.com/fdl/output"
+	"text2phenotype.com/fdl/types"
+)
 
 type RequestVocabParams struct {
 	Name   string              `json:"name"`
@@ -10,4 +13,39 @@ type RequestVocabParams struct {
 type Request struct {
 	Text string `json:"redis_key"`
 	Tid  string `json:"tid"`
+	// parameters of the configurations which override their defaults for this request
+	Vocabs []RequestVocabParams `json:"vocabs,omitempty"`
+	// output format of the response, JSON if empty
+	Format string `json:"format,omitempty"`
+	// version of the JSON response, version 1 if empty
+	Version string `json:"version,omitempty"`
+}
+
+// GetParams returns the request parameters of the configuration, parameters without name apply to all configurations
+// and parameters of the configuration win over them
+func (request Request) GetParams(configName string) types.RequestParams {
+	var result types.RequestParams
+	for _, name := range []string{"", configName} {
+		for _, vocab := range request.Vocabs {
+			if vocab.Name != name {
+				continue
+			}
+			if len(vocab.Params.LookupMode) > 0 {
+				result.LookupMode = vocab.Params.LookupMode
+			}
+			if len(vocab.Params.OverlapResolution) > 0 {
+				result.OverlapResolution = vocab.Params.OverlapResolution
+			}
+		}
+	}
+	return result
+}
+
+// GetFormat returns the output format of the response version, an error if the format or the version is not known
+func (request Request) GetFormat() (output.Format, error) {
+	format, err := output.GetFormat(request.Format)
+	if err != nil {
+		return format, err
+	}
+	return output.WithVersion(format, request.Version)
 }
@@ -0,0 +1,29 @@
+package pipeline
+
+import (
+	"text2phenotype.com/fdl/output"
+	"text2phenotype.com/fdl/types"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRequestGetFormat(t *testing.T) {
+	format, err := Request{}.GetFormat()
+	require.NoError(t, err)
+	require.Equal(t, output.FormatJSON, format.Name)
+
+	format, err = Request{Format: output.FormatJSON, Version: types.ResponseVersion2}.GetFormat()
+	require.NoError(t, err)
+	require.Equal(t, output.FormatJSON, format.Name)
+
+	format, err = Request{Format: "xmi"}.GetFormat()
+	require.NoError(t, err)
+	require.True(t, format.WithSentences)
+
+	_, err = Request{Format: "docx"}.GetFormat()
+	require.Error(t, err)
+	_, err = Request{Format: "xmi", Version: types.ResponseVersion2}.GetFormat()
+	require.Error(t, err)
+	_, err = Request{Version: "3"}.GetFormat()
+	require.Error(t, err)
+}
@@ -0,0 +1,26 @@
+package pipeline
+
+import (
+	"text2phenotype.com/fdl/types"
+)
+
+// NewSentenceCollector passes the sentences through and sends all of them in the document order to the
+// second channel when the input is closed, for the output formats which write the sentences and tokens
+func NewSentenceCollector() func(in <-chan types.Sentence) (<-chan types.Sentence, <-chan []types.Sentence) {
+	return func(in <-chan types.Sentence) (<-chan types.Sentence, <-chan []types.Sentence) {
+		out := make(chan types.Sentence)
+		collected := make(chan []types.Sentence, 1)
+
+		go func() {
+			defer close(out)
+			defer close(collected)
+			sentences := make([]types.Sentence, 0)
+			for sent := range in {
+				sentences = append(sentences, sent)
+				out <- sent
+			}
+			collected <- sentences
+		}()
+		return out, collected
+	}
+}
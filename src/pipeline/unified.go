@@ -0,0 +1,288 @@
+package pipeline
+
+import (
+	"text2phenotype.com/fdl/output"
+	"text2phenotype.com/fdl/types"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// UnifiedResultName is the response key of the result merged across the configurations
+const UnifiedResultName = output.UnifiedResultName
+
+// names of the section fields which are reconciled like attributes
+const (
+	aspectConflictName = "aspect"
+	nameConflictName   = "name"
+)
+
+// UnifiedParams enable the unified result. Priority lists the configurations whose values win when the attributes
+// disagree, configurations which are not listed follow in the order of their names.
+type UnifiedParams struct {
+	Enabled  bool     `json:"enabled"`
+	Priority []string `json:"priority"`
+}
+
+// Validate checks that the unified result doesn't hide a configuration and the priority lists known configurations
+func (params UnifiedParams) Validate(configs []types.Configuration) error {
+	if !params.Enabled {
+		return nil
+	}
+	names := make(map[string]bool)
+	for _, cfg := range configs {
+		if cfg.Name == UnifiedResultName {
+			return fmt.Errorf("configuration name %q is reserved for the unified result", UnifiedResultName)
+		}
+		names[cfg.Name] = true
+	}
+	for _, name := range params.Priority {
+		if !names[name] {
+			return fmt.Errorf("unified priority configuration %q is not loaded", name)
+		}
+	}
+	return nil
+}
+
+// getOrder returns the configuration names ordered by priority
+func (params UnifiedParams) getOrder(responses map[string]types.DefaultClinicalResponse) []string {
+	var result []string
+	isListed := make(map[string]bool)
+	for _, name := range params.Priority {
+		if _, ok := responses[name]; ok && !isListed[name] {
+			result = append(result, name)
+			isListed[name] = true
+		}
+	}
+
+	var rest []string
+	for name := range responses {
+		if !isListed[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(result, rest...)
+}
+
+type unifiedSection struct {
+	section types.UnifiedContentSection
+	// values of the reconciled fields by configuration, in priority order
+	values  map[string]map[string]interface{}
+	sources []string
+}
+
+// isSameAnnotation checks that the sections have the same span and share a CUI, sections without concepts
+// are the same if they have the same name
+func (unified *unifiedSection) isSameAnnotation(section types.ContentSection) bool {
+	begin, end := output.GetSpan(section)
+	unifiedBegin, unifiedEnd := output.GetSpan(unified.section.ContentSection)
+	if begin != unifiedBegin || end != unifiedEnd {
+		return false
+	}
+	if len(section.UmlsConcepts) == 0 && len(unified.section.UmlsConcepts) == 0 {
+		return section.Name == unified.section.Name
+	}
+	for _, concept := range section.UmlsConcepts {
+		if findConcept(unified.section.UmlsConcepts, concept.Cui) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func findConcept(concepts []types.UmlsConcept, cui string) int {
+	for i, concept := range concepts {
+		if concept.Cui == cui {
+			return i
+		}
+	}
+	return -1
+}
+
+func appendUnique(values []string, newValues ...string) []string {
+	for _, value := range newValues {
+		isKnown := false
+		for _, known := range values {
+			if known == value {
+				isKnown = true
+				break
+			}
+		}
+		if !isKnown {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// mergeSabConcepts unions the codes of the coding schemes and the TTYs of the codes
+func mergeSabConcepts(target []types.SabConcept, sabConcepts []types.SabConcept) []types.SabConcept {
+	for _, sabConcept := range sabConcepts {
+		idx := -1
+		for i, known := range target {
+			if known.CodingScheme == sabConcept.CodingScheme {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			target = append(target, types.SabConcept{CodingScheme: sabConcept.CodingScheme})
+			idx = len(target) - 1
+		}
+
+		for _, vocabConcept := range sabConcept.VocabConcepts {
+			isKnown := false
+			for i, known := range target[idx].VocabConcepts {
+				if known.Code == vocabConcept.Code {
+					target[idx].VocabConcepts[i].Tty = appendUnique(known.Tty, vocabConcept.Tty...)
+					isKnown = true
+					break
+				}
+			}
+			if !isKnown {
+				target[idx].VocabConcepts = append(target[idx].VocabConcepts, types.VocabConcept{
+					Tty:  appendUnique([]string{}, vocabConcept.Tty...),
+					Code: vocabConcept.Code,
+				})
+			}
+		}
+	}
+	return target
+}
+
+func (unified *unifiedSection) add(configName string, section types.ContentSection) {
+	if len(unified.sources) == 0 {
+		unified.section.ContentSection = section
+		unified.section.Attributes = make(map[string]interface{})
+		unified.section.UmlsConcepts = nil
+		unified.values = make(map[string]map[string]interface{})
+	}
+	unified.sources = appendUnique(unified.sources, configName)
+
+	for _, concept := range section.UmlsConcepts {
+		idx := findConcept(unified.section.UmlsConcepts, concept.Cui)
+		if idx < 0 {
+			unified.section.UmlsConcepts = append(unified.section.UmlsConcepts, types.UmlsConcept{
+				Cui:           concept.Cui,
+				PreferredText: concept.PreferredText,
+			})
+			idx = len(unified.section.UmlsConcepts) - 1
+		}
+		merged := &unified.section.UmlsConcepts[idx]
+		merged.Tui = appendUnique(merged.Tui, concept.Tui...)
+		merged.SabConcepts = mergeSabConcepts(merged.SabConcepts, concept.SabConcepts)
+		merged.Sources = appendUnique(merged.Sources, configName)
+		if len(merged.PreferredText) == 0 {
+			merged.PreferredText = concept.PreferredText
+		}
+	}
+
+	values := map[string]interface{}{
+		aspectConflictName: section.Aspect,
+		nameConflictName:   section.Name,
+	}
+	for key, value := range section.Attributes {
+		values[key] = value
+	}
+	for key, value := range values {
+		configValues, ok := unified.values[key]
+		if !ok {
+			configValues = make(map[string]interface{})
+			unified.values[key] = configValues
+		}
+		configValues[configName] = value
+	}
+}
+
+// reconcile sets the attributes the configurations agree on, the value of the configuration with the highest
+// priority is used otherwise and all values are kept in Conflicts
+func (unified *unifiedSection) reconcile() types.UnifiedContentSection {
+	result := unified.section
+	result.Sources = unified.sources
+
+	for key, configValues := range unified.values {
+		var value interface{}
+		isSet, isConflict := false, false
+		for _, source := range unified.sources {
+			configValue, ok := configValues[source]
+			if !ok {
+				continue
+			}
+			if !isSet {
+				value, isSet = configValue, true
+				continue
+			}
+			if !reflect.DeepEqual(value, configValue) {
+				isConflict = true
+			}
+		}
+
+		switch key {
+		case aspectConflictName:
+			result.Aspect, _ = value.(string)
+		case nameConflictName:
+			result.Name, _ = value.(string)
+		default:
+			result.Attributes[key] = value
+		}
+		if isConflict {
+			if result.Conflicts == nil {
+				result.Conflicts = make(map[string]map[string]interface{})
+			}
+			result.Conflicts[key] = configValues
+		}
+	}
+	return result
+}
+
+// BuildUnifiedResponse merges the annotations of the configurations with the same span and a shared CUI,
+// their concepts, codes and TTYs are united and the contributing configurations are kept in the sources
+func BuildUnifiedResponse(responses map[string]types.DefaultClinicalResponse, params UnifiedParams) types.UnifiedResponse {
+	var response types.UnifiedResponse
+	var sections []*unifiedSection
+	spanSections := make(map[[2]int32][]*unifiedSection)
+
+	for _, name := range params.getOrder(responses) {
+		configResponse := responses[name]
+		if len(response.DocId) == 0 {
+			response.BaseResponse = configResponse.BaseResponse
+		}
+
+		for _, section := range configResponse.Content {
+			begin, end := output.GetSpan(section)
+			span := [2]int32{begin, end}
+
+			var target *unifiedSection
+			for _, unified := range spanSections[span] {
+				if unified.isSameAnnotation(section) {
+					target = unified
+					break
+				}
+			}
+			if target == nil {
+				target = &unifiedSection{}
+				sections = append(sections, target)
+				spanSections[span] = append(spanSections[span], target)
+			}
+			target.add(name, section)
+		}
+	}
+
+	response.Content = make([]types.UnifiedContentSection, len(sections))
+	for i, unified := range sections {
+		response.Content[i] = unified.reconcile()
+	}
+	sort.SliceStable(response.Content, func(a, b int) bool {
+		beginA, endA := output.GetSpan(response.Content[a].ContentSection)
+		beginB, endB := output.GetSpan(response.Content[b].ContentSection)
+		if beginA != beginB {
+			return beginA < beginB
+		}
+		return endA < endB
+	})
+	for i := range response.Content {
+		response.Content[i].Id = i
+	}
+	return response
+}
@@ -0,0 +1,74 @@
+package pipeline
+
+import (
+	"text2phenotype.com/fdl/types"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func makeContentSection(text string, begin int32, polarity string, concepts ...types.UmlsConcept) types.ContentSection {
+	return types.ContentSection{
+		Text:         []interface{}{text, begin, begin + int32(len(text))},
+		Attributes:   map[string]interface{}{PolarityParamName: polarity},
+		Aspect:       "diagnosis",
+		Name:         "DiseaseDisorderMention",
+		UmlsConcepts: concepts,
+	}
+}
+
+func makeUmlsConcept(cui string, scheme string, code string, tty string) types.UmlsConcept {
+	return types.UmlsConcept{
+		Tui: []string{"T047"},
+		Cui: cui,
+		SabConcepts: []types.SabConcept{{
+			CodingScheme:  scheme,
+			VocabConcepts: []types.VocabConcept{{Tty: []string{tty}, Code: code}},
+		}},
+	}
+}
+
+func TestBuildUnifiedResponse(t *testing.T) {
+	params := UnifiedParams{Enabled: true, Priority: []string{"snomedct"}}
+	require.Error(t, params.Validate([]types.Configuration{{Name: "icd10"}}))
+	require.Error(t, params.Validate([]types.Configuration{{Name: "snomedct"}, {Name: UnifiedResultName}}))
+	require.NoError(t, params.Validate([]types.Configuration{{Name: "snomedct"}, {Name: "icd10"}}))
+
+	responses := map[string]types.DefaultClinicalResponse{
+		"icd10": {Content: []types.ContentSection{
+			makeContentSection("asthma", 10, "negative", makeUmlsConcept("C0004096", "ICD10CM", "J45", "PT")),
+			makeContentSection("cough", 0, "positive", makeUmlsConcept("C0010200", "ICD10CM", "R05", "PT")),
+		}},
+		"snomedct": {Content: []types.ContentSection{
+			makeContentSection("asthma", 10, "positive", makeUmlsConcept("C0004096", "SNOMEDCT_US", "195967001", "PT")),
+			makeContentSection("cough", 0, "positive",
+				makeUmlsConcept("C0010200", "SNOMEDCT_US", "49727002", "PT"),
+				makeUmlsConcept("C0010200", "SNOMEDCT_US", "49727002", "SY")),
+			// the same span without shared CUIs is a separate annotation
+			makeContentSection("asthma", 10, "positive", makeUmlsConcept("C0038218", "SNOMEDCT_US", "0000", "PT")),
+		}},
+	}
+	response := BuildUnifiedResponse(responses, params)
+	require.Len(t, response.Content, 3)
+
+	cough := response.Content[0]
+	require.Equal(t, 0, cough.Id)
+	require.Equal(t, []string{"snomedct", "icd10"}, cough.Sources)
+	require.Empty(t, cough.Conflicts)
+	require.Len(t, cough.UmlsConcepts, 1)
+	require.Equal(t, []types.SabConcept{
+		{CodingScheme: "SNOMEDCT_US", VocabConcepts: []types.VocabConcept{{Tty: []string{"PT", "SY"}, Code: "49727002"}}},
+		{CodingScheme: "ICD10CM", VocabConcepts: []types.VocabConcept{{Tty: []string{"PT"}, Code: "R05"}}},
+	}, cough.UmlsConcepts[0].SabConcepts)
+	require.Equal(t, []string{"snomedct", "icd10"}, cough.UmlsConcepts[0].Sources)
+
+	// snomedct has the priority, the polarity conflict is kept
+	asthma := response.Content[1]
+	require.Equal(t, "C0004096", asthma.UmlsConcepts[0].Cui)
+	require.Equal(t, "positive", asthma.Attributes[PolarityParamName])
+	require.Equal(t, map[string]interface{}{"snomedct": "positive", "icd10": "negative"}, asthma.Conflicts[PolarityParamName])
+	require.Equal(t, []string{"snomedct"}, response.Content[2].Sources)
+
+	// the source responses are not changed
+	require.Len(t, responses["snomedct"].Content[1].UmlsConcepts[0].SabConcepts[0].VocabConcepts[0].Tty, 1)
+	require.Empty(t, responses["icd10"].Content[0].UmlsConcepts[0].Sources)
+}
@@ -1,6 +1,7 @@
 package s3client
 
 import (
+	"bytes"
 	"text2phenotype.com/fdl/logger"
 	"errors"
 	"fmt"
@@ -67,6 +68,26 @@ func (client Client) Upload(data string, key string) (*s3manager.UploadOutput, e
 		Key:    &key,
 		Body:   file,
 	}
+	return client.uploadWithRefresh(params)
+}
+
+// UploadObject uploads the encoded file with its Content-Encoding header and metadata
+func (client Client) UploadObject(object Object, key string) (*s3manager.UploadOutput, error) {
+	params := &s3manager.UploadInput{
+		Bucket: &client.bucketName,
+		Key:    &key,
+		Body:   bytes.NewReader(object.Body),
+	}
+	if len(object.ContentEncoding) > 0 {
+		params.ContentEncoding = aws.String(object.ContentEncoding)
+	}
+	if len(object.Metadata) > 0 {
+		params.Metadata = aws.StringMap(object.Metadata)
+	}
+	return client.uploadWithRefresh(params)
+}
+
+func (client Client) uploadWithRefresh(params *s3manager.UploadInput) (*s3manager.UploadOutput, error) {
 	sess, err := client.session()
 	if err != nil {
 		return nil, err
@@ -257,7 +278,7 @@ func (client *Client) acquireNewSession() error {
 
 type EnvironmentConfig struct {
 	BucketName  string `envconfig:"MDL_COMN_STORAGE_CONTAINER_NAME" required:"true"`
-	T2PEnv    string `envconfig:"T2P_ENV" required:"true"`
+	T2PEnv      string `envconfig:"T2P_ENV" required:"true"`
 	Region      string `envconfig:"MDL_COMN_AWS_REGION_NAME" required:"true"`
 	AwsEndpoint string `envconfig:"MDL_COMN_AWS_ENDPOINT_URL" default:""`
 	AccessKeyID string `envconfig:"MDL_COMN_AWS_ACCESS_ID" default:""`
@@ -286,5 +307,5 @@ func getLogger(fdlLogger zerolog.Logger) *s3Logger {
 
 func (logger *s3Logger) Log(v ...interface{}) {
 	//nolint
-	logger.fdlLogger.Debug().Msg(fmt.Sprint(v))
+	logger.fdlLogger.Debug().Msg(fmt.Sprint(v...))
 }
@@ -0,0 +1,91 @@
+package s3client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+)
+
+// content encodings of the uploaded files, the identity encoding uploads the data as is
+const (
+	EncodingIdentity = "identity"
+	EncodingGzip     = "gzip"
+	EncodingZstd     = "zstd"
+)
+
+// magic numbers of the compressed data, used to recognize the encoding of the downloaded files
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ValidateEncoding returns an error if the content encoding isn't supported
+func ValidateEncoding(encoding string) error {
+	switch encoding {
+	case EncodingIdentity, EncodingGzip, EncodingZstd:
+		return nil
+	}
+	return fmt.Errorf("unknown content encoding %q (allowed: %s, %s, %s)", encoding, EncodingIdentity, EncodingGzip, EncodingZstd)
+}
+
+// Encode compresses the data with the content encoding
+func Encode(data []byte, encoding string) ([]byte, error) {
+	var buf bytes.Buffer
+	var writer io.WriteCloser
+	switch encoding {
+	case EncodingIdentity:
+		return data, nil
+	case EncodingGzip:
+		writer = gzip.NewWriter(&buf)
+	case EncodingZstd:
+		zstdWriter, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return nil, err
+		}
+		writer = zstdWriter
+	default:
+		return nil, ValidateEncoding(encoding)
+	}
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GetEncoding recognizes the content encoding of the data by its magic number
+func GetEncoding(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		return EncodingGzip
+	case bytes.HasPrefix(data, zstdMagic):
+		return EncodingZstd
+	}
+	return EncodingIdentity
+}
+
+// Decode decompresses gzip and zstd data, other data is returned as is
+func Decode(data []byte) ([]byte, error) {
+	switch GetEncoding(data) {
+	case EncodingGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	case EncodingZstd:
+		reader, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	}
+	return data, nil
+}
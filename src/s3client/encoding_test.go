@@ -0,0 +1,24 @@
+package s3client
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	data := []byte(`{"snomedct": {"content": [{"text": ["aspirin", 10, 17]}]}}`)
+	for _, encoding := range []string{EncodingIdentity, EncodingGzip, EncodingZstd} {
+		encoded, err := Encode(data, encoding)
+		require.NoError(t, err)
+		require.Equal(t, encoding, GetEncoding(encoded))
+
+		decoded, err := Decode(encoded)
+		require.NoError(t, err)
+		require.Equal(t, data, decoded)
+	}
+
+	_, err := Encode(data, "br")
+	require.Error(t, err)
+	require.Error(t, ValidateEncoding("br"))
+	require.NoError(t, ValidateEncoding(EncodingZstd))
+}
@@ -0,0 +1,199 @@
+package s3client
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// MetadataKeyID is the object metadata with the id of the key-encryption key of the encrypted files
+const MetadataKeyID = "Fdl-Key-Id"
+
+// MetadataEncoding is the object metadata with the content encoding of the encrypted files, Content-Encoding isn't
+// set for them since the body isn't readable by HTTP clients
+const MetadataEncoding = "Fdl-Content-Encoding"
+
+// envelopeMagic starts the encrypted files, followed by the version and the length-prefixed key id and wrapped
+// data key, the nonce and the ciphertext of the data. The header is the additional data of the ciphertext.
+var envelopeMagic = []byte("FDLE")
+
+const (
+	envelopeVersion = 1
+	// AES-256 keys
+	keySize = 32
+)
+
+// Encryptor encrypts the files with AES-GCM using a random data key per file, the data key is wrapped by
+// the key-encryption key and stored in the file
+type Encryptor struct {
+	keyID string
+	kek   cipher.AEAD
+}
+
+// NewEncryptor creates the encryptor of the 32 bytes key-encryption key, the key id is the SHA-256 prefix
+// of the key if it's empty
+func NewEncryptor(keyID string, key []byte) (*Encryptor, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("key-encryption key must have %d bytes, got %d", keySize, len(key))
+	}
+	if len(keyID) == 0 {
+		hash := sha256.Sum256(key)
+		keyID = hex.EncodeToString(hash[:8])
+	}
+	kek, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Encryptor{keyID: keyID, kek: kek}, nil
+}
+
+// LoadEncryptor creates the encryptor of the base64 encoded key which is set directly or read from the key file,
+// it returns nil if neither is set
+func LoadEncryptor(keyID string, key string, keyFile string) (*Encryptor, error) {
+	if len(key) > 0 && len(keyFile) > 0 {
+		return nil, errors.New("either the encryption key or the encryption key file must be set, not both")
+	}
+	if len(keyFile) > 0 {
+		content, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read encryption key file: %w", err)
+		}
+		key = string(content)
+	}
+	if len(key) == 0 {
+		return nil, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil {
+		return nil, fmt.Errorf("encryption key is not base64 encoded: %w", err)
+	}
+	return NewEncryptor(keyID, decoded)
+}
+
+// KeyID returns the id of the key-encryption key
+func (encryptor *Encryptor) KeyID() string {
+	return encryptor.keyID
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func newNonce(aead cipher.AEAD) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
+
+func writeChunk(buf *bytes.Buffer, chunk []byte) {
+	_ = binary.Write(buf, binary.BigEndian, uint16(len(chunk)))
+	buf.Write(chunk)
+}
+
+func readChunk(reader *bytes.Reader) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	chunk := make([]byte, length)
+	if _, err := io.ReadFull(reader, chunk); err != nil {
+		return nil, err
+	}
+	return chunk, nil
+}
+
+// Encrypt encrypts the data with a new data key and returns the envelope
+func (encryptor *Encryptor) Encrypt(data []byte) ([]byte, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	keyNonce, err := newNonce(encryptor.kek)
+	if err != nil {
+		return nil, err
+	}
+	wrappedKey := encryptor.kek.Seal(keyNonce, keyNonce, dataKey, []byte(encryptor.keyID))
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := newNonce(aead)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.Write(envelopeMagic)
+	buf.WriteByte(envelopeVersion)
+	writeChunk(&buf, []byte(encryptor.keyID))
+	writeChunk(&buf, wrappedKey)
+	buf.Write(nonce)
+	header := buf.Bytes()
+	return aead.Seal(header, nonce, data, header), nil
+}
+
+// IsEncrypted returns true if the data is the envelope of the encrypted file
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, envelopeMagic)
+}
+
+// Decrypt returns the data of the envelope, it fails if the file is encrypted by another key
+func (encryptor *Encryptor) Decrypt(envelope []byte) ([]byte, error) {
+	if !IsEncrypted(envelope) {
+		return nil, errors.New("data is not encrypted")
+	}
+	reader := bytes.NewReader(envelope[len(envelopeMagic):])
+	if version, err := reader.ReadByte(); err != nil || version != envelopeVersion {
+		return nil, fmt.Errorf("unsupported envelope version %d", version)
+	}
+	keyID, err := readChunk(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key id of envelope: %w", err)
+	}
+	if string(keyID) != encryptor.keyID {
+		return nil, fmt.Errorf("data is encrypted by key %q, configured key is %q", keyID, encryptor.keyID)
+	}
+	wrappedKey, err := readChunk(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data key of envelope: %w", err)
+	}
+	nonceSize := encryptor.kek.NonceSize()
+	if len(wrappedKey) < nonceSize {
+		return nil, errors.New("data key of envelope is truncated")
+	}
+	dataKey, err := encryptor.kek.Open(nil, wrappedKey[:nonceSize], wrappedKey[nonceSize:], keyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	headerSize := len(envelope) - reader.Len()
+	if reader.Len() < aead.NonceSize() {
+		return nil, errors.New("nonce of envelope is truncated")
+	}
+	header := envelope[:headerSize+aead.NonceSize()]
+	data, err := aead.Open(nil, header[headerSize:], envelope[len(header):], header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data: %w", err)
+	}
+	return data, nil
+}
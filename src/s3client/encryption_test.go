@@ -0,0 +1,72 @@
+package s3client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, keySize)
+	encryptor, err := NewEncryptor("", key)
+	require.NoError(t, err)
+	require.Len(t, encryptor.KeyID(), 16)
+
+	data := []byte("Patient denies chest pain, takes aspirin 81 mg daily.")
+	envelope, err := encryptor.Encrypt(data)
+	require.NoError(t, err)
+	require.True(t, IsEncrypted(envelope))
+	require.False(t, bytes.Contains(envelope, []byte("aspirin")))
+
+	decrypted, err := encryptor.Decrypt(envelope)
+	require.NoError(t, err)
+	require.Equal(t, data, decrypted)
+
+	// every file has its own data key and nonce
+	other, err := encryptor.Encrypt(data)
+	require.NoError(t, err)
+	require.NotEqual(t, envelope, other)
+
+	tampered := append([]byte{}, envelope...)
+	tampered[len(tampered)-1] ^= 1
+	_, err = encryptor.Decrypt(tampered)
+	require.Error(t, err)
+
+	rotated, err := NewEncryptor("rotated", bytes.Repeat([]byte{8}, keySize))
+	require.NoError(t, err)
+	_, err = rotated.Decrypt(envelope)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), encryptor.KeyID())
+
+	_, err = encryptor.Decrypt(data)
+	require.Error(t, err)
+	_, err = encryptor.Decrypt(envelope[:len(envelopeMagic)+3])
+	require.Error(t, err)
+}
+
+func TestLoadEncryptor(t *testing.T) {
+	encryptor, err := LoadEncryptor("", "", "")
+	require.NoError(t, err)
+	require.Nil(t, encryptor)
+
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, keySize))
+	encryptor, err = LoadEncryptor("kek-1", key, "")
+	require.NoError(t, err)
+	require.Equal(t, "kek-1", encryptor.KeyID())
+
+	keyFile := filepath.Join(t.TempDir(), "kek")
+	require.NoError(t, os.WriteFile(keyFile, []byte(key+"\n"), 0600))
+	encryptor, err = LoadEncryptor("kek-1", "", keyFile)
+	require.NoError(t, err)
+	require.Equal(t, "kek-1", encryptor.KeyID())
+
+	_, err = LoadEncryptor("", key, keyFile)
+	require.Error(t, err)
+	_, err = LoadEncryptor("", base64.StdEncoding.EncodeToString([]byte("short")), "")
+	require.Error(t, err)
+	_, err = LoadEncryptor("", "not base64!", "")
+	require.Error(t, err)
+}
@@ -0,0 +1,51 @@
+package s3client
+
+import (
+	"fmt"
+)
+
+// Object is the encoded file with its upload headers
+type Object struct {
+	Body []byte
+	// Content-Encoding header, empty if the body isn't readable by HTTP clients as it is
+	ContentEncoding string
+	Metadata        map[string]string
+}
+
+// EncodeObject compresses the data with the content encoding and encrypts it if the encryptor isn't nil,
+// the key id and the encoding of the encrypted files are the object metadata instead of the Content-Encoding header
+func EncodeObject(data []byte, encoding string, encryptor *Encryptor) (Object, error) {
+	body, err := Encode(data, encoding)
+	if err != nil {
+		return Object{}, err
+	}
+	if encryptor != nil {
+		if body, err = encryptor.Encrypt(body); err != nil {
+			return Object{}, err
+		}
+		return Object{
+			Body:     body,
+			Metadata: map[string]string{MetadataKeyID: encryptor.KeyID(), MetadataEncoding: encoding},
+		}, nil
+	}
+	object := Object{Body: body}
+	if encoding != EncodingIdentity {
+		object.ContentEncoding = encoding
+	}
+	return object, nil
+}
+
+// DecodeObject decrypts the downloaded file if it's encrypted and decompresses it if it's gzip or zstd compressed.
+// Encrypted files fail without the encryptor, plain files are accepted with it.
+func DecodeObject(body []byte, encryptor *Encryptor) ([]byte, error) {
+	var err error
+	if IsEncrypted(body) {
+		if encryptor == nil {
+			return nil, fmt.Errorf("file is encrypted and no encryption key is configured")
+		}
+		if body, err = encryptor.Decrypt(body); err != nil {
+			return nil, fmt.Errorf("failed to decrypt file: %w", err)
+		}
+	}
+	return Decode(body)
+}
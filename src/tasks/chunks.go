@@ -40,7 +40,11 @@ type ChunkTaskStatuses struct {
 }
 
 type ChunkTaskInfo struct {
-	ResultsFileKey    string     `json:"results_file_key"`
+	ResultsFileKey string `json:"results_file_key"`
+	// content encoding of the results file (gzip, zstd or identity), empty for the files saved before compression
+	ResultsFileEncoding string `json:"results_file_encoding,omitempty"`
+	// id of the key-encryption key of the encrypted results file, empty for the plain files
+	ResultsFileKeyID  string     `json:"results_file_key_id,omitempty"`
 	StartedAt         *string    `json:"started_at"`
 	CompletedAt       *string    `json:"completed_at"`
 	Attempts          int        `json:"attempts"`
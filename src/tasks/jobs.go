@@ -11,6 +11,10 @@ type JobTask struct {
 	maps.BaseDocument
 	UserCanceled           bool `json:"user_canceled"`
 	StopDocumentsOnFailure bool `json:"stop_documents_on_failure"`
+	// output format of the FDL results, JSON if empty
+	OutputFormat string `json:"output_format,omitempty"`
+	// version of the JSON results, version 1 if empty
+	ResponseVersion string `json:"response_version,omitempty"`
 }
 
 type JobTasks struct {
@@ -2,8 +2,10 @@ package types
 
 type Annotation struct {
 	Span
-	Semantic   Semantic
-	Concepts   []*Concept
+	Semantic Semantic
+	Concepts []*Concept
+	// disambiguation scores of the concepts, is set only when the concepts are ranked
+	Scores     []float64
 	Sentence   *Sentence
 	Attributes map[string]interface{}
 }
@@ -24,14 +24,39 @@ const (
 	LabAttributes      = "lab"
 	DrugAttributes     = "drug"
 	PolarityAttributes = "polarity"
+
+	// dictionary case sensitivity
+	CaseInsensitive   = "insensitive"
+	CaseShortAcronyms = "short_acronyms"
+	CaseExact         = "exact"
+
+	// dictionary match modes
+	MatchModeContiguous = "contiguous"
+	MatchModeOverlap    = "overlap"
+
+	// dictionary term tokenizers
+	TermTokenizerRegex = "regex"
+	TermTokenizerPTB   = "ptb"
+
+	// dictionary lookup engines
+	LookupEngineRareWord = "rare_word"
+	LookupEngineTrie     = "trie"
+
+	// overlap resolution strategies
+	OverlapResolutionAll                 = "all"
+	OverlapResolutionLongest             = "longest"
+	OverlapResolutionLongestAcrossGroups = "longest_across_groups"
+	OverlapResolutionLeftmostLongest     = "leftmost_longest"
+	OverlapResolutionPreferSemantic      = "prefer_semantic"
 )
 
 type RequestParams struct {
-	LookupMode string `yaml:"lookup_mode" json:"lookup_mode"`
+	LookupMode        string `yaml:"lookup_mode" json:"lookup_mode"`
+	OverlapResolution string `yaml:"overlap_resolution" json:"overlap_resolution"`
 }
 
 func (rParams RequestParams) IsEmpty() bool {
-	return len(rParams.LookupMode) == 0
+	return len(rParams.LookupMode) == 0 && len(rParams.OverlapResolution) == 0
 }
 
 func (rParams RequestParams) GetHashCode() uint64 {
@@ -42,13 +67,32 @@ func (rParams RequestParams) GetHashCode() uint64 {
 }
 
 type FDLConfig struct {
-	TermDictionary       string   `yaml:"term_dictionary" json:"term_dictionary"`
-	TermScheme           string   `yaml:"term_scheme" json:"term_scheme"`
-	ConceptDictionary    string   `yaml:"concept_dictionary" json:"concept_dictionary"`
-	ConceptScheme        string   `yaml:"concept_scheme" json:"concept_scheme"`
-	ConceptIgnoredParams []string `yaml:"concept_params_ignore" json:"concept_ignored_params"`
-	ExclusionTags        []string `yaml:"exclusion_tags" json:"exclusion_tags"`
-	PrecisionMode        bool     `yaml:"precision_mode" json:"precision_mode"`
+	TermDictionary         string   `yaml:"term_dictionary" json:"term_dictionary"`
+	TermScheme             string   `yaml:"term_scheme" json:"term_scheme"`
+	ConceptDictionary      string   `yaml:"concept_dictionary" json:"concept_dictionary"`
+	ConceptScheme          string   `yaml:"concept_scheme" json:"concept_scheme"`
+	ConceptIgnoredParams   []string `yaml:"concept_params_ignore" json:"concept_ignored_params"`
+	ExclusionTags          []string `yaml:"exclusion_tags" json:"exclusion_tags"`
+	PrecisionMode          bool     `yaml:"precision_mode" json:"precision_mode"`
+	OverlapResolution      string   `yaml:"overlap_resolution" json:"overlap_resolution"`
+	Blocklist              string   `yaml:"blocklist" json:"blocklist"`
+	Allowlist              string   `yaml:"allowlist" json:"allowlist"`
+	CaseSensitivity        string   `yaml:"case_sensitivity" json:"case_sensitivity"`
+	CaseSensitiveMaxLength int      `yaml:"case_sensitive_max_length" json:"case_sensitive_max_length"`
+	FuzzyMaxDistance       int      `yaml:"fuzzy_max_distance" json:"fuzzy_max_distance"`
+	FuzzyMinLength         int      `yaml:"fuzzy_min_length" json:"fuzzy_min_length"`
+	MatchMode              string   `yaml:"match_mode" json:"match_mode"`
+	// nil if not set, 0 means the overlap matched tokens are adjacent
+	MaxSkippedTokens     *int   `yaml:"max_skipped_tokens" json:"max_skipped_tokens,omitempty"`
+	UserDictionary       string `yaml:"user_dictionary" json:"user_dictionary"`
+	UserDictionaryReload int    `yaml:"user_dictionary_reload" json:"user_dictionary_reload"`
+	TermTokenizer        string `yaml:"term_tokenizer" json:"term_tokenizer"`
+	LookupEngine         string `yaml:"lookup_engine" json:"lookup_engine"`
+	ExpandAbbreviations  bool   `yaml:"expand_abbreviations" json:"expand_abbreviations"`
+
+	Disambiguation        bool               `yaml:"disambiguation" json:"disambiguation"`
+	DisambiguationKeepTop bool               `yaml:"disambiguation_keep_top" json:"disambiguation_keep_top"`
+	DisambiguationPriors  map[string]float64 `yaml:"disambiguation_priors" json:"disambiguation_priors"`
 }
 
 type ParamsConfig struct {
@@ -24,6 +24,11 @@ type UmlsConcept struct {
 	Cui           string       `json:"cui"`
 	PreferredText string       `json:"preferredText"`
 	SabConcepts   []SabConcept `json:"sabConcepts"`
+	// rank (starting from 1) and score of the concept among the concepts of the annotation, set by the disambiguation
+	Rank  int      `json:"rank,omitempty"`
+	Score *float64 `json:"score,omitempty"`
+	// configurations which found the concept, set only in the unified response
+	Sources []string `json:"sources,omitempty"`
 }
 
 type SabConcept struct {
@@ -41,6 +46,19 @@ type DefaultClinicalResponse struct {
 	Content []ContentSection `json:"content"`
 }
 
+// UnifiedContentSection is the annotation merged across the configurations, Sources lists the configurations
+// which found it and Conflicts keeps the value of every configuration for the attributes they disagree on
+type UnifiedContentSection struct {
+	ContentSection
+	Sources   []string                          `json:"sources"`
+	Conflicts map[string]map[string]interface{} `json:"conflicts,omitempty"`
+}
+
+type UnifiedResponse struct {
+	BaseResponse
+	Content []UnifiedContentSection `json:"content"`
+}
+
 type SmokingStatusSection struct {
 	Status string
 	Text   []interface{}
@@ -0,0 +1,121 @@
+package types
+
+// versions of the JSON response, version 1 with untyped attributes and spans is the default
+const (
+	ResponseVersion1 = "1"
+	ResponseVersion2 = "2"
+)
+
+// kinds of the configuration results of the response v2
+const (
+	ResultTypeDefaultClinical = "default_clinical"
+	ResultTypeSmokingStatus   = "smoking_status"
+	ResultTypeUnified         = "unified"
+)
+
+// ResponseV2 is the typed response with the results of the configurations by configuration name
+type ResponseV2 struct {
+	Version string                    `json:"version"`
+	DocId   string                    `json:"docId"`
+	Dob     string                    `json:"dob"`
+	Gender  string                    `json:"gender"`
+	Age     string                    `json:"age"`
+	Results map[string]ConfigResultV2 `json:"results"`
+}
+
+// ConfigResultV2 has the annotations of the default clinical and unified results or the smoking status
+type ConfigResultV2 struct {
+	Type          string           `json:"type"`
+	Annotations   []AnnotationV2   `json:"annotations,omitempty"`
+	SmokingStatus *SmokingStatusV2 `json:"smokingStatus,omitempty"`
+}
+
+// SpanV2 is the text with its offsets in the document
+type SpanV2 struct {
+	Text  string `json:"text"`
+	Begin int32  `json:"begin"`
+	End   int32  `json:"end"`
+}
+
+type OffsetsV2 struct {
+	Begin int32 `json:"begin"`
+	End   int32 `json:"end"`
+}
+
+type SectionV2 struct {
+	Oid   string `json:"oid"`
+	Begin int32  `json:"begin"`
+	End   int32  `json:"end"`
+}
+
+type AnnotationV2 struct {
+	Id         int          `json:"id"`
+	Span       SpanV2       `json:"span"`
+	Sentence   *OffsetsV2   `json:"sentence,omitempty"`
+	Section    *SectionV2   `json:"section,omitempty"`
+	Semantic   string       `json:"semantic"`
+	Name       string       `json:"name"`
+	Attributes AttributesV2 `json:"attributes"`
+	Concepts   []ConceptV2  `json:"concepts"`
+	// configurations which found the annotation and their values of the disagreeing attributes (v1 attribute names),
+	// set only in the unified result
+	Sources   []string                          `json:"sources,omitempty"`
+	Conflicts map[string]map[string]interface{} `json:"conflicts,omitempty"`
+}
+
+// AttributesV2 groups the attributes of the annotators, the attributes without a typed field are kept in Other
+// by their v1 names
+type AttributesV2 struct {
+	Assertion *AssertionV2           `json:"assertion,omitempty"`
+	Drug      *DrugAttributesV2      `json:"drug,omitempty"`
+	Lab       *LabAttributesV2       `json:"lab,omitempty"`
+	Other     map[string]interface{} `json:"other,omitempty"`
+}
+
+type AssertionV2 struct {
+	// positive or negative
+	Polarity string `json:"polarity,omitempty"`
+}
+
+type DrugAttributesV2 struct {
+	Dosage          string  `json:"dosage,omitempty"`
+	Form            string  `json:"form,omitempty"`
+	Route           string  `json:"route,omitempty"`
+	Duration        string  `json:"duration,omitempty"`
+	StatusChange    string  `json:"statusChange,omitempty"`
+	StrengthNumber  *SpanV2 `json:"strengthNumber,omitempty"`
+	StrengthUnit    *SpanV2 `json:"strengthUnit,omitempty"`
+	FrequencyNumber *SpanV2 `json:"frequencyNumber,omitempty"`
+	FrequencyUnit   *SpanV2 `json:"frequencyUnit,omitempty"`
+}
+
+type LabAttributesV2 struct {
+	Value *SpanV2 `json:"value,omitempty"`
+	Unit  *SpanV2 `json:"unit,omitempty"`
+}
+
+type ConceptV2 struct {
+	Cui           string   `json:"cui"`
+	PreferredText string   `json:"preferredText"`
+	Tuis          []string `json:"tuis"`
+	Codes         []CodeV2 `json:"codes"`
+	Rank          int      `json:"rank,omitempty"`
+	Score         *float64 `json:"score,omitempty"`
+	Sources       []string `json:"sources,omitempty"`
+}
+
+type CodeV2 struct {
+	CodingScheme string   `json:"codingScheme"`
+	Code         string   `json:"code"`
+	Ttys         []string `json:"ttys"`
+}
+
+type SmokingStatusV2 struct {
+	Status    string              `json:"status"`
+	Sentences []SmokingSentenceV2 `json:"sentences"`
+}
+
+type SmokingSentenceV2 struct {
+	Status string `json:"status"`
+	Span   SpanV2 `json:"span"`
+}
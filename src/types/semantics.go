@@ -1,5 +1,7 @@
 package types
 
+import "strings"
+
 type Semantic byte
 
 func (s Semantic) Name() string {
@@ -38,3 +40,18 @@ const (
 	SemanticPhenomena      Semantic = 10
 	SemanticActivity       Semantic = 11
 )
+
+var semanticGroups = []Semantic{
+	SemanticDrug, SemanticDisorder, SemanticFinding, SemanticProcedure, SemanticAnatomicalSite,
+	SemanticDevice, SemanticLab, SemanticPhenomena, SemanticActivity,
+}
+
+// ParseSemantic returns the semantic group by its name (drug, prob, symp...), the case is ignored
+func ParseSemantic(name string) (Semantic, bool) {
+	for _, semantic := range semanticGroups {
+		if strings.EqualFold(semantic.Name(), name) {
+			return semantic, true
+		}
+	}
+	return SemanticUnknown, false
+}
@@ -16,6 +16,26 @@ type Token struct {
 	IsNumber  bool
 	IsNewline bool
 	Shape     string
+	// long form of the abbreviation which starts with the token
+	Expansion *Expansion
+}
+
+const (
+	// the abbreviation is defined in the document as "long form (SF)"
+	ExpansionSourceDocument = "document"
+	// the abbreviation is found in the abbreviation list
+	ExpansionSourceList = "list"
+)
+
+// Expansion is the long form of the abbreviation
+type Expansion struct {
+	Abbreviation string
+	Text         string
+	// lower case tokens of the long form
+	Tokens []*string
+	// count of the abbreviation tokens, "c/o" has 3 tokens
+	Length int
+	Source string
 }
 
 func (token *Token) GetSpan() *Span {
@@ -55,6 +75,7 @@ func (token Token) Clone() Token {
 		IsNumber:  token.IsNumber,
 		IsNewline: token.IsNewline,
 		Shape:     token.Shape,
+		Expansion: token.Expansion,
 	}
 }
 
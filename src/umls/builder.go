@@ -0,0 +1,373 @@
+package umls
+
+import (
+	"bufio"
+	"text2phenotype.com/fdl/logger"
+	"text2phenotype.com/fdl/types"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DictionaryScheme is the column scheme of the built term and concept dictionaries
+var DictionaryScheme = []string{types.CUI, types.TUI, types.TTY, types.CODE, types.SAB, types.STR, types.PREF}
+
+const (
+	DefaultLanguage = "ENG"
+	// not suppressible
+	DefaultSuppress = "N"
+
+	conceptsSuffix = "_concepts"
+	dictionaryExt  = ".bsv"
+)
+
+type BuildParams struct {
+	// directory with MRCONSO.RRF, MRSTY.RRF and MRSAT.RRF
+	MetaDir string
+	// directory and base name of the dictionary files
+	OutDir string
+	Name   string
+
+	// filters, empty SABs and TTYs keep all sources and term types
+	SABs      []string
+	TTYs      []string
+	Languages []string
+	// allowed values of the MRCONSO SUPPRESS column
+	Suppress []string
+	// MRSAT attribute filters in ATN or ATN=ATV form, atom is kept if its code has at least one of the attributes
+	Attributes []string
+}
+
+type BuildResult struct {
+	TermPath    string
+	ConceptPath string
+	Atoms       int
+	Terms       int
+	// unique CUIs of the concept dictionary
+	Concepts int
+	// atoms without semantic type in MRSTY.RRF
+	SkippedAtoms int
+}
+
+type atom struct {
+	cui  string
+	tty  string
+	code string
+	sab  string
+	str  string
+}
+
+type rrfFilter struct {
+	sabs       map[string]bool
+	ttys       map[string]bool
+	languages  map[string]bool
+	suppress   map[string]bool
+	attributes map[string]bool
+}
+
+func newSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	result := make(map[string]bool, len(values))
+	for _, value := range values {
+		result[strings.ToUpper(strings.TrimSpace(value))] = true
+	}
+	return result
+}
+
+// contains returns true for the empty set, because an empty filter keeps all values
+func contains(set map[string]bool, value string) bool {
+	return set == nil || set[value]
+}
+
+func getCodeKey(cui string, sab string, code string) string {
+	return cui + "|" + sab + "|" + code
+}
+
+func (params BuildParams) validate() error {
+	if len(params.MetaDir) == 0 {
+		return errors.New("META directory is not set")
+	}
+	if len(params.OutDir) == 0 {
+		return errors.New("output directory is not set")
+	}
+	if len(params.Name) == 0 || strings.ContainsAny(params.Name, `/\`) {
+		return fmt.Errorf("dictionary name %q is not correct", params.Name)
+	}
+	return nil
+}
+
+// Build creates the term and concept dictionaries from the UMLS RRF files
+func Build(params BuildParams) (BuildResult, error) {
+	var result BuildResult
+	if err := params.validate(); err != nil {
+		return result, err
+	}
+
+	fdlLogger := logger.NewLogger("UMLS builder").With().Str("meta_dir", params.MetaDir).Logger()
+
+	languages := params.Languages
+	if len(languages) == 0 {
+		languages = []string{DefaultLanguage}
+	}
+	suppress := params.Suppress
+	if len(suppress) == 0 {
+		suppress = []string{DefaultSuppress}
+	}
+	filter := rrfFilter{
+		sabs:      newSet(params.SABs),
+		ttys:      newSet(params.TTYs),
+		languages: newSet(languages),
+		suppress:  newSet(suppress),
+	}
+
+	if len(params.Attributes) > 0 {
+		fdlLogger.Info().Strs("attributes", params.Attributes).Msg("Reading attributes")
+		codes, err := readAttributeCodes(filepath.Join(params.MetaDir, MRSAT), params.Attributes)
+		if err != nil {
+			return result, err
+		}
+		filter.attributes = codes
+	}
+
+	fdlLogger.Info().Msg("Reading atoms")
+	atoms, err := readAtoms(filepath.Join(params.MetaDir, MRCONSO), filter)
+	if err != nil {
+		return result, err
+	}
+	result.Atoms = len(atoms)
+
+	cuis := make(map[string]bool)
+	for _, a := range atoms {
+		cuis[a.cui] = true
+	}
+
+	fdlLogger.Info().Int("concepts", len(cuis)).Msg("Reading preferred names")
+	prefNames, err := readPreferredNames(filepath.Join(params.MetaDir, MRCONSO), cuis, filter)
+	if err != nil {
+		return result, err
+	}
+
+	fdlLogger.Info().Msg("Reading semantic types")
+	semanticTypes, err := readSemanticTypes(filepath.Join(params.MetaDir, MRSTY), cuis)
+	if err != nil {
+		return result, err
+	}
+
+	if err := os.MkdirAll(params.OutDir, 0755); err != nil {
+		return result, err
+	}
+	result.TermPath = filepath.Join(params.OutDir, params.Name+dictionaryExt)
+	result.ConceptPath = filepath.Join(params.OutDir, params.Name+conceptsSuffix+dictionaryExt)
+
+	// stable order makes dictionary refreshes comparable
+	sort.SliceStable(atoms, func(i, j int) bool {
+		return atoms[i].cui < atoms[j].cui
+	})
+
+	termRows := make([]string, 0, len(atoms))
+	conceptRows := make([]string, 0)
+	termKeys := make(map[string]bool)
+	conceptKeys := make(map[string]bool)
+	writtenCUIs := make(map[string]bool)
+	for _, a := range atoms {
+		tuis, ok := semanticTypes[a.cui]
+		if !ok {
+			result.SkippedAtoms++
+			continue
+		}
+		tui := formatTUIs(tuis)
+		pref := prefNames[a.cui]
+		if len(pref) == 0 {
+			pref = a.str
+		}
+
+		termKey := strings.Join([]string{a.cui, a.tty, a.code, a.sab, a.str}, "|")
+		if !termKeys[termKey] {
+			termKeys[termKey] = true
+			termRows = append(termRows, strings.Join([]string{a.cui, tui, a.tty, a.code, a.sab, a.str, pref}, "|"))
+		}
+
+		conceptKey := strings.Join([]string{a.cui, a.tty, a.code, a.sab}, "|")
+		if !conceptKeys[conceptKey] {
+			conceptKeys[conceptKey] = true
+			conceptRows = append(conceptRows, strings.Join([]string{a.cui, tui, a.tty, a.code, a.sab, pref, pref}, "|"))
+			writtenCUIs[a.cui] = true
+		}
+	}
+	result.Terms = len(termRows)
+	result.Concepts = len(writtenCUIs)
+
+	header := fmt.Sprintf("# %s, built from %s", strings.Join(DictionaryScheme, "|"), params.MetaDir)
+	if err := writeBSV(result.TermPath, header, termRows); err != nil {
+		return result, err
+	}
+	if err := writeBSV(result.ConceptPath, header, conceptRows); err != nil {
+		return result, err
+	}
+
+	fdlLogger.Info().
+		Int("atoms", result.Atoms).
+		Int("terms", result.Terms).
+		Int("concepts", result.Concepts).
+		Int("skipped_atoms", result.SkippedAtoms).
+		Msg("Dictionary was built")
+
+	return result, nil
+}
+
+func readAttributeCodes(path string, attributes []string) (map[string]bool, error) {
+	// ATN -> allowed ATV values, nil allows any value
+	filters := make(map[string]map[string]bool)
+	for _, attribute := range attributes {
+		name, value, hasValue := strings.Cut(attribute, "=")
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if len(name) == 0 {
+			return nil, fmt.Errorf("attribute filter %q is not correct", attribute)
+		}
+		values, ok := filters[name]
+		if !hasValue {
+			filters[name] = nil
+			continue
+		}
+		if ok && values == nil {
+			continue
+		}
+		if values == nil {
+			values = make(map[string]bool)
+			filters[name] = values
+		}
+		values[strings.TrimSpace(value)] = true
+	}
+
+	codes := make(map[string]bool)
+	err := readRRF(path, mrsatColumns, func(columns []string) {
+		values, ok := filters[columns[mrsatATN]]
+		if !ok || !contains(values, columns[mrsatATV]) {
+			return
+		}
+		codes[getCodeKey(columns[mrsatCUI], columns[mrsatSAB], columns[mrsatCODE])] = true
+	})
+	return codes, err
+}
+
+func readAtoms(path string, filter rrfFilter) ([]atom, error) {
+	var atoms []atom
+	err := readRRF(path, mrconsoColumns, func(columns []string) {
+		if !contains(filter.languages, columns[mrconsoLAT]) ||
+			!contains(filter.sabs, columns[mrconsoSAB]) ||
+			!contains(filter.ttys, columns[mrconsoTTY]) ||
+			!contains(filter.suppress, columns[mrconsoSUPPRESS]) {
+			return
+		}
+
+		a := atom{
+			cui:  columns[mrconsoCUI],
+			tty:  columns[mrconsoTTY],
+			code: columns[mrconsoCODE],
+			sab:  columns[mrconsoSAB],
+			str:  strings.TrimSpace(columns[mrconsoSTR]),
+		}
+		if len(a.str) == 0 {
+			return
+		}
+		if filter.attributes != nil && !filter.attributes[getCodeKey(a.cui, a.sab, a.code)] {
+			return
+		}
+		atoms = append(atoms, a)
+	})
+	return atoms, err
+}
+
+// readPreferredNames chooses the preferred name of the concepts among all sources of the filtered languages.
+// Metathesaurus preferred atom has TS=P, STT=PF and ISPREF=Y, not suppressible atoms are preferred.
+func readPreferredNames(path string, cuis map[string]bool, filter rrfFilter) (map[string]string, error) {
+	names := make(map[string]string, len(cuis))
+	ranks := make(map[string]int, len(cuis))
+
+	err := readRRF(path, mrconsoColumns, func(columns []string) {
+		cui := columns[mrconsoCUI]
+		if !cuis[cui] || !contains(filter.languages, columns[mrconsoLAT]) {
+			return
+		}
+
+		rank := 0
+		if columns[mrconsoSUPPRESS] == DefaultSuppress {
+			rank += 8
+		}
+		if columns[mrconsoTS] == "P" {
+			rank += 4
+		}
+		if columns[mrconsoSTT] == "PF" {
+			rank += 2
+		}
+		if columns[mrconsoISPREF] == "Y" {
+			rank++
+		}
+
+		if current, ok := ranks[cui]; !ok || rank > current {
+			ranks[cui] = rank
+			names[cui] = strings.TrimSpace(columns[mrconsoSTR])
+		}
+	})
+	return names, err
+}
+
+func readSemanticTypes(path string, cuis map[string]bool) (map[string][]string, error) {
+	result := make(map[string][]string, len(cuis))
+	err := readRRF(path, mrstyColumns, func(columns []string) {
+		cui := columns[mrstyCUI]
+		if !cuis[cui] {
+			return
+		}
+		tui := columns[mrstyTUI]
+		for _, existing := range result[cui] {
+			if existing == tui {
+				return
+			}
+		}
+		result[cui] = append(result[cui], tui)
+	})
+	return result, err
+}
+
+// formatTUIs formats TUIs the way concept factory parses them
+func formatTUIs(tuis []string) string {
+	if len(tuis) == 1 {
+		return tuis[0]
+	}
+	return "[" + strings.Join(tuis, ",") + "]"
+}
+
+func writeBSV(path string, header string, rows []string) error {
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(f)
+	_, err = writer.WriteString(header + "\n")
+	for _, row := range rows {
+		if err != nil {
+			break
+		}
+		_, err = writer.WriteString(row + "\n")
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
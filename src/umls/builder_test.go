@@ -0,0 +1,95 @@
+package umls
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testMRCONSO = `C0032285|ENG|P|L0032285|PF|S0097005|Y|A0105426||||MSH|MH|D011014|Pneumonia|0|N||
+C0032285|ENG|P|L0032285|VO|S0097006|N|A0105427||||SNOMEDCT_US|SY|233604007|pneumonia|4|N||
+C0032285|ENG|S|L0032286|PF|S0097007|Y|A0105428||||SNOMEDCT_US|PT|233604007|Pneumonitis|4|O||
+C0032285|FRE|P|L0032287|PF|S0097008|Y|A0105429||||MSHFRE|MH|D011014|Pneumonie|3|N||
+C0026769|ENG|P|L0026769|PF|S0062936|Y|A0088466||||SNOMEDCT_US|PT|24700007|Multiple sclerosis|4|N||
+C0026769|ENG|S|L0026770|PF|S0062937|Y|A0088467||||SNOMEDCT_US|SY|24700007|MS|4|N||
+C0000001|ENG|P|L0000001|PF|S0000001|Y|A0000001||||SNOMEDCT_US|PT|1|Unknown type|4|N||
+`
+
+const testMRSTY = `C0032285|T047|B2.2.1.2.1|Disease or Syndrome|AT17683839|3840|
+C0026769|T047|B2.2.1.2.1|Disease or Syndrome|AT17554233|3840|
+C0026769|T191|B2.2.1.2.1.2|Neoplastic Process|AT17554234|3840|
+`
+
+const testMRSAT = `C0026769|L0026769|S0062936|A0088466|AUI|24700007|AT1||CTV3ID|SNOMEDCT_US|F20..|N||
+C0032285|L0032285|S0097006|A0105427|AUI|233604007|AT2||ACTIVE|SNOMEDCT_US|0|N||
+`
+
+func writeTestMeta(t *testing.T) string {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, MRCONSO), []byte(testMRCONSO), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, MRSTY), []byte(testMRSTY), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, MRSAT), []byte(testMRSAT), 0644))
+	return dir
+}
+
+func readRows(t *testing.T, path string) []string {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.True(t, strings.HasPrefix(lines[0], "#"))
+	return lines[1:]
+}
+
+func TestBuild(t *testing.T) {
+	metaDir := writeTestMeta(t)
+	result, err := Build(BuildParams{
+		MetaDir: metaDir,
+		OutDir:  filepath.Join(t.TempDir(), "umls"),
+		Name:    "snomed",
+		SABs:    []string{"snomedct_us"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, result.SkippedAtoms)
+	require.Equal(t, 2, result.Concepts)
+
+	require.Equal(t, []string{
+		"C0026769|[T047,T191]|PT|24700007|SNOMEDCT_US|Multiple sclerosis|Multiple sclerosis",
+		"C0026769|[T047,T191]|SY|24700007|SNOMEDCT_US|MS|Multiple sclerosis",
+		"C0032285|T047|SY|233604007|SNOMEDCT_US|pneumonia|Pneumonia",
+	}, readRows(t, result.TermPath))
+
+	require.Equal(t, []string{
+		"C0026769|[T047,T191]|PT|24700007|SNOMEDCT_US|Multiple sclerosis|Multiple sclerosis",
+		"C0026769|[T047,T191]|SY|24700007|SNOMEDCT_US|Multiple sclerosis|Multiple sclerosis",
+		"C0032285|T047|SY|233604007|SNOMEDCT_US|Pneumonia|Pneumonia",
+	}, readRows(t, result.ConceptPath))
+}
+
+func TestBuildFilters(t *testing.T) {
+	metaDir := writeTestMeta(t)
+	result, err := Build(BuildParams{
+		MetaDir:    metaDir,
+		OutDir:     t.TempDir(),
+		Name:       "filtered",
+		TTYs:       []string{"PT", "SY"},
+		Suppress:   []string{"N", "O"},
+		Attributes: []string{"CTV3ID", "ACTIVE=1"},
+	})
+	require.NoError(t, err)
+
+	// SY of pneumonia has ACTIVE=0, PT of pneumonia has no attributes
+	require.Equal(t, []string{
+		"C0026769|[T047,T191]|PT|24700007|SNOMEDCT_US|Multiple sclerosis|Multiple sclerosis",
+		"C0026769|[T047,T191]|SY|24700007|SNOMEDCT_US|MS|Multiple sclerosis",
+	}, readRows(t, result.TermPath))
+}
+
+func TestReadRRFColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), MRSTY)
+	require.NoError(t, os.WriteFile(path, []byte("C0032285|T047|\n"), 0644))
+
+	err := readRRF(path, mrstyColumns, func(columns []string) {})
+	require.Error(t, err)
+}
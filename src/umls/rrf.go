@@ -0,0 +1,76 @@
+package umls
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// column indexes of the RRF files, see UMLS Reference Manual, section "Metathesaurus - Rich Release Format"
+const (
+	// MRCONSO.RRF: CUI|LAT|TS|LUI|STT|SUI|ISPREF|AUI|SAUI|SCUI|SDUI|SAB|TTY|CODE|STR|SRL|SUPPRESS|CVF
+	mrconsoCUI      = 0
+	mrconsoLAT      = 1
+	mrconsoTS       = 2
+	mrconsoSTT      = 4
+	mrconsoISPREF   = 6
+	mrconsoSAB      = 11
+	mrconsoTTY      = 12
+	mrconsoCODE     = 13
+	mrconsoSTR      = 14
+	mrconsoSUPPRESS = 16
+	mrconsoColumns  = 18
+
+	// MRSTY.RRF: CUI|TUI|STN|STY|ATUI|CVF
+	mrstyCUI     = 0
+	mrstyTUI     = 1
+	mrstyColumns = 6
+
+	// MRSAT.RRF: CUI|LUI|SUI|METAUI|STYPE|CODE|ATUI|SATUI|ATN|SAB|ATV|SUPPRESS|CVF
+	mrsatCUI     = 0
+	mrsatCODE    = 5
+	mrsatATN     = 8
+	mrsatSAB     = 9
+	mrsatATV     = 10
+	mrsatColumns = 13
+)
+
+const (
+	MRCONSO = "MRCONSO.RRF"
+	MRSTY   = "MRSTY.RRF"
+	MRSAT   = "MRSAT.RRF"
+)
+
+// some STR values of MRCONSO are longer than the default scanner buffer
+const maxRRFLineLength = 1 << 20
+
+// readRRF calls handle for every row of the RRF file. Rows of RRF files are terminated by the delimiter,
+// so the last empty column is dropped.
+func readRRF(path string, columnsCount int, handle func(columns []string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRRFLineLength)
+
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if len(line) == 0 {
+			continue
+		}
+
+		columns := strings.Split(strings.TrimSuffix(line, "|"), "|")
+		if len(columns) != columnsCount {
+			return fmt.Errorf("%s:%d: expected %d columns, got %d", path, lineNum, columnsCount, len(columns))
+		}
+		handle(columns)
+	}
+
+	return scanner.Err()
+}
@@ -13,6 +13,15 @@ type GetHashFunc func(columns []string) uint64
 type CreateInstanceFunc func(columns []string) error
 
 func NewBSVReader(bsvPath string, getHash GetHashFunc) (<-chan []string, error) {
+	return newBSVReader(bsvPath, getHash, true)
+}
+
+// NewCasedBSVReader works as NewBSVReader but keeps the original case of the columns
+func NewCasedBSVReader(bsvPath string, getHash GetHashFunc) (<-chan []string, error) {
+	return newBSVReader(bsvPath, getHash, false)
+}
+
+func newBSVReader(bsvPath string, getHash GetHashFunc, toLower bool) (<-chan []string, error) {
 	_, fileName := path.Split(bsvPath)
 	fdlLogger := logger.NewLogger("BSVReader (" + fileName + ")")
 
@@ -46,7 +55,10 @@ func NewBSVReader(bsvPath string, getHash GetHashFunc) (<-chan []string, error)
 			if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
 				continue
 			}
-			line = strings.ToLower(strings.Trim(line, "\n"))
+			line = strings.Trim(line, "\n")
+			if toLower {
+				line = strings.ToLower(line)
+			}
 			columns := strings.Split(line, "|")
 
 			hash := getHash(columns)
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readBSV(t *testing.T, read func(string, GetHashFunc) (<-chan []string, error), path string) [][]string {
+	rows, err := read(path, func(columns []string) uint64 { return HashString(strings.Join(columns, "|")) })
+	require.NoError(t, err)
+	var result [][]string
+	for row := range rows {
+		result = append(result, row)
+	}
+	return result
+}
+
+func TestBSVReaderCase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "terms.bsv")
+	content := "# comment\nC0020538|HTN\nC0020538|htn\nC0020538|HTN\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+	// duplicates are removed after lower casing
+	require.Equal(t, [][]string{{"c0020538", "htn"}}, readBSV(t, NewBSVReader, path))
+	require.Equal(t, [][]string{{"C0020538", "HTN"}, {"C0020538", "htn"}}, readBSV(t, NewCasedBSVReader, path))
+}
@@ -0,0 +1,21 @@
+package utils
+
+// MappedFile is a read-only file mapped into memory. Pages of the file are shared between the processes
+// which map the same file, so the dictionary indexes don't have to be loaded into the heap of every replica.
+type MappedFile struct {
+	data  []byte
+	unmap func([]byte) error
+}
+
+func (file *MappedFile) Bytes() []byte {
+	return file.data
+}
+
+func (file *MappedFile) Close() error {
+	if file.data == nil || file.unmap == nil {
+		return nil
+	}
+	err := file.unmap(file.data)
+	file.data = nil
+	return err
+}
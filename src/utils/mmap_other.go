@@ -0,0 +1,16 @@
+//go:build !unix
+
+package utils
+
+import (
+	"io/ioutil"
+)
+
+// OpenMappedFile reads the whole file into memory on the platforms without mmap support
+func OpenMappedFile(path string) (*MappedFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &MappedFile{data: data}, nil
+}
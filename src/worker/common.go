@@ -13,10 +13,18 @@ func getResultsFileKey(task *Task) string {
 		task.chunkTask.DocID,
 		"chunks",
 		task.redisKey,
-		fmt.Sprintf("%s.fdl_results.json", task.redisKey),
+		fmt.Sprintf("%s.fdl_results%s", task.redisKey, task.getResultsExtension()),
 	)
 }
 
+// getResultsExtension returns the results file extension of the output format, JSON if the format is not set
+func (task *Task) getResultsExtension() string {
+	if len(task.format.Extension) == 0 {
+		return ".json"
+	}
+	return task.format.Extension
+}
+
 const RFC3339Micro = "2006-01-02T15:04:05.000000-07:00"
 
 func getFormattedNow() *string {
@@ -35,6 +35,8 @@ type pipelineCall struct {
 type redisMock struct {
 	config redisMockConfig
 	calls  redisMockCalls
+	// chunk task updated by onTaskComplete
+	completed *tasks.ChunkTask
 }
 
 type redisMockConfig struct {
@@ -197,6 +199,8 @@ func (mock *redisMock) onTaskComplete(task *Task) error {
 	if mock.config.onTaskComplete.fail {
 		return errors.New("failed to update chunk task on complete")
 	}
+	mock.completed = &tasks.ChunkTask{}
+	completeChunkTask(mock.completed, task)
 	return nil
 }
 func (mock *rmqMock) rejectDelivery(delivery *amqp.Delivery, fdlLogger *zerolog.Logger) {
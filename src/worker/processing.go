@@ -1,6 +1,7 @@
 package worker
 
 import (
+	"text2phenotype.com/fdl/output"
 	"text2phenotype.com/fdl/pipeline"
 	"text2phenotype.com/fdl/tasks"
 	"text2phenotype.com/fdl/utils"
@@ -16,6 +17,8 @@ type Message struct {
 	RedisKey string `json:"redis_key"`
 	Sender   string `json:"sender"`
 	Version  string `json:"version"`
+	// optional parameters of the configurations for this document
+	Vocabs []pipeline.RequestVocabParams `json:"vocabs,omitempty"`
 }
 
 type Task struct {
@@ -24,6 +27,14 @@ type Task struct {
 	message   *Message
 	redisKey  string
 	fdlLogger *zerolog.Logger
+	// output format of the job, is set before the pipeline runs
+	outputFormat    string
+	responseVersion string
+	format          output.Format
+	// content encoding of the saved results file
+	resultsEncoding string
+	// id of the key the saved results file is encrypted with, empty if it isn't encrypted
+	resultsKeyID string
 }
 
 func (worker *Worker) processMessage(delivery *amqp.Delivery) {
@@ -110,9 +121,22 @@ func (worker *Worker) runPipeline(task *Task) (err error) {
 		task.fdlLogger.Err(err).Caller().Msg("Could not fetch text data from s3")
 		return fmt.Errorf("failed fetch data from s3: %w", err)
 	}
+	task.format, err = output.GetFormat(task.outputFormat)
+	if err != nil {
+		task.fdlLogger.Err(err).Msg("Output format of the job is not correct")
+		return err
+	}
+	task.format, err = output.WithVersion(task.format, task.responseVersion)
+	if err != nil {
+		task.fdlLogger.Err(err).Msg("Response version of the job is not correct")
+		return err
+	}
 	request := pipeline.Request{
-		Tid:  task.redisKey,
-		Text: string(data),
+		Tid:     task.redisKey,
+		Text:    string(data),
+		Vocabs:  task.message.Vocabs,
+		Format:  task.format.Name,
+		Version: task.responseVersion,
 	}
 	result, ok := <-worker.ppln(request)
 	if !ok {
@@ -144,6 +168,8 @@ func (worker *Worker) shouldPerformTask(task *Task) (bool, error) {
 		err := worker.redis.onTaskCancelled(task)
 		return false, err
 	}
+	task.outputFormat = taskJob.OutputFormat
+	task.responseVersion = taskJob.ResponseVersion
 	var docTask *tasks.DocumentTaskCached
 	if taskJob.StopDocumentsOnFailure {
 		docTask, err = worker.redis.getDocTask(task)
@@ -84,14 +84,21 @@ func (wrapper *redisClientWrapper) onTaskFailedWithError(task *Task, err error)
 
 func (wrapper *redisClientWrapper) onTaskComplete(task *Task) error {
 	return wrapper.tasksClient.Chunks.Update(task.redisKey, func(chunkTask *tasks.ChunkTask) {
-		if !chunkTask.TaskStatuses.FDL.Status.Complete() {
-			chunkTask.TaskStatuses.FDL.Status = tasks.TaskStatusCompletedSuccess
-		}
-		chunkTask.TaskStatuses.FDL.CompletedAt = getFormattedNow()
-		chunkTask.TaskStatuses.FDL.ResultsFileKey = getResultsFileKey(task)
+		completeChunkTask(chunkTask, task)
 	})
 }
 
+// completeChunkTask marks the chunk task as completed with the key and the encoding of the saved results file
+func completeChunkTask(chunkTask *tasks.ChunkTask, task *Task) {
+	if !chunkTask.TaskStatuses.FDL.Status.Complete() {
+		chunkTask.TaskStatuses.FDL.Status = tasks.TaskStatusCompletedSuccess
+	}
+	chunkTask.TaskStatuses.FDL.CompletedAt = getFormattedNow()
+	chunkTask.TaskStatuses.FDL.ResultsFileKey = getResultsFileKey(task)
+	chunkTask.TaskStatuses.FDL.ResultsFileEncoding = task.resultsEncoding
+	chunkTask.TaskStatuses.FDL.ResultsFileKeyID = task.resultsKeyID
+}
+
 func (wrapper *redisClientWrapper) getChunkTask(redisKey string) (*tasks.ChunkTask, error) {
 	return wrapper.tasksClient.Chunks.Get(redisKey)
 }
@@ -2,6 +2,8 @@ package worker
 
 import (
 	"text2phenotype.com/fdl/s3client"
+	"fmt"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
 type s3Transactions interface {
@@ -10,8 +12,19 @@ type s3Transactions interface {
 	close()
 }
 
+// s3Storage is the part of the S3 client used by the worker
+type s3Storage interface {
+	UploadObject(object s3client.Object, key string) (*s3manager.UploadOutput, error)
+	Download(key string) ([]byte, error)
+	Close()
+}
+
 type s3ClientWrapper struct {
-	s3Client *s3client.Client
+	s3Client s3Storage
+	// content encoding of the results files
+	encoding string
+	// encrypts the results and decrypts the inputs, nil if the encryption isn't configured
+	encryptor *s3client.Encryptor
 }
 
 func (wrapper *s3ClientWrapper) close() {
@@ -20,10 +33,29 @@ func (wrapper *s3ClientWrapper) close() {
 
 func (wrapper *s3ClientWrapper) saveResultsFile(task *Task, result string) error {
 	resultsFileKey := getResultsFileKey(task)
-	_, err := wrapper.s3Client.Upload(result, resultsFileKey)
-	return err
+	object, err := s3client.EncodeObject([]byte(result), wrapper.encoding, wrapper.encryptor)
+	if err != nil {
+		return err
+	}
+	if _, err := wrapper.s3Client.UploadObject(object, resultsFileKey); err != nil {
+		return err
+	}
+	task.resultsEncoding = wrapper.encoding
+	if wrapper.encryptor != nil {
+		task.resultsKeyID = wrapper.encryptor.KeyID()
+	}
+	return nil
 }
 
+// getProcessedData downloads the text of the chunk, encrypted texts are decrypted and gzip and zstd compressed texts
+// are decompressed
 func (wrapper *s3ClientWrapper) getProcessedData(task *Task) ([]byte, error) {
-	return wrapper.s3Client.Download(task.chunkTask.TextFileKey)
+	data, err := wrapper.s3Client.Download(task.chunkTask.TextFileKey)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = s3client.DecodeObject(data, wrapper.encryptor); err != nil {
+		return nil, fmt.Errorf("%s: %w", task.chunkTask.TextFileKey, err)
+	}
+	return data, nil
 }
@@ -0,0 +1,163 @@
+package worker
+
+import (
+	"bytes"
+	"text2phenotype.com/fdl/s3client"
+	"text2phenotype.com/fdl/tasks"
+	"errors"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// memoryStorage keeps the uploaded objects by key
+type memoryStorage struct {
+	objects map[string]s3client.Object
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{objects: make(map[string]s3client.Object)}
+}
+
+func (storage *memoryStorage) UploadObject(object s3client.Object, key string) (*s3manager.UploadOutput, error) {
+	storage.objects[key] = object
+	return &s3manager.UploadOutput{}, nil
+}
+
+func (storage *memoryStorage) Download(key string) ([]byte, error) {
+	object, ok := storage.objects[key]
+	if !ok {
+		return nil, errors.New("object is not found")
+	}
+	return object.Body, nil
+}
+
+func (storage *memoryStorage) Close() {}
+
+func TestSaveResultsFileEncoding(t *testing.T) {
+	result := `{"snomedct": {"content": []}}`
+	tests := []struct {
+		encoding        string
+		contentEncoding string
+	}{
+		{encoding: s3client.EncodingGzip, contentEncoding: "gzip"},
+		{encoding: s3client.EncodingZstd, contentEncoding: "zstd"},
+		{encoding: s3client.EncodingIdentity, contentEncoding: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.encoding, func(t *testing.T) {
+			storage := newMemoryStorage()
+			wrapper := &s3ClientWrapper{s3Client: storage, encoding: test.encoding}
+			task := &Task{redisKey: "chunk1", chunkTask: &tasks.ChunkTask{DocID: "doc1"}}
+
+			require.NoError(t, wrapper.saveResultsFile(task, result))
+			object, ok := storage.objects[getResultsFileKey(task)]
+			require.True(t, ok)
+			require.Equal(t, test.contentEncoding, object.ContentEncoding)
+			require.Equal(t, test.encoding, s3client.GetEncoding(object.Body))
+			decoded, err := s3client.Decode(object.Body)
+			require.NoError(t, err)
+			require.Equal(t, result, string(decoded))
+
+			chunkTask := tasks.ChunkTask{}
+			completeChunkTask(&chunkTask, task)
+			require.Equal(t, tasks.TaskStatusCompletedSuccess, chunkTask.TaskStatuses.FDL.Status)
+			require.Equal(t, getResultsFileKey(task), chunkTask.TaskStatuses.FDL.ResultsFileKey)
+			require.Equal(t, test.encoding, chunkTask.TaskStatuses.FDL.ResultsFileEncoding)
+			require.Empty(t, chunkTask.TaskStatuses.FDL.ResultsFileKeyID)
+		})
+	}
+}
+
+func TestGetProcessedDataDecodesInputs(t *testing.T) {
+	text := "Patient denies chest pain."
+	storage := newMemoryStorage()
+	wrapper := &s3ClientWrapper{s3Client: storage, encoding: s3client.EncodingGzip}
+	for _, encoding := range []string{s3client.EncodingIdentity, s3client.EncodingGzip, s3client.EncodingZstd} {
+		object, err := s3client.EncodeObject([]byte(text), encoding, nil)
+		require.NoError(t, err)
+		storage.objects[encoding] = object
+
+		data, err := wrapper.getProcessedData(&Task{chunkTask: &tasks.ChunkTask{TextFileKey: encoding}})
+		require.NoError(t, err)
+		require.Equal(t, text, string(data))
+	}
+}
+
+func TestWorkerRecordsResultsEncoding(t *testing.T) {
+	worker, mocks := configureWorker(mockedClientsConfig{
+		pipelineMockConfig: pipelineMockConfig{result: `{"snomedct": {}}`},
+	})
+	storage := newMemoryStorage()
+	storage.objects[""] = s3client.Object{Body: []byte("some input")}
+	worker.s3 = &s3ClientWrapper{s3Client: storage, encoding: worker.config.ResultsEncoding}
+
+	worker.processMessage(&amqp.Delivery{Body: []byte(`{"redis_key": "chunk1"}`)})
+
+	require.NotNil(t, mocks.redis.completed)
+	info := mocks.redis.completed.TaskStatuses.FDL
+	require.Equal(t, s3client.EncodingGzip, info.ResultsFileEncoding)
+	object, ok := storage.objects[info.ResultsFileKey]
+	require.True(t, ok)
+	require.Equal(t, "gzip", object.ContentEncoding)
+	require.Equal(t, s3client.EncodingGzip, s3client.GetEncoding(object.Body))
+}
+
+func TestSaveResultsFileEncrypted(t *testing.T) {
+	result := `{"snomedct": {"content": []}}`
+	encryptor, err := s3client.NewEncryptor("kek-1", bytes.Repeat([]byte{7}, 32))
+	require.NoError(t, err)
+	storage := newMemoryStorage()
+	wrapper := &s3ClientWrapper{s3Client: storage, encoding: s3client.EncodingZstd, encryptor: encryptor}
+	task := &Task{redisKey: "chunk1", chunkTask: &tasks.ChunkTask{DocID: "doc1"}}
+
+	require.NoError(t, wrapper.saveResultsFile(task, result))
+	key := getResultsFileKey(task)
+	object := storage.objects[key]
+	require.True(t, s3client.IsEncrypted(object.Body))
+	require.Empty(t, object.ContentEncoding)
+	require.Equal(t, "kek-1", object.Metadata[s3client.MetadataKeyID])
+	require.Equal(t, s3client.EncodingZstd, object.Metadata[s3client.MetadataEncoding])
+
+	// the encrypted file is read back as the input of the chunk
+	data, err := wrapper.getProcessedData(&Task{chunkTask: &tasks.ChunkTask{TextFileKey: key}})
+	require.NoError(t, err)
+	require.Equal(t, result, string(data))
+
+	chunkTask := tasks.ChunkTask{}
+	completeChunkTask(&chunkTask, task)
+	require.Equal(t, s3client.EncodingZstd, chunkTask.TaskStatuses.FDL.ResultsFileEncoding)
+	require.Equal(t, "kek-1", chunkTask.TaskStatuses.FDL.ResultsFileKeyID)
+
+	// encrypted inputs fail without the key
+	wrapper.encryptor = nil
+	_, err = wrapper.getProcessedData(&Task{chunkTask: &tasks.ChunkTask{TextFileKey: key}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), key)
+	_, err = wrapper.getProcessedData(&Task{chunkTask: &tasks.ChunkTask{TextFileKey: "missing"}})
+	require.Error(t, err)
+}
+
+func TestWorkerRecordsResultsKeyID(t *testing.T) {
+	encryptor, err := s3client.NewEncryptor("kek-1", bytes.Repeat([]byte{7}, 32))
+	require.NoError(t, err)
+	worker, mocks := configureWorker(mockedClientsConfig{
+		pipelineMockConfig: pipelineMockConfig{result: `{"snomedct": {}}`},
+	})
+	storage := newMemoryStorage()
+	input, err := s3client.EncodeObject([]byte("some input"), s3client.EncodingGzip, encryptor)
+	require.NoError(t, err)
+	storage.objects[""] = input
+	worker.s3 = &s3ClientWrapper{s3Client: storage, encoding: worker.config.ResultsEncoding, encryptor: encryptor}
+
+	worker.processMessage(&amqp.Delivery{Body: []byte(`{"redis_key": "chunk1"}`)})
+
+	require.NotNil(t, mocks.redis.completed)
+	info := mocks.redis.completed.TaskStatuses.FDL
+	require.Equal(t, s3client.EncodingGzip, info.ResultsFileEncoding)
+	require.Equal(t, "kek-1", info.ResultsFileKeyID)
+	object, ok := storage.objects[info.ResultsFileKey]
+	require.True(t, ok)
+	require.True(t, s3client.IsEncrypted(object.Body))
+}
@@ -13,10 +13,19 @@ import (
 
 type Config struct {
 	TaskMaxRetries int `envconfig:"MDL_COMN_RETRY_TASK_COUNT_MAX" default:"3"`
+	// content encoding of the results files (allowed: gzip, zstd, identity)
+	ResultsEncoding string `envconfig:"FDL_RESULTS_ENCODING" default:"gzip"`
+	// base64 encoded AES-256 key-encryption key of the results and inputs, set directly or in the key file;
+	// the files aren't encrypted if neither is set
+	EncryptionKey     string `envconfig:"FDL_ENCRYPTION_KEY"`
+	EncryptionKeyFile string `envconfig:"FDL_ENCRYPTION_KEY_FILE"`
+	// id of the key which is stored with the encrypted files, the key fingerprint by default
+	EncryptionKeyID string `envconfig:"FDL_ENCRYPTION_KEY_ID"`
 }
 
 type Worker struct {
 	config    Config
+	encryptor *s3client.Encryptor
 	redis     redisTransactions
 	s3        s3Transactions
 	rmq       rmqTransactions
@@ -32,9 +41,23 @@ func New(ppln pipeline.Pipeline) (*Worker, error) {
 		fdlLogger.Error().Err(err).Msg("Could not read config")
 		return nil, err
 	}
+	if err := s3client.ValidateEncoding(config.ResultsEncoding); err != nil {
+		fdlLogger.Error().Err(err).Msg("Could not read config")
+		return nil, err
+	}
+
+	encryptor, err := s3client.LoadEncryptor(config.EncryptionKeyID, config.EncryptionKey, config.EncryptionKeyFile)
+	if err != nil {
+		fdlLogger.Error().Err(err).Msg("Could not load encryption key")
+		return nil, err
+	}
+	if encryptor != nil {
+		fdlLogger.Info().Str("key_id", encryptor.KeyID()).Msg("Results will be encrypted")
+	}
 
 	worker := Worker{
 		config:    config,
+		encryptor: encryptor,
 		fdlLogger: &fdlLogger,
 		ppln:      ppln,
 	}
@@ -141,7 +164,11 @@ func (worker *Worker) refreshS3Client() error {
 		worker.fdlLogger.Err(err).Msg("Failed to refresh S3 client")
 		return err
 	}
-	worker.s3 = &s3ClientWrapper{s3Client}
+	worker.s3 = &s3ClientWrapper{
+		s3Client:  s3Client,
+		encoding:  worker.config.ResultsEncoding,
+		encryptor: worker.encryptor,
+	}
 	worker.fdlLogger.Info().Msg("Refreshed S3 client")
 	return nil
 }
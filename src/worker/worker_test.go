@@ -2,6 +2,7 @@ package worker
 
 import (
 	"text2phenotype.com/fdl/logger"
+	"text2phenotype.com/fdl/s3client"
 	"text2phenotype.com/fdl/tasks"
 	"github.com/streadway/amqp"
 	"reflect"
@@ -54,7 +55,7 @@ func configureWorker(config mockedClientsConfig) (*Worker, *mockedClients) {
 	fdlLogger := logger.NewLogger("Test Worker")
 
 	return &Worker{
-			config:    Config{3},
+			config:    Config{TaskMaxRetries: 3, ResultsEncoding: s3client.EncodingGzip},
 			redis:     redis,
 			s3:        s3,
 			rmq:       rmq,